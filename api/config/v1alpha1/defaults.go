@@ -0,0 +1,95 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+)
+
+const (
+	defaultConcurrency = 10
+	defaultWebhookPort = 9443
+)
+
+// SetDefaults_MachineAPIManagerConfiguration sets the defaults of the
+// fields that are not set.
+func SetDefaults_MachineAPIManagerConfiguration(cfg *MachineAPIManagerConfiguration) {
+	if cfg.MetricsBindAddress == "" {
+		cfg.MetricsBindAddress = ":8080"
+	}
+	if cfg.HealthProbeBindAddress == "" {
+		cfg.HealthProbeBindAddress = ":9440"
+	}
+	if cfg.Webhook.Port == 0 {
+		cfg.Webhook.Port = defaultWebhookPort
+	}
+	if cfg.LeaderElection.ID == "" {
+		cfg.LeaderElection.ID = "78c2e11e.crit.sh"
+	}
+	if cfg.Logging.Format == "" {
+		cfg.Logging.Format = TextLogFormat
+	}
+
+	c := &cfg.Controllers
+	setDurationDefault(&c.ExternalReadyWait, 30*time.Second)
+	setControllerDefaults(&c.Config, true)
+	setControllerDefaults(&c.Machine.ControllerConfiguration, true)
+	setControllerDefaults(&c.Node.ControllerConfiguration, false)
+	setControllerDefaults(&c.CSRApprover.ControllerConfiguration, true)
+	setControllerDefaults(&c.InfrastructureProvider, true)
+	if c.Adoption.Concurrency == 0 {
+		c.Adoption.Concurrency = defaultConcurrency
+	}
+	if c.Machine.CertificateExpiryThreshold == nil {
+		c.Machine.CertificateExpiryThreshold = &metav1.Duration{Duration: 7 * 24 * time.Hour}
+	}
+	setDurationDefault(&c.Machine.Drain.Timeout, 20*time.Second)
+	if c.Node.Namespace == "" {
+		c.Node.Namespace = metav1.NamespaceSystem
+	}
+	if c.Node.AdoptionDelay == nil {
+		c.Node.AdoptionDelay = &metav1.Duration{Duration: 2 * time.Minute}
+	}
+	if c.Orphan.GracePeriod == nil {
+		c.Orphan.GracePeriod = &metav1.Duration{Duration: time.Hour}
+	}
+}
+
+func setControllerDefaults(c *ControllerConfiguration, enabled bool) {
+	if c.Enabled == nil {
+		c.Enabled = pointer.BoolPtr(enabled)
+	}
+	if c.Concurrency == 0 {
+		c.Concurrency = defaultConcurrency
+	}
+}
+
+// setDurationDefault sets a duration that is zero, for durations zero is not
+// valid for. Durations that may be zero are pointers instead.
+func setDurationDefault(d *metav1.Duration, value time.Duration) {
+	if d.Duration == 0 {
+		d.Duration = value
+	}
+}
+
+// IsEnabled returns whether the controller runs.
+func (c *ControllerConfiguration) IsEnabled() bool {
+	return c.Enabled != nil && *c.Enabled
+}
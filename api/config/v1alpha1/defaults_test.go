@@ -0,0 +1,80 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestDecode(t *testing.T) {
+	t.Run("sets defaults", func(t *testing.T) {
+		g := NewWithT(t)
+
+		cfg, err := Decode([]byte(`
+apiVersion: config.machine.crit.sh/v1alpha1
+kind: MachineAPIManagerConfiguration
+logging:
+  format: json
+controllers:
+  machine:
+    concurrency: 20
+    certificateExpiryThreshold: 0s
+  node:
+    enabled: true
+    adoptionDelay: 0s
+`))
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(cfg.MetricsBindAddress).To(Equal(":8080"))
+		g.Expect(cfg.Webhook.Port).To(Equal(9443))
+		g.Expect(cfg.LeaderElection.ID).To(Equal("78c2e11e.crit.sh"))
+		g.Expect(cfg.Logging.Format).To(Equal(JSONLogFormat))
+		g.Expect(cfg.Controllers.ExternalReadyWait.Duration).To(Equal(30 * time.Second))
+		g.Expect(cfg.Controllers.Config.IsEnabled()).To(BeTrue())
+		g.Expect(cfg.Controllers.Config.Concurrency).To(Equal(10))
+		g.Expect(cfg.Controllers.Machine.Concurrency).To(Equal(20))
+		g.Expect(cfg.Controllers.Machine.CertificateExpiryThreshold.Duration).To(BeZero())
+		g.Expect(cfg.Controllers.Machine.Drain.Timeout.Duration).To(Equal(20 * time.Second))
+		g.Expect(cfg.Controllers.Node.IsEnabled()).To(BeTrue())
+		g.Expect(cfg.Controllers.Node.Namespace).To(Equal("kube-system"))
+		g.Expect(cfg.Controllers.Node.AdoptionDelay.Duration).To(BeZero())
+		g.Expect(cfg.Controllers.Orphan.GracePeriod.Duration).To(Equal(time.Hour))
+	})
+
+	t.Run("rejects unknown fields", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := Decode([]byte(`
+apiVersion: config.machine.crit.sh/v1alpha1
+kind: MachineAPIManagerConfiguration
+metricsAddr: ":8080"
+`))
+		g.Expect(err).To(MatchError(ContainSubstring("metricsAddr")))
+	})
+
+	t.Run("rejects other kinds", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := Decode([]byte(`
+apiVersion: v1
+kind: ConfigMap
+`))
+		g.Expect(err).To(HaveOccurred())
+	})
+}
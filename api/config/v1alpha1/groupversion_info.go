@@ -0,0 +1,65 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1alpha1 contains the v1alpha1 configuration file format of the
+// machine-api manager.
+// +kubebuilder:object:generate=true
+// +groupName=config.machine.crit.sh
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+)
+
+var (
+	// GroupVersion is group version used to register these objects
+	GroupVersion = schema.GroupVersion{Group: "config.machine.crit.sh", Version: "v1alpha1"}
+
+	// SchemeBuilder registers the types and their defaults.
+	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes, addDefaultingFuncs)
+
+	// AddToScheme adds the types in this group-version to the given scheme.
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(GroupVersion, &MachineAPIManagerConfiguration{})
+	return nil
+}
+
+func addDefaultingFuncs(scheme *runtime.Scheme) error {
+	scheme.AddTypeDefaultingFunc(&MachineAPIManagerConfiguration{}, func(obj interface{}) {
+		SetDefaults_MachineAPIManagerConfiguration(obj.(*MachineAPIManagerConfiguration))
+	})
+	return nil
+}
+
+// Decode decodes a configuration file, rejecting unknown fields, and sets
+// the defaults of the fields that are not set.
+func Decode(data []byte) (*MachineAPIManagerConfiguration, error) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	codecs := serializer.NewCodecFactory(scheme, serializer.EnableStrict)
+	cfg := &MachineAPIManagerConfiguration{}
+	if err := runtime.DecodeInto(codecs.UniversalDecoder(GroupVersion), data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Log formats.
+const (
+	// TextLogFormat logs human readable lines.
+	TextLogFormat = "text"
+
+	// JSONLogFormat logs JSON objects.
+	JSONLogFormat = "json"
+)
+
+// +kubebuilder:object:root=true
+
+// MachineAPIManagerConfiguration is the configuration file of the
+// machine-api manager.
+type MachineAPIManagerConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// MetricsBindAddress is the address the metrics endpoint binds to.
+	MetricsBindAddress string `json:"metricsBindAddress,omitempty"`
+
+	// HealthProbeBindAddress is the address the liveness and readiness
+	// probe endpoints bind to.
+	HealthProbeBindAddress string `json:"healthProbeBindAddress,omitempty"`
+
+	// WatchNamespaces restricts the manager to the objects of these
+	// namespaces. Cluster-scoped objects, such as Nodes, are still watched.
+	// They must include the node adoption namespace, the namespace of the
+	// etcd client secret and the allowed infrastructure namespaces. All
+	// namespaces are watched when empty.
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+
+	Webhook        WebhookConfiguration        `json:"webhook,omitempty"`
+	LeaderElection LeaderElectionConfiguration `json:"leaderElection,omitempty"`
+	Logging        LoggingConfiguration        `json:"logging,omitempty"`
+	Controllers    ControllersConfiguration    `json:"controllers,omitempty"`
+}
+
+// WebhookConfiguration configures the webhook server.
+type WebhookConfiguration struct {
+	// Enabled starts the webhook server, which readiness then requires to
+	// be serving.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Port is the port the webhook server listens on. Defaults to 9443.
+	Port int `json:"port,omitempty"`
+}
+
+// LeaderElectionConfiguration configures leader election between replicas
+// of the manager.
+type LeaderElectionConfiguration struct {
+	// Enabled ensures there is only one active manager.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// ID is the name of the leader election lock. Defaults to
+	// 78c2e11e.crit.sh.
+	ID string `json:"id,omitempty"`
+
+	// Namespace is the namespace of the leader election lock. Defaults to
+	// the namespace of the manager.
+	Namespace string `json:"namespace,omitempty"`
+
+	// LeaseDuration is the time non-leader replicas wait before trying to
+	// acquire a lock that has not been renewed.
+	LeaseDuration *metav1.Duration `json:"leaseDuration,omitempty"`
+
+	// RenewDeadline is the time the leader retries renewing the lock before
+	// giving up leadership.
+	RenewDeadline *metav1.Duration `json:"renewDeadline,omitempty"`
+
+	// RetryPeriod is the time between attempts to acquire or renew the
+	// lock.
+	RetryPeriod *metav1.Duration `json:"retryPeriod,omitempty"`
+}
+
+// LoggingConfiguration configures the logs of the manager.
+type LoggingConfiguration struct {
+	// Format is the format of the logs, text or json. Defaults to text.
+	Format string `json:"format,omitempty"`
+
+	// Level is the verbosity of the logs, where 0 only logs informational
+	// messages and errors.
+	Level int `json:"level,omitempty"`
+}
+
+// ControllerConfiguration is the configuration shared by all controllers.
+type ControllerConfiguration struct {
+	// Enabled runs the controller.
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Concurrency is the number of objects processed simultaneously.
+	// Defaults to 10.
+	Concurrency int `json:"concurrency,omitempty"`
+}
+
+// ControllersConfiguration configures the controllers of the manager.
+type ControllersConfiguration struct {
+	// ExternalReadyWait is the time between polls for external objects,
+	// such as infrastructure objects, to be ready. Defaults to 30s.
+	ExternalReadyWait metav1.Duration `json:"externalReadyWait,omitempty"`
+
+	// Config is enabled by default.
+	Config ControllerConfiguration `json:"config,omitempty"`
+
+	// Machine is enabled by default.
+	Machine MachineControllerConfiguration `json:"machine,omitempty"`
+
+	// Node adopts Nodes that were not provisioned by the machine-api. It is
+	// disabled by default.
+	Node NodeControllerConfiguration `json:"node,omitempty"`
+
+	// CSRApprover is enabled by default.
+	CSRApprover CSRApproverControllerConfiguration `json:"csrApprover,omitempty"`
+
+	// InfrastructureProvider is enabled by default.
+	InfrastructureProvider ControllerConfiguration `json:"infrastructureProvider,omitempty"`
+
+	// Adoption adopts infrastructure objects of the given kinds. It is
+	// enabled when kinds are set.
+	Adoption AdoptionControllerConfiguration `json:"adoption,omitempty"`
+
+	// Orphan scans for orphaned objects. It is enabled when ScanInterval is
+	// set.
+	Orphan OrphanControllerConfiguration `json:"orphan,omitempty"`
+}
+
+// MachineControllerConfiguration configures the Machine controller.
+type MachineControllerConfiguration struct {
+	ControllerConfiguration `json:",inline"`
+
+	// InfrastructureDeleteTimeout is the time to wait for the
+	// infrastructure of a deleted Machine to be gone before moving on. Zero
+	// waits forever.
+	InfrastructureDeleteTimeout metav1.Duration `json:"infrastructureDeleteTimeout,omitempty"`
+
+	// EtcdClientSecret is the namespace/name of the Secret holding the etcd
+	// client certificates used to remove the etcd member of deleted control
+	// plane Machines. Member removal is disabled when not set.
+	EtcdClientSecret string `json:"etcdClientSecret,omitempty"`
+
+	// EtcdEndpoints are the etcd client URLs. Defaults to the InternalIPs of
+	// the control plane Nodes.
+	EtcdEndpoints []string `json:"etcdEndpoints,omitempty"`
+
+	// MinControlPlaneMachines is the minimum number of healthy control plane
+	// Machines that must remain when a control plane Machine is deleted.
+	// Zero disables the check.
+	MinControlPlaneMachines int `json:"minControlPlaneMachines,omitempty"`
+
+	// AllowedInfrastructureNamespaces are the namespaces, besides their
+	// own, that Machines may reference infrastructure objects in.
+	AllowedInfrastructureNamespaces []string `json:"allowedInfrastructureNamespaces,omitempty"`
+
+	// CertificateExpiryThreshold is the time before the expiry of a kubelet
+	// certificate that the CertificateExpiringSoon condition of its Machine
+	// is raised. Zero disables the condition. Defaults to 168h.
+	CertificateExpiryThreshold *metav1.Duration `json:"certificateExpiryThreshold,omitempty"`
+
+	Drain DrainConfiguration `json:"drain,omitempty"`
+
+	Requeue RequeueConfiguration `json:"requeue,omitempty"`
+}
+
+// RequeueConfiguration holds the times between checks of the stages the
+// deletion of a Machine waits on. Zero uses ExternalReadyWait.
+type RequeueConfiguration struct {
+	// DeleteHooks is the time between checks of the lifecycle hooks blocking
+	// the deletion of a Machine.
+	DeleteHooks metav1.Duration `json:"deleteHooks,omitempty"`
+
+	// ControlPlaneDeletion is the time between attempts to acquire the
+	// control plane deletion Lease, and checks of the healthy control plane
+	// Machines.
+	ControlPlaneDeletion metav1.Duration `json:"controlPlaneDeletion,omitempty"`
+
+	// EtcdMemberRemoval is the time between checks of the etcd quorum
+	// before the etcd member of a control plane Machine is removed.
+	EtcdMemberRemoval metav1.Duration `json:"etcdMemberRemoval,omitempty"`
+
+	// InfrastructureDeletion is the time between checks of the
+	// infrastructure object of a deleted Machine being gone.
+	InfrastructureDeletion metav1.Duration `json:"infrastructureDeletion,omitempty"`
+}
+
+// DrainConfiguration holds the defaults for draining the Nodes of deleted
+// Machines, used when the Machine does not set them.
+type DrainConfiguration struct {
+	// Timeout is the time to wait for the pods of the Node to be evicted
+	// before requeuing the Machine. Defaults to 20s.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+
+	// NodeDrainTimeout is the total time draining a Node may take before
+	// it is deleted anyway. Zero waits forever.
+	NodeDrainTimeout metav1.Duration `json:"nodeDrainTimeout,omitempty"`
+}
+
+// NodeControllerConfiguration configures the adoption of Nodes.
+type NodeControllerConfiguration struct {
+	ControllerConfiguration `json:",inline"`
+
+	// Namespace is the namespace adopted Machines are created in. Defaults
+	// to kube-system.
+	Namespace string `json:"namespace,omitempty"`
+
+	// AdoptionDelay is the minimum age of a Node before it is adopted. Zero
+	// adopts Nodes right away. Defaults to 2m.
+	AdoptionDelay *metav1.Duration `json:"adoptionDelay,omitempty"`
+}
+
+// CSRApproverControllerConfiguration configures the CSR approver.
+type CSRApproverControllerConfiguration struct {
+	ControllerConfiguration `json:",inline"`
+
+	// DenyInvalid denies node CSRs that cannot be approved, instead of
+	// leaving them pending.
+	DenyInvalid bool `json:"denyInvalid,omitempty"`
+}
+
+// AdoptionControllerConfiguration configures the adoption of
+// infrastructure objects.
+type AdoptionControllerConfiguration struct {
+	// Concurrency is the number of objects of each kind processed
+	// simultaneously. Defaults to 10.
+	Concurrency int `json:"concurrency,omitempty"`
+
+	// InfrastructureKinds are the kinds, as Kind.version.group, that can be
+	// adopted as Machines with the machine.crit.sh/adopt annotation.
+	InfrastructureKinds []string `json:"infrastructureKinds,omitempty"`
+}
+
+// OrphanControllerConfiguration configures the orphan scanner.
+type OrphanControllerConfiguration struct {
+	// ScanInterval is the time between scans. Zero disables the scanner.
+	ScanInterval metav1.Duration `json:"scanInterval,omitempty"`
+
+	// GarbageCollect deletes orphans found by the scanner, except Nodes,
+	// once they have been found orphaned for GracePeriod.
+	GarbageCollect bool `json:"garbageCollect,omitempty"`
+
+	// GracePeriod is the minimum time an object must have been found
+	// orphaned, across scans, before it is deleted. Zero deletes orphans
+	// when they are found. Defaults to 1h.
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+}
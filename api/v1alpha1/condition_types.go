@@ -0,0 +1,149 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionType is a valid value for Condition.Type.
+type ConditionType string
+
+const (
+	// PausedCondition reports whether reconciliation of a resource is paused
+	// by the PausedAnnotation.
+	PausedCondition ConditionType = "Paused"
+
+	// PreDrainDeleteHookSucceededCondition reports whether all pre-drain
+	// lifecycle hooks have been removed from a Machine that is being
+	// deleted.
+	PreDrainDeleteHookSucceededCondition ConditionType = "PreDrainDeleteHookSucceeded"
+
+	// PreTerminateDeleteHookSucceededCondition reports whether all
+	// pre-terminate lifecycle hooks have been removed from a Machine that is
+	// being deleted.
+	PreTerminateDeleteHookSucceededCondition ConditionType = "PreTerminateDeleteHookSucceeded"
+
+	// InfrastructureDeletedCondition reports whether the infrastructure
+	// object of a Machine that is being deleted is gone.
+	InfrastructureDeletedCondition ConditionType = "InfrastructureDeleted"
+
+	// NodeDeletedCondition reports whether the Node of a Machine that is
+	// being deleted is gone.
+	NodeDeletedCondition ConditionType = "NodeDeleted"
+
+	// NodeDrainedCondition reports whether the Node of a Machine that is
+	// being deleted has been drained, or the drain has timed out.
+	NodeDrainedCondition ConditionType = "NodeDrained"
+
+	// EtcdMemberRemovedCondition reports whether the etcd member running on
+	// a control plane Machine that is being deleted has been removed from
+	// the etcd cluster.
+	EtcdMemberRemovedCondition ConditionType = "EtcdMemberRemoved"
+
+	// ControlPlaneDeletionAllowedCondition reports whether a control plane
+	// Machine that is being deleted may proceed with its removal.
+	ControlPlaneDeletionAllowedCondition ConditionType = "ControlPlaneDeletionAllowed"
+
+	// MachineClassUpToDateCondition reports whether a Machine was built from
+	// the current generation of its MachineClass.
+	MachineClassUpToDateCondition ConditionType = "MachineClassUpToDate"
+
+	// CertificateExpiringSoonCondition reports whether a kubelet certificate
+	// of the Node of a Machine expires within the configured threshold.
+	CertificateExpiringSoonCondition ConditionType = "CertificateExpiringSoon"
+)
+
+const (
+	// InfrastructurePausedReason is used when reconciliation is paused by
+	// the PausedAnnotation on the referenced infrastructure object.
+	InfrastructurePausedReason = "InfrastructurePaused"
+
+	// WaitingExternalHookReason is used when a deletion stage is blocked by
+	// lifecycle hooks.
+	WaitingExternalHookReason = "WaitingExternalHook"
+
+	// DeletingReason is used while waiting for an object to be deleted.
+	DeletingReason = "Deleting"
+
+	// DeletionTimeoutReason is used when an object has not been deleted in
+	// time and the deletion of the Machine has moved on without it.
+	DeletionTimeoutReason = "DeletionTimeout"
+
+	// DeletionFailedReason is used when deleting an object failed and the
+	// deletion of the Machine has moved on without it.
+	DeletionFailedReason = "DeletionFailed"
+
+	// NodeDrainTimeoutReason is used when the Node of a Machine has not been
+	// drained in time and the deletion of the Machine has moved on.
+	NodeDrainTimeoutReason = "NodeDrainTimeout"
+
+	// EtcdQuorumAtRiskReason is used when removing an etcd member would leave
+	// the etcd cluster without a healthy quorum.
+	EtcdQuorumAtRiskReason = "EtcdQuorumAtRisk"
+
+	// ControlPlaneDeletionInProgressReason is used while another control
+	// plane Machine is being removed.
+	ControlPlaneDeletionInProgressReason = "ControlPlaneDeletionInProgress"
+
+	// ControlPlaneQuorumAtRiskReason is used when removing a control plane
+	// Machine would leave fewer healthy control plane Machines than required.
+	ControlPlaneQuorumAtRiskReason = "ControlPlaneQuorumAtRisk"
+
+	// MachineClassNotFoundReason is used when the MachineClass of a Machine
+	// does not exist.
+	MachineClassNotFoundReason = "MachineClassNotFound"
+
+	// MachineClassOutdatedReason is used when the MachineClass of a Machine
+	// has changed since the Machine was built from it.
+	MachineClassOutdatedReason = "MachineClassOutdated"
+
+	// ServingCertificateExpiringReason is used when the kubelet serving
+	// certificate of a Node expires soon.
+	ServingCertificateExpiringReason = "ServingCertificateExpiring"
+
+	// ClientCertificateExpiringReason is used when the kubelet client
+	// certificate of a Node expires soon.
+	ClientCertificateExpiringReason = "ClientCertificateExpiring"
+)
+
+// Condition defines an observation of the operational state of a resource.
+type Condition struct {
+	// Type of condition in CamelCase.
+	Type ConditionType `json:"type"`
+
+	// Status of the condition, one of True, False, Unknown.
+	Status corev1.ConditionStatus `json:"status"`
+
+	// LastTransitionTime is the last time the condition transitioned from one
+	// status to another.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is the reason for the condition's last transition in CamelCase.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable message indicating details about the
+	// transition.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// Conditions provide observations of the operational state of a resource.
+type Conditions []Condition
@@ -79,6 +79,10 @@ type ConfigStatus struct {
 	// FailureMessage will be set on non-retryable errors
 	// +optional
 	FailureMessage string `json:"failureMessage,omitempty"`
+
+	// Conditions defines the current service state of the Config.
+	// +optional
+	Conditions Conditions `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -104,6 +108,14 @@ type ConfigList struct {
 	Items           []Config `json:"items"`
 }
 
+func (c *Config) GetConditions() Conditions {
+	return c.Status.Conditions
+}
+
+func (c *Config) SetConditions(conditions Conditions) {
+	c.Status.Conditions = conditions
+}
+
 func init() {
 	SchemeBuilder.Register(&Config{}, &ConfigList{})
 }
@@ -0,0 +1,107 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CSRApprovalAction is the action taken on the CSRs a CSRApprovalPolicy
+// applies to.
+// +kubebuilder:validation:Enum=Approve;Deny;Ignore
+type CSRApprovalAction string
+
+const (
+	// CSRApprovalActionApprove approves CSRs that pass validation, with the
+	// SAN rules of the policy.
+	CSRApprovalActionApprove CSRApprovalAction = "Approve"
+
+	// CSRApprovalActionDeny denies CSRs.
+	CSRApprovalActionDeny CSRApprovalAction = "Deny"
+
+	// CSRApprovalActionIgnore leaves CSRs pending, for them to be approved
+	// or denied by someone else.
+	CSRApprovalActionIgnore CSRApprovalAction = "Ignore"
+)
+
+// CIDR is an IP range in CIDR notation, e.g. "10.0.0.0/8".
+// +kubebuilder:validation:Format=cidr
+type CIDR string
+
+// CSRApprovalPolicySpec defines how the node CSRs of the Machines it applies
+// to are approved.
+type CSRApprovalPolicySpec struct {
+	// Order is the position of the policy among all policies, which are
+	// evaluated by ascending order, then name. The first policy that applies
+	// to a CSR decides it, and CSRs no policy applies to are approved once
+	// they pass validation.
+	// +optional
+	Order int32 `json:"order,omitempty"`
+
+	// SignerNames are the signers of the CSRs the policy applies to.
+	// Defaults to all signers of node certificates.
+	// +optional
+	SignerNames []string `json:"signerNames,omitempty"`
+
+	// MachineSelector selects the Machines whose CSRs the policy applies
+	// to. Defaults to all Machines.
+	// +optional
+	MachineSelector *metav1.LabelSelector `json:"machineSelector,omitempty"`
+
+	// Action is the action taken on the CSRs the policy applies to.
+	// Defaults to Approve.
+	// +optional
+	Action CSRApprovalAction `json:"action,omitempty"`
+
+	// AllowedDNSNames are patterns of DNS subject alternative names that are
+	// allowed besides the addresses of the Machine. A "*" label matches any
+	// single label, e.g. "*.nodes.internal".
+	// +optional
+	AllowedDNSNames []string `json:"allowedDNSNames,omitempty"`
+
+	// AllowedIPRanges are CIDRs the IP subject alternative names, which must
+	// be addresses of the Machine, are restricted to. Defaults to any IP.
+	// +optional
+	AllowedIPRanges []CIDR `json:"allowedIPRanges,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Order",type="integer",JSONPath=".spec.order",description="Evaluation order of the policy"
+// +kubebuilder:printcolumn:name="Action",type="string",JSONPath=".spec.action",description="Action taken on CSRs"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// CSRApprovalPolicy is the Schema for the csrapprovalpolicies API
+type CSRApprovalPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CSRApprovalPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CSRApprovalPolicyList contains a list of CSRApprovalPolicy
+type CSRApprovalPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CSRApprovalPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CSRApprovalPolicy{}, &CSRApprovalPolicyList{})
+}
@@ -29,6 +29,11 @@ type InfrastructureProviderSpec struct {
 // InfrastructureProviderSpec defines the desired state of InfrastructureProvider
 type InfrastructureProviderStatus struct {
 	Ready bool `json:"ready"`
+
+	// Conditions defines the current service state of the
+	// InfrastructureProvider.
+	// +optional
+	Conditions Conditions `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -57,6 +62,14 @@ type InfrastructureProviderList struct {
 	Items           []InfrastructureProvider `json:"items"`
 }
 
+func (ip *InfrastructureProvider) GetConditions() Conditions {
+	return ip.Status.Conditions
+}
+
+func (ip *InfrastructureProvider) SetConditions(conditions Conditions) {
+	ip.Status.Conditions = conditions
+}
+
 func init() {
 	SchemeBuilder.Register(&InfrastructureProvider{}, &InfrastructureProviderList{})
 }
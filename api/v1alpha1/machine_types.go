@@ -27,6 +27,56 @@ const (
 
 	MachineControlPlaneLabelName = "node-role.kubernetes.io/master"
 	NodeOwnerLabelName           = "machine.crit.sh/machine"
+
+	// MachineAdoptedLabelName marks Machines that were created for an
+	// existing Node by the Node controller instead of being provisioned by
+	// the machine-api. Adopted Machines are deleted when their Node goes
+	// away.
+	MachineAdoptedLabelName = "machine.crit.sh/adopted"
+
+	// AdoptAnnotation can be set on an existing infrastructure object to
+	// create a Machine for it without provisioning anything. The value
+	// optionally names the Machine, which defaults to the name of the
+	// infrastructure object.
+	AdoptAnnotation = "machine.crit.sh/adopt"
+
+	// MachineNameLabel and MachineNamespaceLabel track the Machine an
+	// infrastructure object in another namespace belongs to, as owner
+	// references cannot cross namespaces.
+	MachineNameLabel      = "machine.crit.sh/machine-name"
+	MachineNamespaceLabel = "machine.crit.sh/machine-namespace"
+
+	// InfrastructureFinalizer keeps an infrastructure object in another
+	// namespace than its Machine from being removed before the Machine
+	// controller has released it.
+	InfrastructureFinalizer = "machine.crit.sh/infrastructure"
+
+	// ClearFailureAnnotation can be set on a Machine to force the controller
+	// to clear its failure, including failures classified as terminal. The
+	// annotation is removed once the failure has been cleared.
+	ClearFailureAnnotation = "machine.crit.sh/clear-failure"
+
+	// NodeOwnedLabelsAnnotation, NodeOwnedAnnotationsAnnotation and
+	// NodeOwnedTaintsAnnotation are set on a Node to track which labels,
+	// annotations and taints (as key:effect) were propagated from
+	// Machine.Spec, so that only those are updated or removed.
+	NodeOwnedLabelsAnnotation      = "machine.crit.sh/owned-labels"
+	NodeOwnedAnnotationsAnnotation = "machine.crit.sh/owned-annotations"
+	NodeOwnedTaintsAnnotation      = "machine.crit.sh/owned-taints"
+
+	// ExcludeNodeDrainingAnnotation can be set on a Machine to skip draining
+	// its Node when the Machine is deleted.
+	ExcludeNodeDrainingAnnotation = "machine.crit.sh/exclude-node-draining"
+
+	// PreDrainDeleteHookAnnotationPrefix and
+	// PreTerminateDeleteHookAnnotationPrefix are the prefixes of lifecycle
+	// hook annotations, such as
+	// "pre-drain.delete.hook.machine.crit.sh/<owner>". The deletion of a
+	// Machine waits before draining its Node, or before deleting its
+	// infrastructure, until all hooks of that stage have been removed by
+	// their owners.
+	PreDrainDeleteHookAnnotationPrefix     = "pre-drain.delete.hook.machine.crit.sh"
+	PreTerminateDeleteHookAnnotationPrefix = "pre-terminate.delete.hook.machine.crit.sh"
 )
 
 // MachineAddressType describes a valid MachineAddress type.
@@ -55,21 +105,54 @@ type MachineAddresses []MachineAddress
 type MachinePhase string
 
 const (
+	// MachinePending is the first phase of a Machine, before its
+	// infrastructure object exists.
 	MachinePending MachinePhase = "Pending"
 
+	// MachineProvisioning means the infrastructure object exists but is not
+	// ready yet.
 	MachineProvisioning MachinePhase = "Provisioning"
 
+	// MachineProvisioned means the infrastructure is ready and the Machine is
+	// waiting for its Node to join and become Ready.
+	MachineProvisioned MachinePhase = "Provisioned"
+
+	// MachineRunning means the Machine is linked to a Node that is Ready.
 	MachineRunning MachinePhase = "Running"
 
+	// MachineTerminating means the Machine is being deleted.
 	MachineTerminating MachinePhase = "Terminating"
 
+	// MachineUnknown means the Node linked to the Machine has stopped
+	// reporting its status, or has gone away.
 	MachineUnknown MachinePhase = "Unknown"
 
+	// MachineFailed means a terminal problem has been reported for the
+	// Machine in Status.FailureReason or Status.FailureMessage.
 	MachineFailed MachinePhase = "Failed"
 )
 
+// MachineFailureSource describes what reported the failure of a Machine.
+type MachineFailureSource string
+
+const (
+	// MachineFailureSourceInfrastructure means the failure was reported by,
+	// or is about, the infrastructure object of the Machine.
+	MachineFailureSourceInfrastructure MachineFailureSource = "Infrastructure"
+
+	// MachineFailureSourceConfig means the failure was reported by the Config
+	// referenced by the Machine.
+	MachineFailureSourceConfig MachineFailureSource = "Config"
+)
+
 // MachineSpec defines the desired state of Machine
 type MachineSpec struct {
+	// MachineClassName is the name of a MachineClass in the namespace of the
+	// Machine, whose defaults are filled into the unset fields of the Machine
+	// before it is provisioned.
+	// +optional
+	MachineClassName string `json:"machineClassName,omitempty"`
+
 	// ConfigRef is a reference to the ConfigMap containing the crit
 	// configuration used for this machine.
 	ConfigRef corev1.ObjectReference `json:"configRef,omitempty"`
@@ -79,6 +162,15 @@ type MachineSpec struct {
 	// +optional
 	InfrastructureRef *corev1.ObjectReference `json:"infrastructureRef,omitempty"`
 
+	// InfrastructureTemplateRef is a reference to an infrastructure template.
+	// When InfrastructureRef is empty, the spec.template of the template is
+	// cloned into a new infrastructure object named after the Machine, which
+	// InfrastructureRef is then set to. The object is created in the namespace
+	// of the template; outside of the Machine namespace its name is prefixed
+	// with the Machine namespace.
+	// +optional
+	InfrastructureTemplateRef *corev1.ObjectReference `json:"infrastructureTemplateRef,omitempty"`
+
 	// +optional
 	ProviderID *string `json:"providerID,omitempty"`
 
@@ -86,6 +178,71 @@ type MachineSpec struct {
 	// Must match a key in the FailureDomains map stored on the cluster object.
 	// +optional
 	FailureDomain *string `json:"failureDomain,omitempty"`
+
+	// NodeLabels are labels that are kept reconciled onto the Node linked to
+	// this Machine.
+	// +optional
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+
+	// NodeAnnotations are annotations that are kept reconciled onto the Node
+	// linked to this Machine.
+	// +optional
+	NodeAnnotations map[string]string `json:"nodeAnnotations,omitempty"`
+
+	// NodeTaints are taints that are kept reconciled onto the Node linked to
+	// this Machine.
+	// +optional
+	NodeTaints []corev1.Taint `json:"nodeTaints,omitempty"`
+
+	// Drain configures how the Node linked to this Machine is drained before
+	// the Machine is deleted.
+	// +optional
+	Drain *DrainSpec `json:"drain,omitempty"`
+
+	// NodeDrainTimeout is the total amount of time spent draining the Node
+	// before the deletion of the Machine moves on without it. Defaults to
+	// waiting forever.
+	// +optional
+	NodeDrainTimeout *metav1.Duration `json:"nodeDrainTimeout,omitempty"`
+}
+
+// DrainSpec configures how the Node linked to a Machine is drained.
+type DrainSpec struct {
+	// Timeout is the amount of time a single drain attempt waits for pods to
+	// be evicted or deleted before retrying. Defaults to 20s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// GracePeriodSeconds is the period of time given to each pod to
+	// terminate gracefully. If negative, the grace period specified in the
+	// pod is used. Defaults to -1.
+	// +optional
+	GracePeriodSeconds *int `json:"gracePeriodSeconds,omitempty"`
+
+	// Force allows pods that are not managed by a controller to be deleted.
+	// Defaults to true.
+	// +optional
+	Force *bool `json:"force,omitempty"`
+
+	// DeleteEmptyDirData allows pods using emptyDir volumes to be deleted,
+	// losing the data in those volumes. Defaults to true.
+	// +optional
+	DeleteEmptyDirData *bool `json:"deleteEmptyDirData,omitempty"`
+
+	// DisableEviction deletes pods instead of evicting them, bypassing
+	// PodDisruptionBudgets.
+	// +optional
+	DisableEviction bool `json:"disableEviction,omitempty"`
+
+	// SkipPodSelector selects pods that are left running on the Node.
+	// +optional
+	SkipPodSelector *metav1.LabelSelector `json:"skipPodSelector,omitempty"`
+
+	// SkipWaitForDeleteTimeoutSeconds ignores pods that have been
+	// terminating for longer than this number of seconds, such as pods on a
+	// Node that is not ready. Defaults to waiting for all pods.
+	// +optional
+	SkipWaitForDeleteTimeoutSeconds int `json:"skipWaitForDeleteTimeoutSeconds,omitempty"`
 }
 
 // MachineStatus defines the observed state of Machine
@@ -143,15 +300,21 @@ type MachineStatus struct {
 	// +optional
 	FailureMessage *string `json:"failureMessage,omitempty"`
 
+	// FailureSource describes what reported the FailureReason and
+	// FailureMessage. Failures that are not terminal are cleared
+	// automatically once their source stops reporting them.
+	// +optional
+	FailureSource MachineFailureSource `json:"failureSource,omitempty"`
+
 	// Addresses is a list of addresses assigned to the machine.
 	// This field is copied from the infrastructure provider reference.
 	// +optional
 	//Addresses MachineAddresses `json:"addresses,omitempty"`
 
 	// Phase represents the current phase of machine actuation.
-	// E.g. Pending, Running, Terminating, Failed etc.
+	// E.g. Pending, Provisioning, Provisioned, Running, Unknown, Terminating,
+	// Failed etc.
 	// +optional
-	//Phase string `json:"phase,omitempty"`
 	Phase MachinePhase `json:"phase,omitempty"`
 
 	// Addresses is a list of addresses assigned to the machine.
@@ -162,17 +325,55 @@ type MachineStatus struct {
 	// InfrastructureReady is the state of the infrastructure provider.
 	// +optional
 	InfrastructureReady bool `json:"infrastructureReady"`
+
+	// NodeDrainStartTime is the time draining the Node started during the
+	// deletion of the Machine.
+	// +optional
+	NodeDrainStartTime *metav1.Time `json:"nodeDrainStartTime,omitempty"`
+
+	// MachineClassGeneration is the generation of the MachineClass the
+	// Machine was built from.
+	// +optional
+	MachineClassGeneration int64 `json:"machineClassGeneration,omitempty"`
+
+	// NodeCertificates are the expiry times of the kubelet certificates
+	// issued to the Node of the Machine.
+	// +optional
+	NodeCertificates *NodeCertificatesStatus `json:"nodeCertificates,omitempty"`
+
+	// Conditions defines the current service state of the Machine.
+	// +optional
+	Conditions Conditions `json:"conditions,omitempty"`
+}
+
+// NodeCertificatesStatus reports the expiry times of the latest kubelet
+// certificates issued to a Node, as observed on the approved CSRs.
+type NodeCertificatesStatus struct {
+	// ServingNotAfter is the time the kubelet serving certificate expires.
+	// +optional
+	ServingNotAfter *metav1.Time `json:"servingNotAfter,omitempty"`
+
+	// ClientNotAfter is the time the kubelet client certificate expires.
+	// +optional
+	ClientNotAfter *metav1.Time `json:"clientNotAfter,omitempty"`
 }
 
 func (m *MachineStatus) SetVersion(version string) {
 	m.Version = &version
 }
 
-func (m *MachineStatus) SetFailure(err mapierrors.MachineStatusError, msg string) {
+func (m *MachineStatus) SetFailure(source MachineFailureSource, err mapierrors.MachineStatusError, msg string) {
+	m.FailureSource = source
 	m.FailureReason = &err
 	m.FailureMessage = &msg
 }
 
+func (m *MachineStatus) ClearFailure() {
+	m.FailureSource = ""
+	m.FailureReason = nil
+	m.FailureMessage = nil
+}
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:storageversion
@@ -200,6 +401,14 @@ type MachineList struct {
 	Items           []Machine `json:"items"`
 }
 
+func (m *Machine) GetConditions() Conditions {
+	return m.Status.Conditions
+}
+
+func (m *Machine) SetConditions(conditions Conditions) {
+	m.Status.Conditions = conditions
+}
+
 func init() {
 	SchemeBuilder.Register(&Machine{}, &MachineList{})
 }
@@ -0,0 +1,85 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MachineClassSpec defines the defaults of the Machines of a MachineClass.
+// Fields that are set on a Machine win over those of its MachineClass.
+type MachineClassSpec struct {
+	// ConfigRef is a reference to the Config used for Machines of this
+	// class. The Config is referenced as is and shared by those Machines;
+	// there is no Config template kind to clone a Config per Machine from.
+	// +optional
+	ConfigRef *corev1.ObjectReference `json:"configRef,omitempty"`
+
+	// InfrastructureTemplateRef is a reference to the infrastructure template
+	// cloned for Machines of this class.
+	// +optional
+	InfrastructureTemplateRef *corev1.ObjectReference `json:"infrastructureTemplateRef,omitempty"`
+
+	// NodeLabels are added to the NodeLabels of Machines of this class.
+	// +optional
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+
+	// NodeAnnotations are added to the NodeAnnotations of Machines of this
+	// class.
+	// +optional
+	NodeAnnotations map[string]string `json:"nodeAnnotations,omitempty"`
+
+	// NodeTaints are added to the NodeTaints of Machines of this class,
+	// unless the Machine has a taint with the same key and effect.
+	// +optional
+	NodeTaints []corev1.Taint `json:"nodeTaints,omitempty"`
+
+	// Drain is the Drain of Machines of this class.
+	// +optional
+	Drain *DrainSpec `json:"drain,omitempty"`
+
+	// NodeDrainTimeout is the NodeDrainTimeout of Machines of this class.
+	// +optional
+	NodeDrainTimeout *metav1.Duration `json:"nodeDrainTimeout,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Config",type="string",JSONPath=".spec.configRef.name",description="Config of the class"
+// +kubebuilder:printcolumn:name="Template",type="string",JSONPath=".spec.infrastructureTemplateRef.name",description="Infrastructure template of the class"
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MachineClass is the Schema for the machineclasses API
+type MachineClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec MachineClassSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MachineClassList contains a list of MachineClass
+type MachineClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MachineClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MachineClass{}, &MachineClassList{})
+}
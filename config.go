@@ -0,0 +1,216 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	uberzap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	configv1alpha1 "github.com/criticalstack/machine-api/api/config/v1alpha1"
+)
+
+// bindFlags binds the flags of the manager to the fields of the
+// configuration, with the current values as defaults.
+func bindFlags(fs *flag.FlagSet, cfg *configv1alpha1.MachineAPIManagerConfiguration) {
+	c := &cfg.Controllers
+	fs.StringVar(&cfg.MetricsBindAddress, "metrics-addr", cfg.MetricsBindAddress,
+		"The address the metric endpoint binds to.")
+	fs.StringVar(&cfg.HealthProbeBindAddress, "health-probe-bind-address", cfg.HealthProbeBindAddress,
+		"The address the liveness (/healthz) and readiness (/readyz) probe endpoints bind to.")
+	fs.Var((*stringSliceValue)(&cfg.WatchNamespaces), "watch-namespaces",
+		"Comma-separated namespaces the manager is restricted to, all namespaces are watched if not set")
+	fs.BoolVar(&cfg.Webhook.Enabled, "enable-webhooks", cfg.Webhook.Enabled,
+		"Serve webhooks and require the webhook server to be serving for readiness")
+	fs.BoolVar(&cfg.LeaderElection.Enabled, "enable-leader-election", cfg.LeaderElection.Enabled,
+		"Enable leader election for controller manager. "+
+			"Enabling this will ensure there is only one active controller manager.")
+	fs.StringVar(&cfg.Logging.Format, "log-format", cfg.Logging.Format,
+		"Format of the logs, text or json")
+	fs.IntVar(&cfg.Logging.Level, "log-level", cfg.Logging.Level,
+		"Verbosity of the logs, 0 only logs informational messages and errors")
+	fs.IntVar(&c.Config.Concurrency, "config-concurrency", c.Config.Concurrency,
+		"Number of configs to process simultaneously")
+	fs.IntVar(&c.Machine.Concurrency, "machine-concurrency", c.Machine.Concurrency,
+		"Number of machines to process simultaneously")
+	fs.IntVar(&c.Node.Concurrency, "node-concurrency", c.Node.Concurrency,
+		"Number of nodes to process simultaneously")
+	fs.IntVar(&c.CSRApprover.Concurrency, "csrapprover-concurrency", c.CSRApprover.Concurrency,
+		"Number of csrs to process simultaneously")
+	fs.BoolVar(&c.CSRApprover.DenyInvalid, "csrapprover-deny-invalid", c.CSRApprover.DenyInvalid,
+		"Deny node CSRs that cannot be approved, instead of leaving them pending")
+	fs.IntVar(&c.InfrastructureProvider.Concurrency, "infraprovider-concurrency", c.InfrastructureProvider.Concurrency,
+		"Number of infraproviders to process simultaneously")
+	fs.DurationVar(&c.ExternalReadyWait.Duration, "external-ready-wait", c.ExternalReadyWait.Duration,
+		"Amount of time to wait between polls for external resources to be ready")
+	fs.DurationVar(&c.Machine.InfrastructureDeleteTimeout.Duration, "infrastructure-delete-timeout", c.Machine.InfrastructureDeleteTimeout.Duration,
+		"Amount of time to wait for the infrastructure of a deleted machine to be gone before moving on, 0 waits forever")
+	fs.StringVar(&c.Machine.EtcdClientSecret, "etcd-client-secret", c.Machine.EtcdClientSecret,
+		"Namespace/name of the Secret holding the etcd client certificates (ca.crt, tls.crt, tls.key) used to remove "+
+			"the etcd member of deleted control plane machines, member removal is disabled if not set")
+	fs.Var((*stringSliceValue)(&c.Machine.EtcdEndpoints), "etcd-endpoints",
+		"Comma-separated etcd client URLs, defaults to the InternalIPs of the control plane nodes")
+	fs.IntVar(&c.Machine.MinControlPlaneMachines, "min-control-plane-machines", c.Machine.MinControlPlaneMachines,
+		"Minimum number of healthy control plane machines that must remain when a control plane machine is deleted, 0 disables the check")
+	fs.Var((*stringSliceValue)(&c.Machine.AllowedInfrastructureNamespaces), "allowed-infrastructure-namespaces",
+		"Comma-separated namespaces, besides their own, that machines may reference infrastructure objects in")
+	fs.DurationVar(&c.Machine.CertificateExpiryThreshold.Duration, "certificate-expiry-threshold", c.Machine.CertificateExpiryThreshold.Duration,
+		"Time before the expiry of a kubelet certificate that the CertificateExpiringSoon condition of its machine is raised, 0 disables the condition")
+	fs.DurationVar(&c.Machine.Drain.Timeout.Duration, "drain-timeout", c.Machine.Drain.Timeout.Duration,
+		"Time to wait for the pods of a node to be evicted before retrying, for machines that do not set it")
+	fs.DurationVar(&c.Machine.Drain.NodeDrainTimeout.Duration, "node-drain-timeout", c.Machine.Drain.NodeDrainTimeout.Duration,
+		"Total time draining a node may take before it is deleted anyway, for machines that do not set it, 0 waits forever")
+	fs.DurationVar(&c.Machine.Requeue.DeleteHooks.Duration, "delete-hook-requeue", c.Machine.Requeue.DeleteHooks.Duration,
+		"Time between checks of the lifecycle hooks blocking the deletion of a machine, 0 uses --external-ready-wait")
+	fs.DurationVar(&c.Machine.Requeue.ControlPlaneDeletion.Duration, "control-plane-deletion-requeue", c.Machine.Requeue.ControlPlaneDeletion.Duration,
+		"Time between attempts to acquire the control plane deletion lease and checks of the healthy control plane machines, 0 uses --external-ready-wait")
+	fs.DurationVar(&c.Machine.Requeue.EtcdMemberRemoval.Duration, "etcd-member-removal-requeue", c.Machine.Requeue.EtcdMemberRemoval.Duration,
+		"Time between checks of the etcd quorum before removing the etcd member of a control plane machine, 0 uses --external-ready-wait")
+	fs.DurationVar(&c.Machine.Requeue.InfrastructureDeletion.Duration, "infrastructure-deletion-requeue", c.Machine.Requeue.InfrastructureDeletion.Duration,
+		"Time between checks of the infrastructure of a deleted machine being gone, 0 uses --external-ready-wait")
+	fs.Var(boolPtrValue{&c.Node.Enabled}, "enable-node-adoption",
+		"Create Machines for nodes that were not provisioned by the machine-api")
+	fs.StringVar(&c.Node.Namespace, "node-adoption-namespace", c.Node.Namespace,
+		"Namespace adopted Machines are created in")
+	fs.DurationVar(&c.Node.AdoptionDelay.Duration, "node-adoption-delay", c.Node.AdoptionDelay.Duration,
+		"Minimum age of a node before it is adopted")
+	fs.Var((*stringSliceValue)(&c.Adoption.InfrastructureKinds), "adopt-infrastructure-kinds",
+		"Comma-separated infrastructure kinds, as Kind.version.group (e.g. DockerMachine.v1alpha1.infrastructure.crit.sh), "+
+			"that can be adopted as Machines with the machine.crit.sh/adopt annotation")
+	fs.DurationVar(&c.Orphan.ScanInterval.Duration, "orphan-scan-interval", c.Orphan.ScanInterval.Duration,
+		"Interval between scans for orphaned nodes, machines, configs, config secrets and infrastructure objects, 0 disables the scanner")
+	fs.BoolVar(&c.Orphan.GarbageCollect, "orphan-gc", c.Orphan.GarbageCollect,
+		"Delete orphans found by the scanner, except nodes, once they have been orphaned for --orphan-gc-grace-period")
+	fs.DurationVar(&c.Orphan.GracePeriod.Duration, "orphan-gc-grace-period", c.Orphan.GracePeriod.Duration,
+		"Minimum time an object must have been found orphaned before it is deleted")
+}
+
+// loadConfig loads the configuration file, then overrides its values with
+// the flags set on the command line.
+func loadConfig(path string, set *flag.FlagSet) (*configv1alpha1.MachineAPIManagerConfiguration, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read config file")
+	}
+	cfg, err := configv1alpha1.Decode(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot decode config file %q", path)
+	}
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	bindFlags(fs, cfg)
+	set.Visit(func(f *flag.Flag) {
+		if err != nil || fs.Lookup(f.Name) == nil {
+			return
+		}
+		err = fs.Set(f.Name, f.Value.String())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// validateWatchNamespaces checks that the namespaces the controllers read
+// objects from or create objects in are watched, when the manager is
+// restricted to some namespaces.
+func validateWatchNamespaces(cfg *configv1alpha1.MachineAPIManagerConfiguration) error {
+	if len(cfg.WatchNamespaces) == 0 {
+		return nil
+	}
+	watched := sets.NewString(cfg.WatchNamespaces...)
+	c := cfg.Controllers
+	if c.Node.IsEnabled() && !watched.Has(c.Node.Namespace) {
+		return errors.Errorf("node adoption namespace %q is not watched", c.Node.Namespace)
+	}
+	if c.Machine.IsEnabled() && c.Machine.EtcdClientSecret != "" {
+		ns := strings.SplitN(c.Machine.EtcdClientSecret, "/", 2)[0]
+		if !watched.Has(ns) {
+			return errors.Errorf("namespace %q of the etcd client secret is not watched", ns)
+		}
+	}
+	// Infrastructure objects in namespaces that are not watched would not be
+	// seen by the Machine controller, and be reported as orphans.
+	for _, ns := range c.Machine.AllowedInfrastructureNamespaces {
+		if !watched.Has(ns) {
+			return errors.Errorf("allowed infrastructure namespace %q is not watched", ns)
+		}
+	}
+	return nil
+}
+
+// newLogger returns the logger for the logging configuration.
+func newLogger(cfg configv1alpha1.LoggingConfiguration) (logr.Logger, error) {
+	level := uberzap.NewAtomicLevelAt(zapcore.Level(-cfg.Level))
+	var encoder zapcore.Encoder
+	switch cfg.Format {
+	case configv1alpha1.TextLogFormat:
+		encoder = zapcore.NewConsoleEncoder(uberzap.NewDevelopmentEncoderConfig())
+	case configv1alpha1.JSONLogFormat:
+		encoder = zapcore.NewJSONEncoder(uberzap.NewProductionEncoderConfig())
+	default:
+		return nil, errors.Errorf("invalid log format %q, expected %s or %s", cfg.Format, configv1alpha1.TextLogFormat, configv1alpha1.JSONLogFormat)
+	}
+	return zap.New(zap.Encoder(encoder), zap.Level(&level)), nil
+}
+
+// stringSliceValue is a flag.Value for comma-separated lists.
+type stringSliceValue []string
+
+func (s *stringSliceValue) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceValue) Set(value string) error {
+	*s = nil
+	if value != "" {
+		*s = strings.Split(value, ",")
+	}
+	return nil
+}
+
+// boolPtrValue is a flag.Value for optional booleans.
+type boolPtrValue struct {
+	value **bool
+}
+
+func (b boolPtrValue) String() string {
+	if b.value == nil || *b.value == nil {
+		return ""
+	}
+	return strconv.FormatBool(**b.value)
+}
+
+func (b boolPtrValue) Set(value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*b.value = &v
+	return nil
+}
+
+func (b boolPtrValue) IsBoolFlag() bool {
+	return true
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	configv1alpha1 "github.com/criticalstack/machine-api/api/config/v1alpha1"
+)
+
+func TestLoadConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := ioutil.TempDir("", "machine-api-config")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	g.Expect(ioutil.WriteFile(path, []byte(`
+apiVersion: config.machine.crit.sh/v1alpha1
+kind: MachineAPIManagerConfiguration
+leaderElection:
+  enabled: true
+controllers:
+  externalReadyWait: 10s
+  machine:
+    concurrency: 20
+    etcdEndpoints:
+    - https://10.0.0.1:2379
+    requeue:
+      deleteHooks: 5s
+      etcdMemberRemoval: 1m
+  node:
+    enabled: true
+    namespace: nodes
+`), 0600)).To(Succeed())
+
+	cfg := &configv1alpha1.MachineAPIManagerConfiguration{}
+	configv1alpha1.SetDefaults_MachineAPIManagerConfiguration(cfg)
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	bindFlags(fs, cfg)
+	g.Expect(fs.Parse([]string{
+		"--machine-concurrency=5",
+		"--enable-node-adoption=false",
+		"--etcd-endpoints=https://10.0.0.2:2379,https://10.0.0.3:2379",
+		"--etcd-member-removal-requeue=2m",
+	})).To(Succeed())
+
+	loaded, err := loadConfig(path, fs)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(loaded.LeaderElection.Enabled).To(BeTrue())
+	g.Expect(loaded.Controllers.ExternalReadyWait.Duration).To(Equal(10 * time.Second))
+	g.Expect(loaded.Controllers.Node.Namespace).To(Equal("nodes"))
+	g.Expect(loaded.Controllers.Machine.Requeue.DeleteHooks.Duration).To(Equal(5 * time.Second))
+
+	// Flags set on the command line override the file.
+	g.Expect(loaded.Controllers.Machine.Concurrency).To(Equal(5))
+	g.Expect(loaded.Controllers.Node.IsEnabled()).To(BeFalse())
+	g.Expect(loaded.Controllers.Machine.EtcdEndpoints).To(Equal([]string{"https://10.0.0.2:2379", "https://10.0.0.3:2379"}))
+	g.Expect(loaded.Controllers.Machine.Requeue.EtcdMemberRemoval.Duration).To(Equal(2 * time.Minute))
+}
+
+func TestNewLogger(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := newLogger(configv1alpha1.LoggingConfiguration{Format: configv1alpha1.JSONLogFormat, Level: 2})
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = newLogger(configv1alpha1.LoggingConfiguration{Format: "xml"})
+	g.Expect(err).To(MatchError(ContainSubstring(`invalid log format "xml"`)))
+}
+
+func TestValidateWatchNamespaces(t *testing.T) {
+	g := NewWithT(t)
+
+	cfg := &configv1alpha1.MachineAPIManagerConfiguration{}
+	configv1alpha1.SetDefaults_MachineAPIManagerConfiguration(cfg)
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	bindFlags(fs, cfg)
+	g.Expect(fs.Parse([]string{
+		"--watch-namespaces=tenant-a,tenant-b",
+		"--etcd-client-secret=kube-system/etcd-client",
+	})).To(Succeed())
+	g.Expect(cfg.WatchNamespaces).To(Equal([]string{"tenant-a", "tenant-b"}))
+	g.Expect(validateWatchNamespaces(cfg)).To(MatchError(`namespace "kube-system" of the etcd client secret is not watched`))
+
+	g.Expect(fs.Parse([]string{
+		"--etcd-client-secret=tenant-a/etcd-client",
+		"--enable-node-adoption",
+	})).To(Succeed())
+	g.Expect(validateWatchNamespaces(cfg)).To(MatchError(`node adoption namespace "kube-system" is not watched`))
+
+	g.Expect(fs.Parse([]string{
+		"--node-adoption-namespace=tenant-b",
+		"--allowed-infrastructure-namespaces=infra",
+	})).To(Succeed())
+	g.Expect(validateWatchNamespaces(cfg)).To(MatchError(`allowed infrastructure namespace "infra" is not watched`))
+
+	g.Expect(fs.Parse([]string{"--watch-namespaces=tenant-a,tenant-b,infra"})).To(Succeed())
+	g.Expect(validateWatchNamespaces(cfg)).To(Succeed())
+
+	cfg.WatchNamespaces = nil
+	cfg.Controllers.Node.Namespace = "kube-system"
+	g.Expect(validateWatchNamespaces(cfg)).To(Succeed())
+}
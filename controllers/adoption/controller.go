@@ -0,0 +1,153 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adoption
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	"github.com/criticalstack/machine-api/util"
+	"github.com/criticalstack/machine-api/util/external"
+)
+
+// InfrastructureAdoptionReconciler creates Machines for existing
+// infrastructure objects of a single kind that carry the AdoptAnnotation.
+// The Machine only references the infrastructure object, which is claimed by
+// the Machine controller like any other, so nothing is ever provisioned.
+type InfrastructureAdoptionReconciler struct {
+	client.Client
+	Log logr.Logger
+
+	// GroupVersionKind is the kind of infrastructure objects adopted.
+	GroupVersionKind schema.GroupVersionKind
+
+	recorder record.EventRecorder
+}
+
+func (r *InfrastructureAdoptionReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(r.GroupVersionKind)
+	r.recorder = mgr.GetEventRecorderFor("machine-adoption-controller")
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("adopt-" + strings.ToLower(r.GroupVersionKind.Kind)).
+		For(u).
+		WithOptions(options).
+		Complete(r)
+}
+
+// +kubebuilder:rbac:groups=machine.crit.sh,resources=machines,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=infrastructure.crit.sh,resources=*,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+
+func (r *InfrastructureAdoptionReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("kind", r.GroupVersionKind.Kind, "name", req.Name, "namespace", req.Namespace)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(r.GroupVersionKind)
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	machineName, ok := obj.GetAnnotations()[machinev1.AdoptAnnotation]
+	if !ok || !obj.GetDeletionTimestamp().IsZero() || util.IsPaused(obj) {
+		return ctrl.Result{}, nil
+	}
+	if machineName == "" {
+		machineName = obj.GetName()
+	}
+
+	// Objects that are already controlled by a Machine were adopted, or
+	// created by the machine-api in the first place.
+	if _, ok := obj.GetLabels()[machinev1.MachineNameLabel]; ok {
+		return ctrl.Result{}, nil
+	}
+	if owner := metav1.GetControllerOf(obj); owner != nil {
+		if owner.Kind != "Machine" || owner.APIVersion != machinev1.GroupVersion.String() {
+			log.Info("Not adopting infrastructure controlled by another object", "owner", owner.Kind+"/"+owner.Name)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	var providerID string
+	if err := util.UnstructuredUnmarshalField(obj, &providerID, "spec", "providerID"); err != nil && err != util.ErrUnstructuredFieldNotFound {
+		return ctrl.Result{}, err
+	}
+	if providerID == "" {
+		log.Info("Not adopting infrastructure without a Spec.ProviderID")
+		r.recorder.Eventf(obj, corev1.EventTypeWarning, "FailedAdopt", "cannot adopt %v %q without a Spec.ProviderID", obj.GetKind(), obj.GetName())
+		return ctrl.Result{}, nil
+	}
+
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      machineName,
+			Namespace: obj.GetNamespace(),
+		},
+		Spec: machinev1.MachineSpec{
+			InfrastructureRef: external.GetObjectReference(obj),
+			ProviderID:        pointer.StringPtr(providerID),
+		},
+	}
+
+	// The existing Node is linked by the Machine controller through the
+	// ProviderID, only its role is carried over here.
+	nodes := &corev1.NodeList{}
+	if err := r.List(ctx, nodes); err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, n := range nodes.Items {
+		if n.Spec.ProviderID != providerID {
+			continue
+		}
+		if v, ok := n.Labels[machinev1.MachineControlPlaneLabelName]; ok {
+			m.Labels = map[string]string{machinev1.MachineControlPlaneLabelName: v}
+		}
+		break
+	}
+
+	if err := r.Create(ctx, m); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return ctrl.Result{}, err
+		}
+		existing := &machinev1.Machine{}
+		if err := r.Get(ctx, client.ObjectKey{Name: m.Name, Namespace: m.Namespace}, existing); err != nil {
+			return ctrl.Result{}, err
+		}
+		if ref := existing.Spec.InfrastructureRef; ref == nil || ref.Kind != obj.GetKind() || ref.Name != obj.GetName() {
+			r.recorder.Eventf(obj, corev1.EventTypeWarning, "FailedAdopt", "cannot adopt %v %q, Machine %q already exists", obj.GetKind(), obj.GetName(), m.Name)
+			return ctrl.Result{}, errors.Errorf("cannot adopt %v %q, machine %q already exists in namespace %q", obj.GetKind(), obj.GetName(), m.Name, m.Namespace)
+		}
+		return ctrl.Result{}, nil
+	}
+	log.Info("Adopted infrastructure", "machine", m.Name)
+	r.recorder.Eventf(obj, corev1.EventTypeNormal, "SuccessfulAdopt", "created Machine %q", m.Name)
+	return ctrl.Result{}, nil
+}
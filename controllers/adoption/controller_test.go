@@ -0,0 +1,144 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adoption
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+var dockerMachineGVK = schema.GroupVersionKind{Group: "infrastructure.crit.sh", Version: "v1alpha1", Kind: "DockerMachine"}
+
+func newDockerMachine(name string, annotations map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(dockerMachineGVK)
+	obj.SetName(name)
+	obj.SetNamespace("default")
+	obj.SetUID(types.UID("uid-" + name))
+	obj.SetAnnotations(annotations)
+	_ = unstructured.SetNestedField(obj.Object, "docker:///"+name, "spec", "providerID")
+	return obj
+}
+
+func TestReconcile(t *testing.T) {
+	adopt := map[string]string{machinev1.AdoptAnnotation: ""}
+	owned := newDockerMachine("owned", adopt)
+	owned.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: "example.com/v1",
+		Kind:       "Other",
+		Name:       "other",
+		UID:        "uid-other",
+		Controller: pointer.BoolPtr(true),
+	}})
+
+	testCases := []struct {
+		name          string
+		obj           *unstructured.Unstructured
+		expectMachine string
+	}{
+		{
+			name:          "adopts annotated infrastructure",
+			obj:           newDockerMachine("worker", adopt),
+			expectMachine: "worker",
+		},
+		{
+			name:          "names the machine after the annotation",
+			obj:           newDockerMachine("worker", map[string]string{machinev1.AdoptAnnotation: "imported"}),
+			expectMachine: "imported",
+		},
+		{
+			name: "ignores infrastructure without annotation",
+			obj:  newDockerMachine("worker", nil),
+		},
+		{
+			name: "ignores infrastructure controlled by another object",
+			obj:  owned,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+			_ = machinev1.AddToScheme(scheme)
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "node",
+					Labels: map[string]string{machinev1.MachineControlPlaneLabelName: ""},
+				},
+				Spec: corev1.NodeSpec{ProviderID: "docker:///worker"},
+			}
+			c := fake.NewFakeClientWithScheme(scheme, tc.obj, node)
+			r := &InfrastructureAdoptionReconciler{
+				Client:           c,
+				Log:              log.NullLogger{},
+				GroupVersionKind: dockerMachineGVK,
+				recorder:         record.NewFakeRecorder(10),
+			}
+
+			key := client.ObjectKey{Name: tc.obj.GetName(), Namespace: tc.obj.GetNamespace()}
+			_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			machines := &machinev1.MachineList{}
+			g.Expect(c.List(context.Background(), machines)).To(Succeed())
+			if tc.expectMachine == "" {
+				g.Expect(machines.Items).To(BeEmpty())
+				return
+			}
+			g.Expect(machines.Items).To(HaveLen(1))
+			m := machines.Items[0]
+			g.Expect(m.Name).To(Equal(tc.expectMachine))
+			g.Expect(m.Spec.InfrastructureRef).To(Equal(&corev1.ObjectReference{
+				APIVersion: dockerMachineGVK.GroupVersion().String(),
+				Kind:       "DockerMachine",
+				Name:       "worker",
+				Namespace:  "default",
+				UID:        "uid-worker",
+			}))
+			g.Expect(*m.Spec.ProviderID).To(Equal("docker:///worker"))
+			g.Expect(m.Spec.ConfigRef.Name).To(BeEmpty())
+			g.Expect(m.Labels).To(HaveKey(machinev1.MachineControlPlaneLabelName))
+
+			// Reconciling again leaves the Machine alone.
+			_, err = r.Reconcile(ctrl.Request{NamespacedName: key})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(c.List(context.Background(), machines)).To(Succeed())
+			g.Expect(machines.Items).To(HaveLen(1))
+		})
+	}
+}
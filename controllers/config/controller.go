@@ -19,11 +19,11 @@ package config
 import (
 	"context"
 	"encoding/base64"
+	"fmt"
 
 	configutil "github.com/criticalstack/crit/pkg/config/util"
 	critv1 "github.com/criticalstack/crit/pkg/config/v1alpha2"
 	"github.com/go-logr/logr"
-	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -36,7 +36,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util"
 	"github.com/criticalstack/machine-api/util/cloudinit"
+	"github.com/criticalstack/machine-api/util/conditions"
 )
 
 // ConfigReconciler reconciles a Config object
@@ -69,6 +72,22 @@ func (r *ConfigReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		return ctrl.Result{}, err
 	}
 
+	// Skip reconciliation while the Config is paused, only reporting it.
+	if util.IsPaused(cfg) {
+		log.Info("Reconciliation is paused for this object")
+		if conditions.IsTrue(cfg, machinev1.PausedCondition) {
+			return ctrl.Result{}, nil
+		}
+		conditions.MarkTrue(cfg, machinev1.PausedCondition)
+		return ctrl.Result{}, r.Status().Update(ctx, cfg)
+	}
+	if conditions.Get(cfg, machinev1.PausedCondition) != nil {
+		conditions.Delete(cfg, machinev1.PausedCondition)
+		if err := r.Status().Update(ctx, cfg); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	if cfg.Status.Ready {
 		return ctrl.Result{}, nil
 	}
@@ -76,7 +95,7 @@ func (r *ConfigReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	// validate the Config
 	obj, err := configutil.Unmarshal([]byte(cfg.Spec.Config))
 	if err != nil {
-		return ctrl.Result{}, err
+		return ctrl.Result{}, r.setFailure(ctx, cfg, mapierrors.InvalidConfigMachineError, err.Error())
 	}
 	var data []byte
 	switch c := obj.(type) {
@@ -93,7 +112,7 @@ func (r *ConfigReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 			return ctrl.Result{}, err
 		}
 	default:
-		return ctrl.Result{}, errors.Errorf("Config %q contained invalid configuration type: %T", cfg.Name, c)
+		return ctrl.Result{}, r.setFailure(ctx, cfg, mapierrors.InvalidConfigMachineError, fmt.Sprintf("invalid configuration type: %T", c))
 	}
 
 	cloudConfig := &cloudinit.Config{
@@ -139,12 +158,15 @@ func (r *ConfigReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	}
 	data, err = cloudinit.Write(cloudConfig)
 	if err != nil {
+		configRenderErrorsTotal.WithLabelValues(renderFailedReason).Inc()
 		return ctrl.Result{}, err
 	}
 	data, err = cloudinit.CreateMessage(data)
 	if err != nil {
+		configRenderErrorsTotal.WithLabelValues(renderFailedReason).Inc()
 		return ctrl.Result{}, err
 	}
+	configPayloadBytes.Observe(float64(len(data)))
 	s := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      names.SimpleNameGenerator.GenerateName(cfg.Name + "-"),
@@ -162,8 +184,20 @@ func (r *ConfigReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	}
 	cfg.Status.Ready = true
 	cfg.Status.DataSecretName = pointer.StringPtr(s.ObjectMeta.Name)
+	cfg.Status.FailureReason = ""
+	cfg.Status.FailureMessage = ""
 	if err := r.Status().Update(ctx, cfg); err != nil {
 		return ctrl.Result{}, err
 	}
 	return ctrl.Result{}, nil
 }
+
+// setFailure records a failure on the Config status, which Machines
+// referencing the Config reflect until the Config is fixed.
+func (r *ConfigReconciler) setFailure(ctx context.Context, cfg *machinev1.Config, reason mapierrors.MachineStatusError, msg string) error {
+	r.Log.Info("Config is invalid", "config", cfg.Name, "namespace", cfg.Namespace, "reason", reason, "message", msg)
+	configRenderErrorsTotal.WithLabelValues(string(reason)).Inc()
+	cfg.Status.FailureReason = string(reason)
+	cfg.Status.FailureMessage = msg
+	return r.Status().Update(ctx, cfg)
+}
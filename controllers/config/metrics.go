@@ -0,0 +1,47 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// renderFailedReason is the reason of render errors that are not caused by
+// an invalid Config, and are retried.
+const renderFailedReason = "RenderFailed"
+
+var (
+	configRenderErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "machine_api_config_render_errors_total",
+			Help: "Number of errors rendering the cloud-init payload of a config, by reason.",
+		},
+		[]string{"reason"},
+	)
+	configPayloadBytes = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "machine_api_config_payload_bytes",
+			Help:    "Size of the cloud-init payloads rendered for configs.",
+			Buckets: prometheus.ExponentialBuckets(1024, 2, 8),
+		},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(configRenderErrorsTotal, configPayloadBytes)
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+)
+
+func TestConfigRenderErrorsMetric(t *testing.T) {
+	g := NewWithT(t)
+
+	s := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(s)
+	_ = machinev1.AddToScheme(s)
+	cfg := &machinev1.Config{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"},
+		Spec:       machinev1.ConfigSpec{Config: "kind: Unknown"},
+	}
+	r := &ConfigReconciler{Client: fake.NewFakeClientWithScheme(s, cfg), Log: log.NullLogger{}, Scheme: s}
+
+	counter := configRenderErrorsTotal.WithLabelValues(string(mapierrors.InvalidConfigMachineError))
+	before := testutil.ToFloat64(counter)
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Name: cfg.Name, Namespace: cfg.Namespace}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(testutil.ToFloat64(counter)).To(Equal(before + 1))
+}
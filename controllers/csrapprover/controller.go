@@ -23,16 +23,19 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	mapierrors "github.com/criticalstack/machine-api/errors"
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
 )
 
 type CSRApproverReconciler struct {
@@ -40,74 +43,204 @@ type CSRApproverReconciler struct {
 	Log    logr.Logger
 	Scheme *runtime.Scheme
 
-	config *rest.Config
+	// DenyInvalid denies CSRs that cannot be approved, instead of leaving
+	// them pending.
+	DenyInvalid bool
+
+	// IgnoreUnknownMachines leaves the CSRs of nodes without a Machine
+	// pending, without denying them or recording events. It is set when the
+	// manager only watches some namespaces, as the Machine may then be in a
+	// namespace handled by another manager.
+	IgnoreUnknownMachines bool
+
+	clientset     kubernetes.Interface
+	dynamicClient dynamic.Interface
+	recorder      record.EventRecorder
+
+	// certificatesV1 is set when the API server serves the
+	// certificates.k8s.io/v1 API, which is then used instead of v1beta1.
+	certificatesV1 bool
 }
 
 func (r *CSRApproverReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
-	r.config = mgr.GetConfig()
+	var err error
+	r.clientset, err = kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return errors.Wrap(err, "failed to create clientset")
+	}
+	r.dynamicClient, err = dynamic.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return errors.Wrap(err, "failed to create dynamic client")
+	}
+	r.recorder = mgr.GetEventRecorderFor("csrapprover-controller")
+	r.certificatesV1, err = servesCertificatesV1(r.clientset.Discovery())
+	if err != nil {
+		return err
+	}
+	r.Log.Info("Watching CertificateSigningRequests", "v1", r.certificatesV1)
 	return ctrl.NewControllerManagedBy(mgr).
 		WithOptions(options).
-		For(&certificatesv1beta1.CertificateSigningRequest{}).
+		For(r.newCSRObject()).
+		Watches(
+			&source.Kind{Type: &machinev1.CSRApprovalPolicy{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.policyToCSRs)},
+		).
 		Complete(r)
 }
 
 // +kubebuilder:rbac:groups=machine.crit.sh,resources=machines;machines/status,verbs=get;list;watch
+// +kubebuilder:rbac:groups=machine.crit.sh,resources=machines/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=machine.crit.sh,resources=csrapprovalpolicies,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=get;watch;update;delete;list
 // +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests/approval,verbs=create;update
-// +kubebuilder:rbac:groups=certificates.k8s.io,resources=signers,resourceNames=kubernetes.io/legacy-unknown;kubernetes.io/kubelet-serving,verbs=approve
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=signers,resourceNames=kubernetes.io/legacy-unknown;kubernetes.io/kubelet-serving;kubernetes.io/kube-apiserver-client-kubelet,verbs=approve
 // +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+// +kubebuilder:rbac:groups=core,resources=events,verbs=get;list;watch;create;patch
 
 func (r *CSRApproverReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
 	log := r.Log.WithValues("csr", req.NamespacedName)
 
-	csr := &certificatesv1beta1.CertificateSigningRequest{}
-	if err := r.Get(ctx, req.NamespacedName, csr); err != nil {
-		if apierrors.IsNotFound(err) {
+	csr, err := r.getCSR(ctx, req.NamespacedName)
+	if err != nil {
+		if apierrors.IsNotFound(errors.Cause(err)) {
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, err
 	}
-	log = log.WithValues("name", csr.Name, "username", csr.Spec.Username, "groups", csr.Spec.Groups)
+	signerName := signerNameOf(csr)
+	log = log.WithValues("name", csr.Name, "username", csr.Spec.Username, "groups", csr.Spec.Groups, "signer", signerName)
 
 	// Before continuing, we determine if this is a CSR we handle. This
 	// controller is only designed to auto-approve certificates for nodes.
-	if !strings.HasPrefix(csr.Spec.Username, "system:node:") {
-		log.Info("CSR is not for a node serving certificate")
+	// Client certificates are also requested by bootstrap identities, which
+	// are validated along with the request.
+	if !r.isSignerHandled(signerName) {
+		log.Info("CSR is not for a node certificate")
 		return ctrl.Result{}, nil
 	}
+	validate := r.validateClientCSR
+	if signerName != certificatesv1beta1.KubeAPIServerClientKubeletSignerName {
+		// Nodes also renew their client certificate through the
+		// legacy-unknown signer, which kube-controller-manager approves.
+		if !strings.HasPrefix(csr.Spec.Username, "system:node:") || !isServingCSR(csr) {
+			log.Info("CSR is not for a node serving certificate")
+			return ctrl.Result{}, nil
+		}
+		validate = r.validateCSR
+	}
 
-	// check if already approved/denied
+	// check if already approved/denied, recording the expiry of issued
+	// certificates
 	for _, condition := range csr.Status.Conditions {
 		switch condition.Type {
-		case certificatesv1beta1.CertificateApproved, certificatesv1beta1.CertificateDenied:
+		case certificatesv1beta1.CertificateApproved:
+			if len(csr.Status.Certificate) > 0 {
+				return ctrl.Result{}, r.recordCertificateExpiry(ctx, csr)
+			}
+			log.Info("CSR already handled", "result", condition.Type)
+			return ctrl.Result{}, nil
+		case certificatesv1beta1.CertificateDenied:
 			log.Info("CSR already handled", "result", condition.Type)
 			return ctrl.Result{}, nil
 		}
 	}
 
 	// validate CSR
-	if err := r.validateCSR(ctx, csr); err != nil {
-		if requeueErr, ok := errors.Cause(err).(mapierrors.HasRequeueAfterError); ok {
-			return ctrl.Result{RequeueAfter: requeueErr.GetRequeueAfter()}, nil
+	m, err := validate(ctx, csr)
+	if err != nil {
+		if isNotReady(err) {
+			log.Info("waiting to validate CSR", "reason", err)
+			return ctrl.Result{Requeue: true}, nil
+		}
+		if isIgnored(err) {
+			log.Info("leaving CSR pending", "reason", err)
+			r.eventf(csr, m, corev1.EventTypeNormal, "CSRIgnored", "CSR %q %s", csr.Name, err)
+			return ctrl.Result{}, nil
+		}
+		invalid, ok := asInvalidCSR(err)
+		if !ok {
+			return ctrl.Result{}, errors.Wrap(err, "cannot validate CSR")
+		}
+		if r.IgnoreUnknownMachines && invalid.reason == UnknownMachineReason {
+			log.Info("CSR is not for a machine of the watched namespaces, leaving it pending", "message", invalid.message)
+			return ctrl.Result{}, nil
 		}
-		log.Info("cannot validate CSR", "reason", err)
+		// Client CSRs that are not for a Machine may be approved by
+		// kube-controller-manager, so only those of a Machine are denied.
+		owned := signerName != certificatesv1beta1.KubeAPIServerClientKubeletSignerName || m != nil
+		if (!r.DenyInvalid || !owned) && invalid.policy == "" {
+			log.Info("CSR is invalid, leaving it pending", "reason", invalid.reason, "message", invalid.message)
+			r.eventf(csr, m, corev1.EventTypeWarning, "CSRInvalid", "CSR %q is invalid: %s", csr.Name, invalid.message)
+			return ctrl.Result{}, nil
+		}
+
+		// deny CSR
+		log.Info("denying CSR", "reason", invalid.reason, "message", invalid.message)
+		if err := r.denyCSR(ctx, csr, invalid.reason, invalid.message); err != nil {
+			return ctrl.Result{}, err
+		}
+		csrDenialsTotal.WithLabelValues(invalid.reason).Inc()
+		r.eventf(csr, m, corev1.EventTypeWarning, "CSRDenied", "denied CSR %q: %s", csr.Name, invalid.message)
 		return ctrl.Result{}, nil
 	}
 
 	// approve CSR
-	csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1beta1.CertificateSigningRequestCondition{
-		Type:   certificatesv1beta1.CertificateApproved,
-		Reason: "approved by machine-api controller",
-	})
-	k, err := kubernetes.NewForConfig(r.config)
-	if err != nil {
-		return ctrl.Result{}, err
-	}
 	log.Info("approving CSR")
-	if _, err := k.CertificatesV1beta1().CertificateSigningRequests().UpdateApproval(ctx, csr, metav1.UpdateOptions{}); err != nil {
+	if err := r.approveCSR(ctx, csr, "approved by machine-api controller"); err != nil {
 		return ctrl.Result{}, err
 	}
+	csrApprovalsTotal.WithLabelValues(signerName).Inc()
+	r.eventf(csr, m, corev1.EventTypeNormal, "CSRApproved", "approved CSR %q", csr.Name)
 	return ctrl.Result{}, nil
 }
+
+// eventf records an event on the Machine a CSR was validated for, or on the
+// CSR itself when the Machine is unknown.
+func (r *CSRApproverReconciler) eventf(csr *certificatesv1beta1.CertificateSigningRequest, m *machinev1.Machine, eventtype, reason, messageFmt string, args ...interface{}) {
+	if m != nil {
+		r.recorder.Eventf(m, eventtype, reason, messageFmt, args...)
+		return
+	}
+	r.recorder.Eventf(csr, eventtype, reason, messageFmt, args...)
+}
+
+// signerNameOf returns the signer of a CSR. CSRs created through v1beta1
+// before Kubernetes 1.18 have none, and are treated as legacy-unknown.
+func signerNameOf(csr *certificatesv1beta1.CertificateSigningRequest) string {
+	if csr.Spec.SignerName == nil {
+		return certificatesv1beta1.LegacyUnknownSignerName
+	}
+	return *csr.Spec.SignerName
+}
+
+// isServingCSR returns whether a CSR is for a serving certificate. CSRs of the
+// legacy-unknown signer are for serving certificates when they request
+// server auth.
+func isServingCSR(csr *certificatesv1beta1.CertificateSigningRequest) bool {
+	switch signerNameOf(csr) {
+	case certificatesv1beta1.KubeletServingSignerName:
+		return true
+	case certificatesv1beta1.LegacyUnknownSignerName:
+		for _, usage := range csr.Spec.Usages {
+			if usage == certificatesv1beta1.UsageServerAuth {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSignerHandled returns whether CSRs for the signer are approved. The
+// legacy-unknown signer no longer exists in the v1 API, which leaves the
+// kubelet signers.
+func (r *CSRApproverReconciler) isSignerHandled(signerName string) bool {
+	switch signerName {
+	case certificatesv1beta1.KubeletServingSignerName, certificatesv1beta1.KubeAPIServerClientKubeletSignerName:
+		return true
+	case certificatesv1beta1.LegacyUnknownSignerName:
+		return !r.certificatesV1
+	}
+	return false
+}
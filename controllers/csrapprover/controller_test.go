@@ -0,0 +1,156 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	timeout  = 10 * time.Second
+	interval = 250 * time.Millisecond
+)
+
+func newCertificateRequest(nodeName string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "system:node:" + nodeName, Organization: []string{"system:nodes"}},
+		DNSNames: []string{nodeName},
+	}, key)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+var _ = Describe("CSRApproverReconciler", func() {
+	ctx := context.Background()
+	usages := []certificatesv1beta1.KeyUsage{certificatesv1beta1.UsageDigitalSignature, certificatesv1beta1.UsageServerAuth}
+
+	// createCSR creates a kubelet serving CSR through the given API version.
+	createCSR := func(name string, v1 bool) {
+		if !v1 {
+			Expect(k8sClient.Create(ctx, &certificatesv1beta1.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				Spec: certificatesv1beta1.CertificateSigningRequestSpec{
+					Request:    newCertificateRequest("worker"),
+					SignerName: pointer.StringPtr(certificatesv1beta1.KubeletServingSignerName),
+					Usages:     usages,
+				},
+			})).To(Succeed())
+			return
+		}
+		u := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"request":    base64.StdEncoding.EncodeToString(newCertificateRequest("worker")),
+				"signerName": certificatesv1beta1.KubeletServingSignerName,
+				"usages":     []interface{}{string(usages[0]), string(usages[1])},
+			},
+		}}
+		u.SetGroupVersionKind(CertificatesV1.WithKind("CertificateSigningRequest"))
+		u.SetName(name)
+		Expect(k8sClient.Create(ctx, u)).To(Succeed())
+	}
+
+	hasCondition := func(name string, conditionType certificatesv1beta1.RequestConditionType) func() bool {
+		return func() bool {
+			csr := &certificatesv1beta1.CertificateSigningRequest{}
+			if err := k8sClient.Get(ctx, client.ObjectKey{Name: name}, csr); err != nil {
+				return false
+			}
+			for _, c := range csr.Status.Conditions {
+				if c.Type == conditionType {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	isApproved := func(name string) func() bool {
+		return hasCondition(name, certificatesv1beta1.CertificateApproved)
+	}
+
+	// The v1 specs need envtest assets of Kubernetes 1.19 or later, which
+	// serve certificates.k8s.io/v1.
+	expectV1 := func() {
+		dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		v1, err := servesCertificatesV1(dc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(v1).To(BeTrue(), "certificates.k8s.io/v1 is not served, KUBEBUILDER_ASSETS must be of Kubernetes 1.19 or later")
+	}
+
+	for _, version := range []string{"v1beta1", "v1"} {
+		v1 := version == "v1"
+
+		Context("with the "+version+" API", func() {
+			BeforeEach(func() {
+				if v1 {
+					expectV1()
+				}
+			})
+
+			It("leaves CSRs that are not requested by a node pending", func() {
+				name := "not-a-node-" + version
+				createCSR(name, v1)
+				Consistently(isApproved(name), 2*time.Second, interval).Should(BeFalse())
+			})
+
+			It("approves CSRs through the approval subresource", func() {
+				name := "approve-" + version
+				createCSR(name, v1)
+
+				r := *reconciler
+				r.certificatesV1 = v1
+				csr, err := r.getCSR(ctx, client.ObjectKey{Name: name})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(signerNameOf(csr)).To(Equal(certificatesv1beta1.KubeletServingSignerName))
+				Expect(r.approveCSR(ctx, csr, "approved by test")).To(Succeed())
+				Eventually(isApproved(name), timeout, interval).Should(BeTrue())
+			})
+
+			It("denies CSRs through the approval subresource", func() {
+				name := "deny-" + version
+				createCSR(name, v1)
+
+				r := *reconciler
+				r.certificatesV1 = v1
+				csr, err := r.getCSR(ctx, client.ObjectKey{Name: name})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(r.denyCSR(ctx, csr, UnknownMachineReason, "denied by test")).To(Succeed())
+				Eventually(hasCondition(name, certificatesv1beta1.CertificateDenied), timeout, interval).Should(BeTrue())
+				Expect(isApproved(name)()).To(BeFalse())
+			})
+		})
+	}
+})
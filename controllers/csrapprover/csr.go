@@ -0,0 +1,160 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CertificatesV1 is the certificates.k8s.io/v1 API, which replaces v1beta1
+// since Kubernetes 1.19. The client libraries in use predate it, so v1
+// objects are handled as unstructured objects and converted to the v1beta1
+// types, which share the same fields.
+var CertificatesV1 = schema.GroupVersion{Group: "certificates.k8s.io", Version: "v1"}
+
+// servesCertificatesV1 returns whether the API server serves the
+// certificates.k8s.io/v1 API.
+func servesCertificatesV1(dc discovery.DiscoveryInterface) (bool, error) {
+	if _, err := dc.ServerResourcesForGroupVersion(CertificatesV1.String()); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to discover %s", CertificatesV1)
+	}
+	return true, nil
+}
+
+// newCSRObject returns an empty CSR object of the API version in use.
+func (r *CSRApproverReconciler) newCSRObject() runtime.Object {
+	if !r.certificatesV1 {
+		return &certificatesv1beta1.CertificateSigningRequest{}
+	}
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(CertificatesV1.WithKind("CertificateSigningRequest"))
+	return u
+}
+
+// newCSRListObject returns an empty CSR list object of the API version in
+// use.
+func (r *CSRApproverReconciler) newCSRListObject() runtime.Object {
+	if !r.certificatesV1 {
+		return &certificatesv1beta1.CertificateSigningRequestList{}
+	}
+	u := &unstructured.UnstructuredList{}
+	u.SetGroupVersionKind(CertificatesV1.WithKind("CertificateSigningRequestList"))
+	return u
+}
+
+// getCSR gets a CSR through the API version in use and returns it as
+// v1beta1 type.
+func (r *CSRApproverReconciler) getCSR(ctx context.Context, key client.ObjectKey) (*certificatesv1beta1.CertificateSigningRequest, error) {
+	obj := r.newCSRObject()
+	if err := r.Get(ctx, key, obj); err != nil {
+		return nil, err
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return obj.(*certificatesv1beta1.CertificateSigningRequest), nil
+	}
+	return csrFromUnstructured(u)
+}
+
+// approveCSR adds the Approved condition to a CSR.
+func (r *CSRApproverReconciler) approveCSR(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest, reason string) error {
+	return r.updateApproval(ctx, csr, certificatesv1beta1.CertificateSigningRequestCondition{
+		Type:           certificatesv1beta1.CertificateApproved,
+		Reason:         reason,
+		LastUpdateTime: metav1.Now(),
+	})
+}
+
+// denyCSR adds the Denied condition to a CSR.
+func (r *CSRApproverReconciler) denyCSR(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest, reason, message string) error {
+	return r.updateApproval(ctx, csr, certificatesv1beta1.CertificateSigningRequestCondition{
+		Type:           certificatesv1beta1.CertificateDenied,
+		Reason:         reason,
+		Message:        message,
+		LastUpdateTime: metav1.Now(),
+	})
+}
+
+// updateApproval adds an Approved or Denied condition to a CSR through the
+// approval subresource of the API version in use.
+func (r *CSRApproverReconciler) updateApproval(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest, condition certificatesv1beta1.CertificateSigningRequestCondition) error {
+	if !r.certificatesV1 {
+		csr.Status.Conditions = append(csr.Status.Conditions, condition)
+		_, err := r.clientset.CertificatesV1beta1().CertificateSigningRequests().UpdateApproval(ctx, csr, metav1.UpdateOptions{})
+		return err
+	}
+
+	u, err := csrToUnstructured(csr, condition)
+	if err != nil {
+		return err
+	}
+	_, err = r.dynamicClient.Resource(CertificatesV1.WithResource("certificatesigningrequests")).Update(ctx, u, metav1.UpdateOptions{}, "approval")
+	return err
+}
+
+func csrFromUnstructured(u *unstructured.Unstructured) (*certificatesv1beta1.CertificateSigningRequest, error) {
+	csr := &certificatesv1beta1.CertificateSigningRequest{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, csr); err != nil {
+		return nil, errors.Wrapf(err, "failed to convert CertificateSigningRequest %q", u.GetName())
+	}
+	return csr, nil
+}
+
+// csrToUnstructured returns a v1 object for a CSR with the condition added.
+// The v1beta1 type has no condition status, which v1 requires, so conditions
+// are set True, the only status the API server allows for Approved, Denied
+// and Failed conditions.
+func csrToUnstructured(csr *certificatesv1beta1.CertificateSigningRequest, condition certificatesv1beta1.CertificateSigningRequestCondition) (*unstructured.Unstructured, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(csr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to convert CertificateSigningRequest %q", csr.Name)
+	}
+	u := &unstructured.Unstructured{Object: obj}
+	u.SetGroupVersionKind(CertificatesV1.WithKind("CertificateSigningRequest"))
+
+	conditions, _, err := unstructured.NestedSlice(u.Object, "status", "conditions")
+	if err != nil {
+		return nil, err
+	}
+	c, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&condition)
+	if err != nil {
+		return nil, err
+	}
+	conditions = append(conditions, c)
+	for _, c := range conditions {
+		if c, ok := c.(map[string]interface{}); ok {
+			c["status"] = "True"
+		}
+	}
+	if err := unstructured.SetNestedSlice(u.Object, conditions, "status", "conditions"); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/pointer"
+)
+
+func TestCSRConversion(t *testing.T) {
+	g := NewWithT(t)
+
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"request":    "cmVxdWVzdA==",
+			"signerName": certificatesv1beta1.KubeletServingSignerName,
+			"username":   "system:node:worker",
+			"usages":     []interface{}{"digital signature", "server auth"},
+		},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Failed", "status": "True"},
+			},
+		},
+	}}
+	u.SetGroupVersionKind(CertificatesV1.WithKind("CertificateSigningRequest"))
+	u.SetName("csr")
+
+	csr, err := csrFromUnstructured(u)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(csr.Spec.Request).To(Equal([]byte("request")))
+	g.Expect(signerNameOf(csr)).To(Equal(certificatesv1beta1.KubeletServingSignerName))
+	g.Expect(csr.Spec.Usages).To(ConsistOf(certificatesv1beta1.UsageDigitalSignature, certificatesv1beta1.UsageServerAuth))
+
+	approved, err := csrToUnstructured(csr, certificatesv1beta1.CertificateSigningRequestCondition{
+		Type:   certificatesv1beta1.CertificateApproved,
+		Reason: "approved",
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(approved.GetAPIVersion()).To(Equal("certificates.k8s.io/v1"))
+	request, _, _ := unstructured.NestedString(approved.Object, "spec", "request")
+	g.Expect(request).To(Equal("cmVxdWVzdA=="))
+	conditions, _, _ := unstructured.NestedSlice(approved.Object, "status", "conditions")
+	g.Expect(conditions).To(HaveLen(2))
+	g.Expect(conditions[1]).To(HaveKeyWithValue("type", "Approved"))
+	g.Expect(conditions[1]).To(HaveKeyWithValue("status", "True"))
+}
+
+func TestIsSignerHandled(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &CSRApproverReconciler{}
+	g.Expect(r.isSignerHandled(certificatesv1beta1.KubeletServingSignerName)).To(BeTrue())
+	g.Expect(r.isSignerHandled(certificatesv1beta1.LegacyUnknownSignerName)).To(BeTrue())
+	g.Expect(r.isSignerHandled(certificatesv1beta1.KubeAPIServerClientKubeletSignerName)).To(BeTrue())
+	g.Expect(r.isSignerHandled(certificatesv1beta1.KubeAPIServerClientSignerName)).To(BeFalse())
+
+	r.certificatesV1 = true
+	g.Expect(r.isSignerHandled(certificatesv1beta1.KubeletServingSignerName)).To(BeTrue())
+	g.Expect(r.isSignerHandled(certificatesv1beta1.LegacyUnknownSignerName)).To(BeFalse())
+}
+
+func TestIsServingCSR(t *testing.T) {
+	g := NewWithT(t)
+
+	csr := &certificatesv1beta1.CertificateSigningRequest{
+		Spec: certificatesv1beta1.CertificateSigningRequestSpec{
+			Usages: []certificatesv1beta1.KeyUsage{certificatesv1beta1.UsageDigitalSignature, certificatesv1beta1.UsageServerAuth},
+		},
+	}
+	g.Expect(isServingCSR(csr)).To(BeTrue())
+
+	csr.Spec.Usages = []certificatesv1beta1.KeyUsage{certificatesv1beta1.UsageDigitalSignature, certificatesv1beta1.UsageClientAuth}
+	g.Expect(isServingCSR(csr)).To(BeFalse())
+
+	csr.Spec.SignerName = pointer.StringPtr(certificatesv1beta1.KubeletServingSignerName)
+	g.Expect(isServingCSR(csr)).To(BeTrue())
+
+	csr.Spec.SignerName = pointer.StringPtr(certificatesv1beta1.KubeAPIServerClientKubeletSignerName)
+	g.Expect(isServingCSR(csr)).To(BeFalse())
+}
+
+func TestValidateUsages(t *testing.T) {
+	g := NewWithT(t)
+
+	serving := certificatesv1beta1.KubeletServingSignerName
+	legacy := certificatesv1beta1.LegacyUnknownSignerName
+	g.Expect(validateUsages(serving, []certificatesv1beta1.KeyUsage{
+		certificatesv1beta1.UsageDigitalSignature, certificatesv1beta1.UsageKeyEncipherment, certificatesv1beta1.UsageServerAuth,
+	})).To(Succeed())
+	g.Expect(validateUsages(serving, []certificatesv1beta1.KeyUsage{
+		certificatesv1beta1.UsageDigitalSignature, certificatesv1beta1.UsageServerAuth,
+	})).To(Succeed())
+	g.Expect(validateUsages(serving, []certificatesv1beta1.KeyUsage{
+		certificatesv1beta1.UsageDigitalSignature,
+	})).NotTo(Succeed())
+	g.Expect(validateUsages(serving, []certificatesv1beta1.KeyUsage{
+		certificatesv1beta1.UsageDigitalSignature, certificatesv1beta1.UsageServerAuth, certificatesv1beta1.UsageClientAuth,
+	})).NotTo(Succeed())
+	g.Expect(validateUsages(legacy, []certificatesv1beta1.KeyUsage{
+		certificatesv1beta1.UsageKeyEncipherment,
+	})).To(Succeed())
+}
+
+func TestValidateKubeletServingRequest(t *testing.T) {
+	g := NewWithT(t)
+
+	newRequest := func() *x509.CertificateRequest {
+		return &x509.CertificateRequest{
+			Subject:     pkix.Name{CommonName: "system:node:worker", Organization: []string{"system:nodes"}},
+			DNSNames:    []string{"worker"},
+			IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		}
+	}
+	g.Expect(validateKubeletServingRequest("system:node:worker", newRequest())).To(Succeed())
+	g.Expect(validateKubeletServingRequest("system:node:other", newRequest())).NotTo(Succeed())
+
+	req := newRequest()
+	req.Subject.Organization = []string{"system:masters"}
+	g.Expect(validateKubeletServingRequest("system:node:worker", req)).NotTo(Succeed())
+
+	req = newRequest()
+	req.DNSNames, req.IPAddresses = nil, nil
+	g.Expect(validateKubeletServingRequest("system:node:worker", req)).NotTo(Succeed())
+
+	req = newRequest()
+	req.EmailAddresses = []string{"worker@example.com"}
+	g.Expect(validateKubeletServingRequest("system:node:worker", req)).NotTo(Succeed())
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Reasons of the Denied condition added to invalid CSRs.
+const (
+	// InvalidRequestReason is used when the certificate request cannot be
+	// parsed, or its subject is not the one of a node.
+	InvalidRequestReason = "InvalidRequest"
+
+	// InvalidRequestorReason is used when the CSR was not requested by the
+	// node, or a bootstrap identity, the certificate is for.
+	InvalidRequestorReason = "InvalidRequestor"
+
+	// DisallowedSANReason is used when the certificate request has subject
+	// alternative names that are not addresses of the Machine.
+	DisallowedSANReason = "DisallowedSAN"
+
+	// DisallowedUsageReason is used when the usages of the CSR are not the
+	// ones of its signer.
+	DisallowedUsageReason = "DisallowedUsage"
+
+	// FailedSubjectAccessReviewReason is used when the requestor is not
+	// allowed to create the CSR.
+	FailedSubjectAccessReviewReason = "FailedSubjectAccessReview"
+
+	// UnknownMachineReason is used when no Machine exists for the node.
+	UnknownMachineReason = "UnknownMachine"
+
+	// DeniedByPolicyReason is used when the CSR is denied by a
+	// CSRApprovalPolicy.
+	DeniedByPolicyReason = "DeniedByPolicy"
+)
+
+// invalidCSRError is returned by the validation of CSRs that cannot be
+// approved, whatever happens to the cluster later on. These CSRs are denied
+// when DenyInvalid is set, or when a policy denies them.
+type invalidCSRError struct {
+	reason  string
+	message string
+
+	// policy is the name of the CSRApprovalPolicy denying the CSR.
+	policy string
+}
+
+func (e *invalidCSRError) Error() string {
+	return e.message
+}
+
+func invalidf(reason, format string, args ...interface{}) error {
+	return &invalidCSRError{reason: reason, message: fmt.Sprintf(format, args...)}
+}
+
+// notReadyError is returned by the validation of CSRs for Machines that are
+// not ready to be matched yet. These CSRs are requeued with backoff.
+type notReadyError struct {
+	message string
+}
+
+func (e *notReadyError) Error() string {
+	return e.message
+}
+
+func notReadyf(format string, args ...interface{}) error {
+	return &notReadyError{message: fmt.Sprintf(format, args...)}
+}
+
+// ignoredError is returned by the validation of CSRs that a
+// CSRApprovalPolicy leaves pending.
+type ignoredError struct {
+	policy string
+}
+
+func (e *ignoredError) Error() string {
+	return "ignored by CSRApprovalPolicy " + e.policy
+}
+
+// asInvalidCSR returns the invalidCSRError causing err, if any.
+func asInvalidCSR(err error) (*invalidCSRError, bool) {
+	e, ok := errors.Cause(err).(*invalidCSRError)
+	return e, ok
+}
+
+// isNotReady returns whether err is caused by a notReadyError.
+func isNotReady(err error) bool {
+	_, ok := errors.Cause(err).(*notReadyError)
+	return ok
+}
+
+// isIgnored returns whether err is caused by an ignoredError.
+func isIgnored(err error) bool {
+	_, ok := errors.Cause(err).(*ignoredError)
+	return ok
+}
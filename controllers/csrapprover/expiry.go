@@ -0,0 +1,115 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+
+	"github.com/pkg/errors"
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	"github.com/criticalstack/machine-api/util/index"
+)
+
+// recordCertificateExpiry records the expiry of the certificate issued for
+// an approved CSR on the Machine of its node. Only certificates expiring
+// after the recorded ones are recorded, as older CSRs are reconciled too.
+func (r *CSRApproverReconciler) recordCertificateExpiry(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest) error {
+	log := r.Log.WithValues("csr", csr.Name)
+
+	cert, err := parseIssuedCertificate(csr.Status.Certificate)
+	if err != nil {
+		log.Info("cannot parse issued certificate", "reason", err)
+		return nil
+	}
+	if !strings.HasPrefix(cert.Subject.CommonName, "system:node:") {
+		return nil
+	}
+	nodeName := strings.TrimPrefix(cert.Subject.CommonName, "system:node:")
+	m, err := r.getMachineForNode(ctx, nodeName)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		log.Info("cannot find machine for issued certificate", "node", nodeName)
+		return nil
+	}
+
+	patch := client.MergeFrom(m.DeepCopy())
+	if m.Status.NodeCertificates == nil {
+		m.Status.NodeCertificates = &machinev1.NodeCertificatesStatus{}
+	}
+	notAfter := metav1.NewTime(cert.NotAfter)
+	recorded := false
+	for _, usage := range cert.ExtKeyUsage {
+		var field **metav1.Time
+		switch usage {
+		case x509.ExtKeyUsageServerAuth:
+			field = &m.Status.NodeCertificates.ServingNotAfter
+		case x509.ExtKeyUsageClientAuth:
+			field = &m.Status.NodeCertificates.ClientNotAfter
+		default:
+			continue
+		}
+		if *field == nil || (*field).Before(&notAfter) {
+			*field = notAfter.DeepCopy()
+			recorded = true
+		}
+	}
+	if !recorded {
+		return nil
+	}
+	log.Info("recording certificate expiry", "machine", m.Name, "namespace", m.Namespace, "notAfter", cert.NotAfter)
+	return r.Status().Patch(ctx, m, patch)
+}
+
+// getMachineForNode returns the Machine linked to the node, or the unlinked
+// Machine with the hostname of the node, as bootstrap client certificates
+// are issued before the node has registered. It returns nil if there is
+// none.
+func (r *CSRApproverReconciler) getMachineForNode(ctx context.Context, nodeName string) (*machinev1.Machine, error) {
+	m, err := r.getLinkedMachine(ctx, nodeName)
+	if err != nil || m != nil {
+		return m, err
+	}
+	machines, err := r.listUnlinkedMachines(ctx, index.MachineHostnameField, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range machines {
+		if machineHasHostname(&m, nodeName) {
+			return &m, nil
+		}
+	}
+	return nil, nil
+}
+
+// parseIssuedCertificate parses the first certificate of the PEM encoded
+// chain issued for a CSR.
+func parseIssuedCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("issued certificate is not PEM encoded")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+func newIssuedCertificate(t *testing.T, usage x509.ExtKeyUsage, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "system:node:worker", Organization: []string{"system:nodes"}},
+		NotBefore:    time.Now(),
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}, &x509.Certificate{SerialNumber: big.NewInt(1)}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func newIssuedCSR(t *testing.T, name string, usage x509.ExtKeyUsage, notAfter time.Time) *certificatesv1beta1.CertificateSigningRequest {
+	csr := newClientCSR(t, "system:node:worker", "system:nodes", "system:authenticated")
+	csr.Name = name
+	csr.Status = certificatesv1beta1.CertificateSigningRequestStatus{
+		Conditions:  []certificatesv1beta1.CertificateSigningRequestCondition{{Type: certificatesv1beta1.CertificateApproved}},
+		Certificate: newIssuedCertificate(t, usage, notAfter),
+	}
+	return csr
+}
+
+func TestRecordCertificateExpiry(t *testing.T) {
+	notAfter := time.Now().Add(365 * 24 * time.Hour).Truncate(time.Second)
+
+	t.Run("records the expiry on linked machines", func(t *testing.T) {
+		g := NewWithT(t)
+
+		m := &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+			Status:     machinev1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "worker"}},
+		}
+		serving := newIssuedCSR(t, "serving", x509.ExtKeyUsageServerAuth, notAfter)
+		older := newIssuedCSR(t, "older", x509.ExtKeyUsageServerAuth, notAfter.Add(-time.Hour))
+		r := &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(), m, serving, older), Log: log.NullLogger{}}
+		for _, name := range []string{"serving", "older"} {
+			_, err := r.Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Name: name}})
+			g.Expect(err).NotTo(HaveOccurred())
+		}
+
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Name: m.Name, Namespace: m.Namespace}, m)).To(Succeed())
+		g.Expect(m.Status.NodeCertificates.ServingNotAfter.Time).To(BeTemporally("==", notAfter))
+		g.Expect(m.Status.NodeCertificates.ClientNotAfter).To(BeNil())
+	})
+
+	t.Run("records the expiry of bootstrap certificates on joining machines", func(t *testing.T) {
+		g := NewWithT(t)
+
+		m := &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+			Status: machinev1.MachineStatus{
+				Addresses: machinev1.MachineAddresses{{Type: machinev1.MachineHostName, Address: "worker"}},
+			},
+		}
+		csr := newIssuedCSR(t, "client", x509.ExtKeyUsageClientAuth, notAfter)
+		r := &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(), m), Log: log.NullLogger{}}
+		g.Expect(r.recordCertificateExpiry(context.Background(), csr)).To(Succeed())
+
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Name: m.Name, Namespace: m.Namespace}, m)).To(Succeed())
+		g.Expect(m.Status.NodeCertificates.ClientNotAfter.Time).To(BeTemporally("==", notAfter))
+	})
+
+	t.Run("ignores certificates of unknown nodes", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme()), Log: log.NullLogger{}}
+		g.Expect(r.recordCertificateExpiry(context.Background(), newIssuedCSR(t, "client", x509.ExtKeyUsageClientAuth, notAfter))).To(Succeed())
+	})
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	csrApprovalsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "machine_api_csr_approvals_total",
+			Help: "Number of CSRs approved, by signer.",
+		},
+		[]string{"signer"},
+	)
+	csrDenialsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "machine_api_csr_denials_total",
+			Help: "Number of CSRs denied, by reason.",
+		},
+		[]string{"reason"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(csrApprovalsTotal, csrDenialsTotal)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	authorizationv1beta1 "k8s.io/api/authorization/v1beta1"
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+func TestCSRMetrics(t *testing.T) {
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+		Status: machinev1.MachineStatus{
+			InfrastructureReady: true,
+			NodeRef:             &corev1.ObjectReference{Name: "worker"},
+		},
+	}
+	newReconciler := func(csr *certificatesv1beta1.CertificateSigningRequest, action machinev1.CSRApprovalAction) *CSRApproverReconciler {
+		clientset := k8sfake.NewSimpleClientset(csr)
+		clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, &authorizationv1beta1.SubjectAccessReview{Status: authorizationv1beta1.SubjectAccessReviewStatus{Allowed: true}}, nil
+		})
+		return &CSRApproverReconciler{
+			Client:    fake.NewFakeClientWithScheme(newTestScheme(), csr, m, newPolicy("policy", 0, action)),
+			Log:       log.NullLogger{},
+			clientset: clientset,
+			recorder:  record.NewFakeRecorder(1),
+		}
+	}
+
+	t.Run("counts approvals by signer", func(t *testing.T) {
+		g := NewWithT(t)
+
+		counter := csrApprovalsTotal.WithLabelValues(certificatesv1beta1.KubeAPIServerClientKubeletSignerName)
+		before := testutil.ToFloat64(counter)
+		csr := newClientCSR(t, "system:node:worker", "system:nodes", "system:authenticated")
+		_, err := newReconciler(csr, machinev1.CSRApprovalActionApprove).Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Name: csr.Name}})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(testutil.ToFloat64(counter)).To(Equal(before + 1))
+	})
+
+	t.Run("counts denials by reason", func(t *testing.T) {
+		g := NewWithT(t)
+
+		counter := csrDenialsTotal.WithLabelValues(DeniedByPolicyReason)
+		before := testutil.ToFloat64(counter)
+		csr := newClientCSR(t, "system:node:worker", "system:nodes", "system:authenticated")
+		_, err := newReconciler(csr, machinev1.CSRApprovalActionDeny).Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Name: csr.Name}})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(testutil.ToFloat64(counter)).To(Equal(before + 1))
+	})
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+// getPolicy returns the first CSRApprovalPolicy, by order then name, that
+// applies to CSRs of the signer for the Machine. It returns nil when none
+// applies.
+func (r *CSRApproverReconciler) getPolicy(ctx context.Context, signerName string, m *machinev1.Machine) (*machinev1.CSRApprovalPolicy, error) {
+	policies := &machinev1.CSRApprovalPolicyList{}
+	if err := r.List(ctx, policies); err != nil {
+		return nil, err
+	}
+	sort.Slice(policies.Items, func(i, j int) bool {
+		if policies.Items[i].Spec.Order != policies.Items[j].Spec.Order {
+			return policies.Items[i].Spec.Order < policies.Items[j].Spec.Order
+		}
+		return policies.Items[i].Name < policies.Items[j].Name
+	})
+	for _, p := range policies.Items {
+		if len(p.Spec.SignerNames) > 0 && !sets.NewString(p.Spec.SignerNames...).Has(signerName) {
+			continue
+		}
+		selector := labels.Everything()
+		if p.Spec.MachineSelector != nil {
+			var err error
+			selector, err = metav1.LabelSelectorAsSelector(p.Spec.MachineSelector)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid machine selector in CSRApprovalPolicy %q", p.Name)
+			}
+		}
+		if selector.Matches(labels.Set(m.Labels)) {
+			return &p, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkPolicyAction returns the error for CSRs that are not approved by the
+// action of the policy, if any.
+func checkPolicyAction(p *machinev1.CSRApprovalPolicy) error {
+	if p == nil {
+		return nil
+	}
+	switch p.Spec.Action {
+	case machinev1.CSRApprovalActionDeny:
+		return &invalidCSRError{
+			reason:  DeniedByPolicyReason,
+			message: "denied by CSRApprovalPolicy " + p.Name,
+			policy:  p.Name,
+		}
+	case machinev1.CSRApprovalActionIgnore:
+		return &ignoredError{policy: p.Name}
+	}
+	return nil
+}
+
+// validateSANs checks the subject alternative names of a certificate
+// request. DNS names must be addresses of the Machine, or match a pattern
+// allowed by the policy, and IP addresses must be addresses of the Machine
+// within the ranges allowed by the policy.
+func validateSANs(req *x509.CertificateRequest, m *machinev1.Machine, p *machinev1.CSRApprovalPolicy) error {
+	addresses := sets.NewString(m.Status.NodeRef.Name)
+	for _, address := range m.Status.Addresses {
+		addresses.Insert(address.Address)
+	}
+	var patterns []string
+	var ranges []*net.IPNet
+	if p != nil {
+		patterns = p.Spec.AllowedDNSNames
+		for _, cidr := range p.Spec.AllowedIPRanges {
+			_, ipNet, err := net.ParseCIDR(string(cidr))
+			if err != nil {
+				return errors.Wrapf(err, "invalid IP range in CSRApprovalPolicy %q", p.Name)
+			}
+			ranges = append(ranges, ipNet)
+		}
+	}
+	for _, dns := range req.DNSNames {
+		if !addresses.Has(dns) && !matchesAnyDNSPattern(patterns, dns) {
+			return invalidf(DisallowedSANReason, "node %q not allowed to specify DNS address %q", m.Status.NodeRef.Name, dns)
+		}
+	}
+	for _, ip := range req.IPAddresses {
+		if !addresses.Has(ip.String()) {
+			return invalidf(DisallowedSANReason, "node %q not allowed to specify IP address %q", m.Status.NodeRef.Name, ip)
+		}
+		if len(ranges) > 0 && !ipInRanges(ranges, ip) {
+			return invalidf(DisallowedSANReason, "IP address %q of node %q is not in the ranges allowed by CSRApprovalPolicy %q", ip, m.Status.NodeRef.Name, p.Name)
+		}
+	}
+	return nil
+}
+
+// matchesAnyDNSPattern returns whether a DNS name matches any of the
+// patterns, where a "*" label matches any single label.
+func matchesAnyDNSPattern(patterns []string, name string) bool {
+	nameLabels := strings.Split(strings.ToLower(name), ".")
+	for _, pattern := range patterns {
+		patternLabels := strings.Split(strings.ToLower(pattern), ".")
+		if len(patternLabels) != len(nameLabels) {
+			continue
+		}
+		matches := true
+		for i := range nameLabels {
+			if nameLabels[i] == "" || (patternLabels[i] != "*" && patternLabels[i] != nameLabels[i]) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+func ipInRanges(ranges []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range ranges {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyToCSRs returns requests for all CSRs, for the pending ones to be
+// evaluated against the changed policies.
+func (r *CSRApproverReconciler) policyToCSRs(o handler.MapObject) []ctrl.Request {
+	list := r.newCSRListObject()
+	if err := r.List(context.Background(), list); err != nil {
+		r.Log.Error(err, "cannot list CSRs for CSR approval policy", "csrapprovalpolicy", o.Meta.GetName())
+		return nil
+	}
+	requests := make([]ctrl.Request, 0)
+	_ = meta.EachListItem(list, func(obj runtime.Object) error {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+		requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKey{Name: accessor.GetName()}})
+		return nil
+	})
+	return requests
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+func newPolicy(name string, order int32, action machinev1.CSRApprovalAction) *machinev1.CSRApprovalPolicy {
+	return &machinev1.CSRApprovalPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       machinev1.CSRApprovalPolicySpec{Order: order, Action: action},
+	}
+}
+
+func TestGetPolicy(t *testing.T) {
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default", Labels: map[string]string{"pool": "workers"}},
+	}
+	serving := certificatesv1beta1.KubeletServingSignerName
+
+	t.Run("returns nil without policies", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme()), Log: log.NullLogger{}}
+		p, err := r.getPolicy(context.Background(), serving, m)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(p).To(BeNil())
+	})
+
+	t.Run("evaluates policies in order", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(),
+			newPolicy("b", 1, machinev1.CSRApprovalActionDeny),
+			newPolicy("a", 1, machinev1.CSRApprovalActionIgnore),
+			newPolicy("c", 0, machinev1.CSRApprovalActionApprove),
+		), Log: log.NullLogger{}}
+		p, err := r.getPolicy(context.Background(), serving, m)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(p.Name).To(Equal("c"))
+	})
+
+	t.Run("skips policies for other signers and machines", func(t *testing.T) {
+		g := NewWithT(t)
+
+		otherSigner := newPolicy("a", 0, machinev1.CSRApprovalActionDeny)
+		otherSigner.Spec.SignerNames = []string{certificatesv1beta1.KubeAPIServerClientKubeletSignerName}
+		otherMachines := newPolicy("b", 0, machinev1.CSRApprovalActionDeny)
+		otherMachines.Spec.MachineSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "masters"}}
+		matching := newPolicy("c", 0, machinev1.CSRApprovalActionIgnore)
+		matching.Spec.SignerNames = []string{serving}
+		matching.Spec.MachineSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "workers"}}
+		r := &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(), otherSigner, otherMachines, matching), Log: log.NullLogger{}}
+		p, err := r.getPolicy(context.Background(), serving, m)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(p.Name).To(Equal("c"))
+	})
+}
+
+func TestCheckPolicyAction(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(checkPolicyAction(nil)).To(Succeed())
+	g.Expect(checkPolicyAction(newPolicy("approve", 0, ""))).To(Succeed())
+	g.Expect(checkPolicyAction(newPolicy("approve", 0, machinev1.CSRApprovalActionApprove))).To(Succeed())
+	g.Expect(isIgnored(checkPolicyAction(newPolicy("ignore", 0, machinev1.CSRApprovalActionIgnore)))).To(BeTrue())
+
+	invalid, ok := asInvalidCSR(checkPolicyAction(newPolicy("deny", 0, machinev1.CSRApprovalActionDeny)))
+	g.Expect(ok).To(BeTrue())
+	g.Expect(invalid.reason).To(Equal(DeniedByPolicyReason))
+	g.Expect(invalid.policy).To(Equal("deny"))
+}
+
+func TestValidateSANs(t *testing.T) {
+	g := NewWithT(t)
+
+	m := &machinev1.Machine{
+		Status: machinev1.MachineStatus{
+			NodeRef: &corev1.ObjectReference{Name: "worker"},
+			Addresses: machinev1.MachineAddresses{
+				{Type: machinev1.MachineInternalIP, Address: "10.0.0.1"},
+				{Type: machinev1.MachineExternalIP, Address: "203.0.113.1"},
+			},
+		},
+	}
+	req := &x509.CertificateRequest{
+		DNSNames:    []string{"worker"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("203.0.113.1")},
+	}
+	g.Expect(validateSANs(req, m, nil)).To(Succeed())
+
+	req.DNSNames = append(req.DNSNames, "worker.nodes.internal")
+	g.Expect(validateSANs(req, m, nil)).NotTo(Succeed())
+	p := newPolicy("policy", 0, machinev1.CSRApprovalActionApprove)
+	p.Spec.AllowedDNSNames = []string{"*.nodes.internal"}
+	g.Expect(validateSANs(req, m, p)).To(Succeed())
+
+	p.Spec.AllowedIPRanges = []machinev1.CIDR{"10.0.0.0/8"}
+	err := validateSANs(req, m, p)
+	g.Expect(err).To(MatchError(ContainSubstring("203.0.113.1")))
+	invalid, ok := asInvalidCSR(err)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(invalid.reason).To(Equal(DisallowedSANReason))
+
+	p.Spec.AllowedIPRanges = []machinev1.CIDR{"10.0.0.0/8", "203.0.113.0/24"}
+	g.Expect(validateSANs(req, m, p)).To(Succeed())
+
+	req.IPAddresses = append(req.IPAddresses, net.ParseIP("10.0.0.2"))
+	g.Expect(validateSANs(req, m, p)).NotTo(Succeed())
+
+	p.Spec.AllowedIPRanges = []machinev1.CIDR{"10.0.0.0"}
+	req.IPAddresses = req.IPAddresses[:1]
+	err = validateSANs(req, m, p)
+	g.Expect(err).To(HaveOccurred())
+	_, ok = asInvalidCSR(err)
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestMatchesAnyDNSPattern(t *testing.T) {
+	g := NewWithT(t)
+
+	patterns := []string{"*.nodes.internal", "api.example.com"}
+	g.Expect(matchesAnyDNSPattern(patterns, "worker.nodes.internal")).To(BeTrue())
+	g.Expect(matchesAnyDNSPattern(patterns, "Worker.Nodes.Internal")).To(BeTrue())
+	g.Expect(matchesAnyDNSPattern(patterns, "api.example.com")).To(BeTrue())
+	g.Expect(matchesAnyDNSPattern(patterns, "nodes.internal")).To(BeFalse())
+	g.Expect(matchesAnyDNSPattern(patterns, "a.worker.nodes.internal")).To(BeFalse())
+	g.Expect(matchesAnyDNSPattern(patterns, ".nodes.internal")).To(BeFalse())
+	g.Expect(matchesAnyDNSPattern(nil, "worker")).To(BeFalse())
+}
+
+func TestReconcileIgnoredCSR(t *testing.T) {
+	g := NewWithT(t)
+
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+		Status: machinev1.MachineStatus{
+			InfrastructureReady: true,
+			NodeRef:             &corev1.ObjectReference{Name: "worker"},
+		},
+	}
+	csr := newClientCSR(t, "system:node:worker", "system:nodes", "system:authenticated")
+	recorder := record.NewFakeRecorder(1)
+	r := &CSRApproverReconciler{
+		Client:   fake.NewFakeClientWithScheme(newTestScheme(), csr, m, newPolicy("ignore", 0, machinev1.CSRApprovalActionIgnore)),
+		Log:      log.NullLogger{},
+		recorder: recorder,
+	}
+	result, err := r.Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Name: csr.Name}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{}))
+	g.Expect(recorder.Events).To(Receive(HavePrefix("Normal CSRIgnored")))
+}
+
+func TestPolicyToCSRs(t *testing.T) {
+	g := NewWithT(t)
+
+	csr := newClientCSR(t, "system:node:worker", "system:nodes", "system:authenticated")
+	p := newPolicy("policy", 0, machinev1.CSRApprovalActionApprove)
+	r := &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(), csr, p), Log: log.NullLogger{}}
+	g.Expect(r.policyToCSRs(handler.MapObject{Meta: p, Object: p})).To(ConsistOf(ctrl.Request{NamespacedName: client.ObjectKey{Name: csr.Name}}))
+}
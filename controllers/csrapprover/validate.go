@@ -21,78 +21,137 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"strings"
-	"time"
 
-	"github.com/pkg/errors"
 	authorizationv1beta1 "k8s.io/api/authorization/v1beta1"
 	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
-	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
-	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util/index"
 )
 
-func (r *CSRApproverReconciler) validateCSR(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest) error {
+// validateCSR validates a CSR for a kubelet serving certificate, requested
+// by the node itself. The Machine of the node is returned along with the
+// result.
+func (r *CSRApproverReconciler) validateCSR(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest) (*machinev1.Machine, error) {
 	nodeName := strings.TrimPrefix(csr.Spec.Username, "system:node:")
-	log := r.Log.WithValues("name", csr.Name, "username", csr.Spec.Username, "groups", csr.Spec.Groups, "node", nodeName)
 
 	// check username/groups
 	if len(nodeName) == 0 {
-		log.Info("CSR has invalid username")
-		return nil
+		return nil, invalidf(InvalidRequestorReason, "username %q is not a node", csr.Spec.Username)
 	}
 	if !sets.NewString(csr.Spec.Groups...).HasAll("system:nodes", "system:authenticated") {
-		log.Info("CSR has invalid group(s)")
-		return nil
+		return nil, invalidf(InvalidRequestorReason, "node %q is not in the system:nodes group", nodeName)
 	}
 
-	// verify node exists
-	node := &corev1.Node{}
-	if err := r.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
-		return err
+	signerName := signerNameOf(csr)
+	if err := validateUsages(signerName, csr.Spec.Usages); err != nil {
+		return nil, err
 	}
 
-	// check if usage is allowed
-	for _, usage := range csr.Spec.Usages {
-		if !isUsageAllowed(usage) {
-			return errors.Errorf("usage %q not allowed", usage)
-		}
+	m, err := r.getMachine(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := r.getPolicy(ctx, signerName, m)
+	if err != nil {
+		return m, err
+	}
+	if err := checkPolicyAction(policy); err != nil {
+		return m, err
 	}
 
 	// validate DNS/IP addresses requested
-	m, err := r.getMachine(ctx, nodeName)
+	req, err := parseCertificateRequest(csr)
 	if err != nil {
-		return errors.Wrap(&mapierrors.RequeueAfterError{RequeueAfter: 5 * time.Second}, err.Error())
+		return m, err
 	}
-	addresses := sets.NewString(m.Status.NodeRef.Name)
-	for _, address := range m.Status.Addresses {
-		addresses.Insert(address.Address)
+	if signerName == certificatesv1beta1.KubeletServingSignerName {
+		if err := validateKubeletServingRequest(csr.Spec.Username, req); err != nil {
+			return m, err
+		}
 	}
-	block, _ := pem.Decode(csr.Spec.Request)
-	if block == nil {
-		log.Info("CSR missing request data")
-		return nil
+	if err := validateSANs(req, m, policy); err != nil {
+		return m, err
 	}
-	req, err := x509.ParseCertificateRequest(block.Bytes)
+
+	// perform SAR to verify requesting user has permission to create a CSR
+	return m, r.authorizeRequestor(ctx, csr, "")
+}
+
+// validateClientCSR validates a CSR for a kubelet client certificate. It is
+// requested either by the node itself, renewing its certificate, or by a
+// bootstrap identity for a Machine that has not joined the cluster yet.
+func (r *CSRApproverReconciler) validateClientCSR(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest) (*machinev1.Machine, error) {
+	if err := validateUsages(signerNameOf(csr), csr.Spec.Usages); err != nil {
+		return nil, err
+	}
+	req, err := parseCertificateRequest(csr)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, dns := range req.DNSNames {
-		if !addresses.Has(dns) {
-			return errors.Errorf("node %q not allowed to specify DNS address %q", m.Status.NodeRef.Name, dns)
-		}
+	if err := validateKubeletClientRequest(req); err != nil {
+		return nil, err
 	}
-	for _, ip := range req.IPAddresses {
-		if !addresses.Has(ip.String()) {
-			return errors.Errorf("node %q not allowed to specify IP address %q", m.Status.NodeRef.Name, ip)
+	nodeName := strings.TrimPrefix(req.Subject.CommonName, "system:node:")
+	groups := sets.NewString(csr.Spec.Groups...)
+
+	switch {
+	case csr.Spec.Username == req.Subject.CommonName:
+		if !groups.HasAll("system:nodes", "system:authenticated") {
+			return nil, invalidf(InvalidRequestorReason, "node %q is not in the system:nodes group", nodeName)
+		}
+		m, err := r.getMachine(ctx, nodeName)
+		if err != nil {
+			return nil, err
 		}
+		if err := r.checkPolicy(ctx, csr, m); err != nil {
+			return m, err
+		}
+		return m, r.authorizeRequestor(ctx, csr, "selfnodeclient")
+	case groups.Has("system:bootstrappers"):
+		m, err := r.getJoiningMachine(ctx, nodeName)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.checkPolicy(ctx, csr, m); err != nil {
+			return m, err
+		}
+		return m, r.authorizeRequestor(ctx, csr, "nodeclient")
+	}
+	return nil, invalidf(InvalidRequestorReason, "requestor %q is neither node %q nor a bootstrap identity", csr.Spec.Username, nodeName)
+}
+
+// checkPolicy returns the error for CSRs of the Machine that are not
+// approved by the action of their policy, if any.
+func (r *CSRApproverReconciler) checkPolicy(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest, m *machinev1.Machine) error {
+	policy, err := r.getPolicy(ctx, signerNameOf(csr), m)
+	if err != nil {
+		return err
 	}
+	return checkPolicyAction(policy)
+}
 
-	// perform SAR to verify requesting user has permission to create a CSR
+func parseCertificateRequest(csr *certificatesv1beta1.CertificateSigningRequest) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil {
+		return nil, invalidf(InvalidRequestReason, "CSR missing request data")
+	}
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, invalidf(InvalidRequestReason, "cannot parse certificate request: %v", err)
+	}
+	return req, nil
+}
+
+// authorizeRequestor performs a SubjectAccessReview to verify the requestor
+// of a CSR is allowed to create it, optionally for a CSR subresource such as
+// nodeclient or selfnodeclient.
+func (r *CSRApproverReconciler) authorizeRequestor(ctx context.Context, csr *certificatesv1beta1.CertificateSigningRequest, subresource string) error {
 	sar := &authorizationv1beta1.SubjectAccessReview{
 		Spec: authorizationv1beta1.SubjectAccessReviewSpec{
 			User:   csr.Spec.Username,
@@ -100,59 +159,244 @@ func (r *CSRApproverReconciler) validateCSR(ctx context.Context, csr *certificat
 			Groups: csr.Spec.Groups,
 			Extra:  make(map[string]authorizationv1beta1.ExtraValue),
 			ResourceAttributes: &authorizationv1beta1.ResourceAttributes{
-				Group:    "certificates.k8s.io",
-				Resource: "certificatesigningrequests",
-				Verb:     "create",
+				Group:       "certificates.k8s.io",
+				Resource:    "certificatesigningrequests",
+				Subresource: subresource,
+				Verb:        "create",
 			},
 		},
 	}
 	for k, v := range csr.Spec.Extra {
 		sar.Spec.Extra[k] = authorizationv1beta1.ExtraValue(v)
 	}
-	k, err := kubernetes.NewForConfig(r.config)
-	if err != nil {
-		return err
-	}
-	result, err := k.AuthorizationV1beta1().SubjectAccessReviews().Create(ctx, sar, metav1.CreateOptions{})
+	result, err := r.clientset.AuthorizationV1beta1().SubjectAccessReviews().Create(ctx, sar, metav1.CreateOptions{})
 	if err != nil {
 		return err
 	}
 	if !result.Status.Allowed {
-		return errors.New("CSR requestor failed SAR")
+		return invalidf(FailedSubjectAccessReviewReason, "requestor %q is not allowed to create the CSR: %s", csr.Spec.Username, result.Status.Reason)
 	}
 	return nil
 }
 
+// getMachine returns the Machine the node is linked to. Nodes are linked to
+// their Machine shortly after registering, so unlinked Machines matching the
+// node by provider ID or hostname are waited for.
 func (r *CSRApproverReconciler) getMachine(ctx context.Context, nodeName string) (*machinev1.Machine, error) {
+	m, err := r.getLinkedMachine(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		if !m.Status.InfrastructureReady {
+			return nil, notReadyf("infrastructure for machine %q is not yet ready", m.Name)
+		}
+		return m, nil
+	}
+	machines, err := r.listUnlinkedMachines(ctx, index.MachineHostnameField, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range machines {
+		if machineHasHostname(&m, nodeName) {
+			return nil, notReadyf("machine %q is not yet linked to node %q", m.Name, nodeName)
+		}
+	}
+	node := &corev1.Node{}
+	if err := r.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	if node.Spec.ProviderID != "" {
+		machines, err := r.listUnlinkedMachines(ctx, index.MachineProviderIDField, node.Spec.ProviderID)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range machines {
+			if m.Spec.ProviderID != nil && *m.Spec.ProviderID == node.Spec.ProviderID {
+				return nil, notReadyf("machine %q is not yet linked to node %q", m.Name, nodeName)
+			}
+		}
+	}
+	return nil, invalidf(UnknownMachineReason, "cannot find machine for node %q", nodeName)
+}
+
+// getJoiningMachine returns the Machine of a node that is still joining the
+// cluster, its infrastructure being ready but without a Node yet. The Machine
+// is matched by name or by its hostname addresses. Machines whose
+// infrastructure is not ready may not report their addresses yet, so the
+// node is only unknown once none are left.
+func (r *CSRApproverReconciler) getJoiningMachine(ctx context.Context, nodeName string) (*machinev1.Machine, error) {
+	m, err := r.getLinkedMachine(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		return nil, invalidf(InvalidRequestorReason, "node %q has already joined as machine %q", nodeName, m.Name)
+	}
+	machines, err := r.listUnlinkedMachines(ctx, index.MachineHostnameField, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range machines {
+		if !machineHasHostname(&m, nodeName) {
+			continue
+		}
+		if !m.Status.InfrastructureReady {
+			return nil, notReadyf("infrastructure for machine %q is not yet ready", m.Name)
+		}
+		return &m, nil
+	}
+	provisioning, err := r.listUnlinkedMachines(ctx, index.MachineInfrastructureReadyField, "false")
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range provisioning {
+		if !m.Status.InfrastructureReady {
+			return nil, notReadyf("cannot find joining machine for node %q", nodeName)
+		}
+	}
+	return nil, invalidf(UnknownMachineReason, "cannot find joining machine for node %q", nodeName)
+}
+
+// getLinkedMachine returns the Machine linked to the node, if any.
+func (r *CSRApproverReconciler) getLinkedMachine(ctx context.Context, nodeName string) (*machinev1.Machine, error) {
+	machines := &machinev1.MachineList{}
+	if err := r.List(ctx, machines, client.MatchingFields{index.MachineNodeNameField: nodeName}); err != nil {
+		return nil, err
+	}
+	for _, m := range machines.Items {
+		if m.Status.NodeRef != nil && m.Status.NodeRef.Name == nodeName {
+			return &m, nil
+		}
+	}
+	return nil, nil
+}
+
+// listUnlinkedMachines returns the Machines not yet linked to a Node with the
+// given value of a field index. Callers check the value again, as it is not
+// matched by every client.
+func (r *CSRApproverReconciler) listUnlinkedMachines(ctx context.Context, field, value string) ([]machinev1.Machine, error) {
 	machines := &machinev1.MachineList{}
-	if err := r.List(ctx, machines); err != nil {
+	if err := r.List(ctx, machines, client.MatchingFields{field: value}); err != nil {
 		return nil, err
 	}
+	unlinked := make([]machinev1.Machine, 0, len(machines.Items))
 	for _, m := range machines.Items {
 		if m.Status.NodeRef == nil {
-			continue
+			unlinked = append(unlinked, m)
 		}
-		if nodeName == m.Status.NodeRef.Name {
-			if !m.Status.InfrastructureReady {
-				return nil, errors.Errorf("infrastructure for machine %q is not yet ready", m.Name)
+	}
+	return unlinked, nil
+}
+
+func machineHasHostname(m *machinev1.Machine, hostname string) bool {
+	if m.Name == hostname {
+		return true
+	}
+	for _, address := range m.Status.Addresses {
+		switch address.Type {
+		case machinev1.MachineHostName, machinev1.MachineInternalDNS:
+			if address.Address == hostname {
+				return true
 			}
-			return &m, nil
 		}
 	}
-	return nil, errors.Errorf("cannot find machine for node %q", nodeName)
+	return false
 }
 
-var allowedUsages = []certificatesv1beta1.KeyUsage{
-	certificatesv1beta1.UsageDigitalSignature,
-	certificatesv1beta1.UsageKeyEncipherment,
-	certificatesv1beta1.UsageServerAuth,
+// signerUsages are the usages allowed, and required, in CSRs for the signers
+// certificates are approved for. The kubelet signers issue certificates for
+// either server or client auth, with key encipherment being optional for
+// non-RSA keys.
+var signerUsages = map[string]struct {
+	allowed, required []certificatesv1beta1.KeyUsage
+}{
+	certificatesv1beta1.LegacyUnknownSignerName: {
+		allowed: []certificatesv1beta1.KeyUsage{
+			certificatesv1beta1.UsageDigitalSignature,
+			certificatesv1beta1.UsageKeyEncipherment,
+			certificatesv1beta1.UsageServerAuth,
+		},
+	},
+	certificatesv1beta1.KubeletServingSignerName: {
+		allowed: []certificatesv1beta1.KeyUsage{
+			certificatesv1beta1.UsageDigitalSignature,
+			certificatesv1beta1.UsageKeyEncipherment,
+			certificatesv1beta1.UsageServerAuth,
+		},
+		required: []certificatesv1beta1.KeyUsage{
+			certificatesv1beta1.UsageDigitalSignature,
+			certificatesv1beta1.UsageServerAuth,
+		},
+	},
+	certificatesv1beta1.KubeAPIServerClientKubeletSignerName: {
+		allowed: []certificatesv1beta1.KeyUsage{
+			certificatesv1beta1.UsageDigitalSignature,
+			certificatesv1beta1.UsageKeyEncipherment,
+			certificatesv1beta1.UsageClientAuth,
+		},
+		required: []certificatesv1beta1.KeyUsage{
+			certificatesv1beta1.UsageDigitalSignature,
+			certificatesv1beta1.UsageClientAuth,
+		},
+	},
 }
 
-func isUsageAllowed(usage certificatesv1beta1.KeyUsage) bool {
-	for _, usageListItem := range allowedUsages {
-		if usage == usageListItem {
-			return true
+// validateUsages checks the usages of a CSR against the rules of its signer.
+func validateUsages(signerName string, usages []certificatesv1beta1.KeyUsage) error {
+	rules, ok := signerUsages[signerName]
+	if !ok {
+		return invalidf(DisallowedUsageReason, "signer %q not allowed", signerName)
+	}
+	allowed := sets.NewString()
+	for _, usage := range rules.allowed {
+		allowed.Insert(string(usage))
+	}
+	required := sets.NewString()
+	for _, usage := range rules.required {
+		required.Insert(string(usage))
+	}
+	for _, usage := range usages {
+		if !allowed.Has(string(usage)) {
+			return invalidf(DisallowedUsageReason, "usage %q not allowed", usage)
 		}
+		required.Delete(string(usage))
 	}
-	return false
+	if required.Len() > 0 {
+		return invalidf(DisallowedUsageReason, "usages %q required by signer %q", required.List(), signerName)
+	}
+	return nil
+}
+
+// validateKubeletServingRequest checks a certificate request against the
+// subject and SAN rules of the kubelet-serving signer.
+func validateKubeletServingRequest(username string, req *x509.CertificateRequest) error {
+	if len(req.Subject.Organization) != 1 || req.Subject.Organization[0] != "system:nodes" {
+		return invalidf(InvalidRequestReason, "subject organization %q is not system:nodes", req.Subject.Organization)
+	}
+	if req.Subject.CommonName != username {
+		return invalidf(InvalidRequestReason, "subject common name %q does not match username %q", req.Subject.CommonName, username)
+	}
+	if len(req.DNSNames) == 0 && len(req.IPAddresses) == 0 {
+		return invalidf(DisallowedSANReason, "at least one DNS or IP subject alternative name is required")
+	}
+	if len(req.EmailAddresses) > 0 || len(req.URIs) > 0 {
+		return invalidf(DisallowedSANReason, "email and URI subject alternative names are not allowed")
+	}
+	return nil
+}
+
+// validateKubeletClientRequest checks a certificate request against the
+// subject and SAN rules of the kube-apiserver-client-kubelet signer.
+func validateKubeletClientRequest(req *x509.CertificateRequest) error {
+	if len(req.Subject.Organization) != 1 || req.Subject.Organization[0] != "system:nodes" {
+		return invalidf(InvalidRequestReason, "subject organization %q is not system:nodes", req.Subject.Organization)
+	}
+	if !strings.HasPrefix(req.Subject.CommonName, "system:node:") || req.Subject.CommonName == "system:node:" {
+		return invalidf(InvalidRequestReason, "subject common name %q is not a node", req.Subject.CommonName)
+	}
+	if len(req.DNSNames) > 0 || len(req.IPAddresses) > 0 || len(req.EmailAddresses) > 0 || len(req.URIs) > 0 {
+		return invalidf(DisallowedSANReason, "subject alternative names are not allowed")
+	}
+	return nil
 }
@@ -0,0 +1,408 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	"github.com/criticalstack/machine-api/util/index"
+)
+
+func newTestScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(s)
+	_ = machinev1.AddToScheme(s)
+	return s
+}
+
+func newClientCSR(t *testing.T, username string, groups ...string) *certificatesv1beta1.CertificateSigningRequest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "system:node:worker", Organization: []string{"system:nodes"}},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &certificatesv1beta1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "csr"},
+		Spec: certificatesv1beta1.CertificateSigningRequestSpec{
+			Request:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+			SignerName: pointer.StringPtr(certificatesv1beta1.KubeAPIServerClientKubeletSignerName),
+			Usages:     []certificatesv1beta1.KeyUsage{certificatesv1beta1.UsageDigitalSignature, certificatesv1beta1.UsageClientAuth},
+			Username:   username,
+			Groups:     groups,
+		},
+	}
+}
+
+func TestValidateClientCSR(t *testing.T) {
+	joining := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+		Status: machinev1.MachineStatus{
+			InfrastructureReady: true,
+			Addresses:           machinev1.MachineAddresses{{Type: machinev1.MachineHostName, Address: "worker"}},
+		},
+	}
+	joined := joining.DeepCopy()
+	joined.Status.NodeRef = &corev1.ObjectReference{Name: "worker"}
+
+	t.Run("rejects other requestors", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(), joined), Log: log.NullLogger{}}
+		_, err := r.validateClientCSR(context.Background(), newClientCSR(t, "system:node:other", "system:nodes", "system:authenticated"))
+		g.Expect(err).To(MatchError(ContainSubstring("neither node")))
+		invalid, ok := asInvalidCSR(err)
+		g.Expect(ok).To(BeTrue())
+		g.Expect(invalid.reason).To(Equal(InvalidRequestorReason))
+	})
+
+	t.Run("rejects bootstrapping joined nodes", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(), joined), Log: log.NullLogger{}}
+		_, err := r.validateClientCSR(context.Background(), newClientCSR(t, "system:bootstrap:abcdef", "system:bootstrappers", "system:authenticated"))
+		g.Expect(err).To(MatchError(ContainSubstring("already joined")))
+		g.Expect(isNotReady(err)).To(BeFalse())
+	})
+
+	t.Run("waits for the machine of bootstrapping nodes", func(t *testing.T) {
+		g := NewWithT(t)
+
+		notReady := joining.DeepCopy()
+		notReady.Status.InfrastructureReady = false
+		r := &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(), notReady), Log: log.NullLogger{}}
+		_, err := r.validateClientCSR(context.Background(), newClientCSR(t, "system:bootstrap:abcdef", "system:bootstrappers", "system:authenticated"))
+		g.Expect(isNotReady(err)).To(BeTrue())
+
+		provisioning := notReady.DeepCopy()
+		provisioning.Status.Addresses = nil
+		r = &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(), provisioning), Log: log.NullLogger{}}
+		_, err = r.validateClientCSR(context.Background(), newClientCSR(t, "system:bootstrap:abcdef", "system:bootstrappers", "system:authenticated"))
+		g.Expect(isNotReady(err)).To(BeTrue())
+	})
+
+	t.Run("rejects bootstrapping unknown machines", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme()), Log: log.NullLogger{}}
+		_, err := r.validateClientCSR(context.Background(), newClientCSR(t, "system:bootstrap:abcdef", "system:bootstrappers", "system:authenticated"))
+		invalid, ok := asInvalidCSR(err)
+		g.Expect(ok).To(BeTrue())
+		g.Expect(invalid.reason).To(Equal(UnknownMachineReason))
+	})
+
+	t.Run("rejects serving usages", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(), joining), Log: log.NullLogger{}}
+		csr := newClientCSR(t, "system:node:worker", "system:nodes", "system:authenticated")
+		csr.Spec.Usages = append(csr.Spec.Usages, certificatesv1beta1.UsageServerAuth)
+		_, err := r.validateClientCSR(context.Background(), csr)
+		g.Expect(err).To(MatchError(ContainSubstring("not allowed")))
+		invalid, ok := asInvalidCSR(err)
+		g.Expect(ok).To(BeTrue())
+		g.Expect(invalid.reason).To(Equal(DisallowedUsageReason))
+	})
+}
+
+func TestGetMachine(t *testing.T) {
+	linked := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+		Spec:       machinev1.MachineSpec{ProviderID: pointer.StringPtr("docker:////worker")},
+		Status: machinev1.MachineStatus{
+			InfrastructureReady: true,
+			NodeRef:             &corev1.ObjectReference{Name: "worker"},
+		},
+	}
+	unlinked := linked.DeepCopy()
+	unlinked.Status.NodeRef = nil
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker"},
+		Spec:       corev1.NodeSpec{ProviderID: "docker:////worker"},
+	}
+
+	g := NewWithT(t)
+
+	r := &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(), linked, node), Log: log.NullLogger{}}
+	m, err := r.getMachine(context.Background(), "worker")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(m.Name).To(Equal("machine"))
+
+	r = &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(), unlinked, node), Log: log.NullLogger{}}
+	_, err = r.getMachine(context.Background(), "worker")
+	g.Expect(isNotReady(err)).To(BeTrue())
+
+	r = &CSRApproverReconciler{Client: fake.NewFakeClientWithScheme(newTestScheme(), node), Log: log.NullLogger{}}
+	_, err = r.getMachine(context.Background(), "worker")
+	invalid, ok := asInvalidCSR(err)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(invalid.reason).To(Equal(UnknownMachineReason))
+}
+
+func TestReconcileInvalidCSR(t *testing.T) {
+	g := NewWithT(t)
+
+	csr := newClientCSR(t, "system:node:other", "system:nodes", "system:authenticated")
+	recorder := record.NewFakeRecorder(1)
+	r := &CSRApproverReconciler{
+		Client:   fake.NewFakeClientWithScheme(newTestScheme(), csr),
+		Log:      log.NullLogger{},
+		recorder: recorder,
+	}
+	result, err := r.Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Name: csr.Name}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{}))
+	g.Expect(recorder.Events).To(Receive(HavePrefix("Warning CSRInvalid")))
+
+	csr = newClientCSR(t, "system:bootstrap:abcdef", "system:bootstrappers", "system:authenticated")
+	provisioning := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"}}
+	r.Client = fake.NewFakeClientWithScheme(newTestScheme(), csr, provisioning)
+	result, err = r.Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Name: csr.Name}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.Requeue).To(BeTrue())
+}
+
+func TestReconcileUnknownMachineCSR(t *testing.T) {
+	g := NewWithT(t)
+
+	csr := newClientCSR(t, "system:node:worker", "system:nodes", "system:authenticated")
+	recorder := record.NewFakeRecorder(1)
+	r := &CSRApproverReconciler{
+		Client:                fake.NewFakeClientWithScheme(newTestScheme(), csr),
+		Log:                   log.NullLogger{},
+		DenyInvalid:           true,
+		IgnoreUnknownMachines: true,
+		recorder:              recorder,
+	}
+	result, err := r.Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Name: csr.Name}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{}))
+	g.Expect(recorder.Events).NotTo(Receive())
+
+	// The CSR is left pending.
+	updated := &certificatesv1beta1.CertificateSigningRequest{}
+	g.Expect(r.Get(context.Background(), client.ObjectKey{Name: csr.Name}, updated)).To(Succeed())
+	g.Expect(updated.Status.Conditions).To(BeEmpty())
+}
+
+func TestReconcileDenyInvalidCSR(t *testing.T) {
+	t.Run("leaves client CSRs without a machine pending", func(t *testing.T) {
+		g := NewWithT(t)
+
+		csr := newClientCSR(t, "system:node:other", "system:nodes", "system:authenticated")
+		r := &CSRApproverReconciler{
+			Client:      fake.NewFakeClientWithScheme(newTestScheme(), csr),
+			Log:         log.NullLogger{},
+			DenyInvalid: true,
+			recorder:    record.NewFakeRecorder(1),
+		}
+		result, err := r.Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Name: csr.Name}})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(result).To(Equal(ctrl.Result{}))
+
+		updated := &certificatesv1beta1.CertificateSigningRequest{}
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Name: csr.Name}, updated)).To(Succeed())
+		g.Expect(updated.Status.Conditions).To(BeEmpty())
+	})
+
+	t.Run("ignores legacy client CSRs of nodes", func(t *testing.T) {
+		g := NewWithT(t)
+
+		csr := newClientCSR(t, "system:node:worker", "system:nodes", "system:authenticated")
+		csr.Spec.SignerName = nil
+		recorder := record.NewFakeRecorder(1)
+		r := &CSRApproverReconciler{
+			Client:      fake.NewFakeClientWithScheme(newTestScheme(), csr),
+			Log:         log.NullLogger{},
+			DenyInvalid: true,
+			recorder:    recorder,
+		}
+		result, err := r.Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Name: csr.Name}})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(result).To(Equal(ctrl.Result{}))
+		g.Expect(recorder.Events).NotTo(Receive())
+
+		updated := &certificatesv1beta1.CertificateSigningRequest{}
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Name: csr.Name}, updated)).To(Succeed())
+		g.Expect(updated.Status.Conditions).To(BeEmpty())
+	})
+}
+
+func TestValidateKubeletClientRequest(t *testing.T) {
+	g := NewWithT(t)
+
+	req := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:node:worker", Organization: []string{"system:nodes"}}}
+	g.Expect(validateKubeletClientRequest(req)).To(Succeed())
+
+	req.DNSNames = []string{"worker"}
+	g.Expect(validateKubeletClientRequest(req)).NotTo(Succeed())
+
+	req = &x509.CertificateRequest{Subject: pkix.Name{CommonName: "admin", Organization: []string{"system:nodes"}}}
+	g.Expect(validateKubeletClientRequest(req)).NotTo(Succeed())
+
+	req = &x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:node:worker", Organization: []string{"system:masters"}}}
+	g.Expect(validateKubeletClientRequest(req)).NotTo(Succeed())
+}
+
+// newMachineCache returns an informer cache of the given Machines, indexed
+// the way the manager cache is, served by a fake API server.
+func newMachineCache(b *testing.B, machines []machinev1.Machine, stop <-chan struct{}) cache.Cache {
+	data, err := json.Marshal(&machinev1.MachineList{
+		TypeMeta: metav1.TypeMeta{APIVersion: machinev1.GroupVersion.String(), Kind: "MachineList"},
+		ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+		Items:    machines,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Query().Get("watch") == "true" {
+			w.(http.Flusher).Flush()
+			<-req.Context().Done()
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	b.Cleanup(func() {
+		srv.CloseClientConnections()
+		srv.Close()
+	})
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(machinev1.GroupVersion.WithKind("Machine"), meta.RESTScopeNamespace)
+	c, err := cache.New(&rest.Config{Host: srv.URL}, cache.Options{Scheme: newTestScheme(), Mapper: mapper})
+	if err != nil {
+		b.Fatal(err)
+	}
+	indexes := map[string]client.IndexerFunc{
+		index.MachineNodeNameField:            index.MachineByNodeName,
+		index.MachineProviderIDField:          index.MachineByProviderID,
+		index.MachineHostnameField:            index.MachineByHostname,
+		index.MachineInfrastructureReadyField: index.MachineByInfrastructureReady,
+	}
+	for field, extractValue := range indexes {
+		if err := c.IndexField(context.Background(), &machinev1.Machine{}, field, extractValue); err != nil {
+			b.Fatal(err)
+		}
+	}
+	go func() {
+		_ = c.Start(stop)
+	}()
+	if !c.WaitForCacheSync(stop) {
+		b.Fatal("failed to sync the cache")
+	}
+	return c
+}
+
+// BenchmarkGetMachine measures finding the Machine of a node among n
+// Machines in the informer cache, of which half are linked to their Node and
+// the others are still joining. Scanning all Machines is the baseline the
+// indexed lookups replace.
+func BenchmarkGetMachine(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range []int{1000, 5000} {
+		machines := make([]machinev1.Machine, n)
+		for i := range machines {
+			nodeName := fmt.Sprintf("node-%d", i)
+			machines[i] = machinev1.Machine{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("machine-%d", i), Namespace: "default"},
+				Status: machinev1.MachineStatus{
+					InfrastructureReady: true,
+					Addresses:           machinev1.MachineAddresses{{Type: machinev1.MachineHostName, Address: nodeName}},
+				},
+			}
+			if i%2 == 0 {
+				machines[i].Status.NodeRef = &corev1.ObjectReference{Name: nodeName}
+			}
+		}
+		stop := make(chan struct{})
+		r := &CSRApproverReconciler{
+			Client: &client.DelegatingClient{Reader: newMachineCache(b, machines, stop)},
+			Log:    log.NullLogger{},
+		}
+		linked := fmt.Sprintf("node-%d", n/2)
+		joining := fmt.Sprintf("node-%d", n/2+1)
+
+		b.Run(fmt.Sprintf("scan/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				list := &machinev1.MachineList{}
+				if err := r.List(ctx, list); err != nil {
+					b.Fatal(err)
+				}
+				var found *machinev1.Machine
+				for j := range list.Items {
+					if machineHasHostname(&list.Items[j], joining) {
+						found = &list.Items[j]
+					}
+				}
+				if found == nil {
+					b.Fatal("machine not found")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("linked/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m, err := r.getLinkedMachine(ctx, linked)
+				if err != nil || m == nil {
+					b.Fatalf("machine not found: %v", err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("joining/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := r.getJoiningMachine(ctx, joining); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		close(stop)
+	}
+}
@@ -18,10 +18,12 @@ package infraprovider
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -29,6 +31,8 @@ import (
 
 	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
 	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util"
+	"github.com/criticalstack/machine-api/util/conditions"
 	"github.com/criticalstack/machine-api/util/external"
 )
 
@@ -72,6 +76,17 @@ func (r *InfrastructureProviderReconciler) Reconcile(req ctrl.Request) (ctrl.Res
 		return ctrl.Result{}, err
 	}
 
+	// Skip reconciliation while the InfrastructureProvider is paused, only
+	// reporting it.
+	if util.IsPaused(ip) {
+		r.Log.Info("Reconciliation is paused for this object", "infraprovider", ip.Name)
+		if conditions.IsTrue(ip, machinev1.PausedCondition) {
+			return ctrl.Result{}, nil
+		}
+		conditions.MarkTrue(ip, machinev1.PausedCondition)
+		return ctrl.Result{}, r.Status().Update(ctx, ip)
+	}
+
 	obj, err := r.reconcileExternal(ctx, ip, &ip.Spec.InfrastructureRef)
 	if err != nil {
 		if requeueErr, ok := errors.Cause(err).(mapierrors.HasRequeueAfterError); ok {
@@ -79,8 +94,19 @@ func (r *InfrastructureProviderReconciler) Reconcile(req ctrl.Request) (ctrl.Res
 		}
 		return ctrl.Result{}, err
 	}
+	if util.IsPaused(obj) {
+		r.Log.Info("Infrastructure is paused", "infraprovider", ip.Name, "kind", obj.GetKind(), "name", obj.GetName())
+		conditions.Set(ip, &machinev1.Condition{
+			Type:    machinev1.PausedCondition,
+			Status:  corev1.ConditionTrue,
+			Reason:  machinev1.InfrastructurePausedReason,
+			Message: fmt.Sprintf("%v %q is paused", obj.GetKind(), obj.GetName()),
+		})
+		return ctrl.Result{}, r.Status().Update(ctx, ip)
+	}
+	conditions.Delete(ip, machinev1.PausedCondition)
 	if !obj.GetDeletionTimestamp().IsZero() {
-		return ctrl.Result{}, nil
+		return ctrl.Result{}, r.Status().Update(ctx, ip)
 	}
 	ready, err := external.IsReady(obj)
 	if err != nil {
@@ -28,6 +28,7 @@ import (
 
 	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
 	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util"
 	"github.com/criticalstack/machine-api/util/external"
 	"github.com/criticalstack/machine-api/util/patch"
 )
@@ -45,6 +46,15 @@ func (r *InfrastructureProviderReconciler) reconcileExternal(ctx context.Context
 		return nil, err
 	}
 
+	// Leave paused external objects untouched, only watching them to be
+	// notified when they are unpaused.
+	if util.IsPaused(obj) {
+		if err := r.externalTracker.Watch(logger, obj, &handler.EnqueueRequestForOwner{OwnerType: &machinev1.InfrastructureProvider{}}); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	}
+
 	// Initialize the patch helper.
 	patchHelper, err := patch.NewHelper(obj, r.Client)
 	if err != nil {
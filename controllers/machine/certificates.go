@@ -0,0 +1,116 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util/conditions"
+)
+
+const (
+	servingCertificate = "serving"
+	clientCertificate  = "client"
+)
+
+var certificateExpiryGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "machine_api_node_certificate_expiry_timestamp_seconds",
+		Help: "Time the kubelet certificates of the node of a machine expire, in seconds since the epoch.",
+	},
+	[]string{"namespace", "machine", "type"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(certificateExpiryGauge)
+}
+
+// reconcileCertificateExpiry reports the expiry of the kubelet certificates
+// of the Node, recorded by the CSR approver, through the
+// CertificateExpiringSoon condition and the certificate expiry gauge. The
+// Machine is requeued for the condition to be raised once the soonest
+// certificate is within the threshold.
+func (r *MachineReconciler) reconcileCertificateExpiry(m *machinev1.Machine) error {
+	certs := m.Status.NodeCertificates
+	if certs == nil {
+		deleteCertificateExpiryMetrics(m.Namespace, m.Name)
+		conditions.Delete(m, machinev1.CertificateExpiringSoonCondition)
+		return nil
+	}
+	expiries := []struct {
+		certType string
+		reason   string
+		notAfter *metav1.Time
+	}{
+		{servingCertificate, machinev1.ServingCertificateExpiringReason, certs.ServingNotAfter},
+		{clientCertificate, machinev1.ClientCertificateExpiringReason, certs.ClientNotAfter},
+	}
+	var soonest *metav1.Time
+	reason, certType := "", ""
+	for _, e := range expiries {
+		if e.notAfter == nil {
+			certificateExpiryGauge.DeleteLabelValues(m.Namespace, m.Name, e.certType)
+			continue
+		}
+		certificateExpiryGauge.WithLabelValues(m.Namespace, m.Name, e.certType).Set(float64(e.notAfter.Unix()))
+		if soonest == nil || e.notAfter.Before(soonest) {
+			soonest, reason, certType = e.notAfter, e.reason, e.certType
+		}
+	}
+	if r.CertificateExpiryThreshold <= 0 || soonest == nil {
+		conditions.Delete(m, machinev1.CertificateExpiringSoonCondition)
+		return nil
+	}
+
+	remaining := time.Until(soonest.Time)
+	if remaining > r.CertificateExpiryThreshold {
+		conditions.Set(m, &machinev1.Condition{
+			Type:   machinev1.CertificateExpiringSoonCondition,
+			Status: corev1.ConditionFalse,
+		})
+		return errors.Wrapf(&mapierrors.RequeueAfterError{RequeueAfter: remaining - r.CertificateExpiryThreshold},
+			"%s certificate of Machine %q in namespace %q expires at %s", certType, m.Name, m.Namespace, soonest.UTC().Format(time.RFC3339))
+	}
+	message := fmt.Sprintf("%s certificate of node expires at %s", certType, soonest.UTC().Format(time.RFC3339))
+	if remaining <= 0 {
+		message = fmt.Sprintf("%s certificate of node expired at %s", certType, soonest.UTC().Format(time.RFC3339))
+	}
+	if !conditions.IsTrue(m, machinev1.CertificateExpiringSoonCondition) {
+		r.recorder.Event(m, corev1.EventTypeWarning, "CertificateExpiringSoon", message)
+	}
+	conditions.Set(m, &machinev1.Condition{
+		Type:    machinev1.CertificateExpiringSoonCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+	return nil
+}
+
+func deleteCertificateExpiryMetrics(namespace, name string) {
+	certificateExpiryGauge.DeleteLabelValues(namespace, name, servingCertificate)
+	certificateExpiryGauge.DeleteLabelValues(namespace, name, clientCertificate)
+}
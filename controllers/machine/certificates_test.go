@@ -0,0 +1,70 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util/conditions"
+)
+
+func TestReconcileCertificateExpiry(t *testing.T) {
+	g := NewWithT(t)
+
+	recorder := record.NewFakeRecorder(2)
+	r := &MachineReconciler{CertificateExpiryThreshold: 7 * 24 * time.Hour, recorder: recorder}
+	m := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "expiry", Namespace: "default"}}
+	g.Expect(r.reconcileCertificateExpiry(m)).To(Succeed())
+	g.Expect(conditions.Get(m, machinev1.CertificateExpiringSoonCondition)).To(BeNil())
+
+	serving := metav1.NewTime(time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second))
+	client := metav1.NewTime(time.Now().Add(60 * 24 * time.Hour).Truncate(time.Second))
+	m.Status.NodeCertificates = &machinev1.NodeCertificatesStatus{ServingNotAfter: &serving, ClientNotAfter: &client}
+	err := r.reconcileCertificateExpiry(m)
+	g.Expect(mapierrors.IsRequeueAfter(err)).To(BeTrue())
+	g.Expect(conditions.Get(m, machinev1.CertificateExpiringSoonCondition).Status).To(Equal(corev1.ConditionFalse))
+	g.Expect(testutil.ToFloat64(certificateExpiryGauge.WithLabelValues("default", "expiry", servingCertificate))).To(Equal(float64(serving.Unix())))
+	g.Expect(testutil.ToFloat64(certificateExpiryGauge.WithLabelValues("default", "expiry", clientCertificate))).To(Equal(float64(client.Unix())))
+
+	client = metav1.NewTime(time.Now().Add(24 * time.Hour))
+	g.Expect(r.reconcileCertificateExpiry(m)).To(Succeed())
+	c := conditions.Get(m, machinev1.CertificateExpiringSoonCondition)
+	g.Expect(c.Status).To(Equal(corev1.ConditionTrue))
+	g.Expect(c.Reason).To(Equal(machinev1.ClientCertificateExpiringReason))
+	g.Expect(recorder.Events).To(Receive(HavePrefix("Warning CertificateExpiringSoon")))
+
+	// The event is only recorded when the condition is raised.
+	g.Expect(r.reconcileCertificateExpiry(m)).To(Succeed())
+	g.Expect(recorder.Events).NotTo(Receive())
+
+	r.CertificateExpiryThreshold = 0
+	g.Expect(r.reconcileCertificateExpiry(m)).To(Succeed())
+	g.Expect(conditions.Get(m, machinev1.CertificateExpiringSoonCondition)).To(BeNil())
+
+	deleteCertificateExpiryMetrics(m.Namespace, m.Name)
+	g.Expect(testutil.CollectAndCount(certificateExpiryGauge)).To(Equal(0))
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -33,10 +34,17 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
 	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util"
+	"github.com/criticalstack/machine-api/util/conditions"
 	"github.com/criticalstack/machine-api/util/external"
+	"github.com/criticalstack/machine-api/util/index"
 	"github.com/criticalstack/machine-api/util/patch"
 )
 
@@ -45,6 +53,58 @@ type MachineReconciler struct {
 	client.Client
 	Log logr.Logger
 
+	// InfrastructureDeleteTimeout is the amount of time to wait for the
+	// infrastructure object of a deleted Machine to be gone before moving on
+	// without it. Zero means waiting forever.
+	InfrastructureDeleteTimeout time.Duration
+
+	// EtcdClientSecret references the Secret holding the etcd client
+	// certificates used to remove the etcd member of a deleted control plane
+	// Machine. Member removal is disabled when no Secret is set.
+	EtcdClientSecret client.ObjectKey
+
+	// EtcdEndpoints are the etcd client URLs to connect to. When empty, the
+	// InternalIPs of the remaining control plane Nodes are used.
+	EtcdEndpoints []string
+
+	// MinControlPlaneMachines is the minimum number of healthy control plane
+	// Machines that must remain when a control plane Machine is deleted. The
+	// deletion is blocked while it would leave fewer. Zero disables the check.
+	MinControlPlaneMachines int
+
+	// AllowedInfrastructureNamespaces are the namespaces, besides their own,
+	// that Machines may reference infrastructure objects in.
+	AllowedInfrastructureNamespaces []string
+
+	// CertificateExpiryThreshold is the time before the expiry of a kubelet
+	// certificate of its Node that the CertificateExpiringSoon condition of
+	// a Machine is raised. Zero disables the condition.
+	CertificateExpiryThreshold time.Duration
+
+	// DrainTimeout is the time to wait for the pods of a Node to be evicted
+	// before requeuing, for Machines that do not set Spec.Drain.Timeout.
+	// Defaults to 20s.
+	DrainTimeout time.Duration
+
+	// NodeDrainTimeout is the total time draining a Node may take, for
+	// Machines that do not set Spec.NodeDrainTimeout. Zero waits forever.
+	NodeDrainTimeout time.Duration
+
+	// DeleteHookRequeue, ControlPlaneDeletionRequeue,
+	// EtcdMemberRemovalRequeue and InfrastructureDeletionRequeue are the
+	// times between checks of the lifecycle hooks, the control plane
+	// deletion gate, the etcd quorum and the infrastructure deletion a
+	// deleted Machine waits on. Zero uses the external ready wait.
+	DeleteHookRequeue             time.Duration
+	ControlPlaneDeletionRequeue   time.Duration
+	EtcdMemberRemovalRequeue      time.Duration
+	InfrastructureDeletionRequeue time.Duration
+
+	// apiReader reads objects that are not worth caching, such as the
+	// control plane deletion Lease and the etcd client Secret, from the API
+	// server.
+	apiReader client.Reader
+
 	config          *rest.Config
 	externalTracker external.ObjectTracker
 	recorder        record.EventRecorder
@@ -56,12 +116,25 @@ type MachineReconciler struct {
 func (r *MachineReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options, externalReadyWait time.Duration) error {
 	controller, err := ctrl.NewControllerManagedBy(mgr).
 		For(&machinev1.Machine{}).
+		Watches(
+			&source.Kind{Type: &corev1.Node{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.nodeToMachines)},
+		).
+		Watches(
+			&source.Kind{Type: &machinev1.Config{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.configToMachines)},
+		).
+		Watches(
+			&source.Kind{Type: &machinev1.MachineClass{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.machineClassToMachines)},
+		).
 		WithOptions(options).
 		Build(r)
 	if err != nil {
 		return errors.Wrap(err, "failed setting up with a controller manager")
 	}
 
+	r.apiReader = mgr.GetAPIReader()
 	r.config = mgr.GetConfig()
 	r.scheme = mgr.GetScheme()
 	r.recorder = mgr.GetEventRecorderFor("machine-controller")
@@ -69,14 +142,84 @@ func (r *MachineReconciler) SetupWithManager(mgr ctrl.Manager, options controlle
 		Controller: controller,
 	}
 	r.externalReadyWait = externalReadyWait
+
+	if err := metrics.Registry.Register(&machineCollector{client: mgr.GetClient(), log: r.Log}); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			return errors.Wrap(err, "failed registering machine metrics")
+		}
+	}
 	return nil
 }
 
+// nodeToMachines maps Node events to reconcile requests for the Machines
+// referencing the Node, so that changes in Node health are reflected in the
+// Machine phase.
+func (r *MachineReconciler) nodeToMachines(o handler.MapObject) []reconcile.Request {
+	machines := &machinev1.MachineList{}
+	if err := r.List(context.Background(), machines, client.MatchingFields{index.MachineNodeNameField: o.Meta.GetName()}); err != nil {
+		r.Log.Error(err, "cannot list machines for node", "node", o.Meta.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0)
+	for _, m := range machines.Items {
+		if m.Status.NodeRef != nil && m.Status.NodeRef.Name == o.Meta.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: client.ObjectKey{Name: m.Name, Namespace: m.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// configToMachines maps Config events to reconcile requests for the Machines
+// referencing the Config, so that failures reported by the Config are
+// reflected on the Machine.
+func (r *MachineReconciler) configToMachines(o handler.MapObject) []reconcile.Request {
+	key := o.Meta.GetNamespace() + "/" + o.Meta.GetName()
+	machines := &machinev1.MachineList{}
+	if err := r.List(context.Background(), machines, client.MatchingFields{index.MachineConfigRefField: key}); err != nil {
+		r.Log.Error(err, "cannot list machines for config", "config", o.Meta.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0)
+	for _, m := range machines.Items {
+		if index.ConfigRefKey(&m) == key {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: client.ObjectKey{Name: m.Name, Namespace: m.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// machineClassToMachines maps MachineClass events to reconcile requests for
+// the Machines of the class, so that changes to the class are reported on
+// the Machine.
+func (r *MachineReconciler) machineClassToMachines(o handler.MapObject) []reconcile.Request {
+	machines := &machinev1.MachineList{}
+	if err := r.List(context.Background(), machines, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "cannot list machines for machine class", "machineclass", o.Meta.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0)
+	for _, m := range machines.Items {
+		if m.Spec.MachineClassName == o.Meta.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: client.ObjectKey{Name: m.Name, Namespace: m.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
 // +kubebuilder:rbac:groups=machine.crit.sh,resources=machines,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=machine.crit.sh,resources=machines/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=machine.crit.sh,resources=configs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=machine.crit.sh,resources=machineclasses,verbs=get;list;watch
 // +kubebuilder:rbac:groups=infrastructure.crit.sh,resources=*,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=events,verbs=get;list;watch;create;patch
 // +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;delete
 // +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
@@ -90,50 +233,72 @@ func (r *MachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr e
 	m := &machinev1.Machine{}
 	if err := r.Get(ctx, req.NamespacedName, m); err != nil {
 		if apierrors.IsNotFound(err) {
+			deleteCertificateExpiryMetrics(req.Namespace, req.Name)
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, err
 	}
 
-	// Handle deletion reconciliation loop.
-	if !m.ObjectMeta.DeletionTimestamp.IsZero() {
-		if m.Status.Phase != machinev1.MachineTerminating {
-			m.Status.Phase = machinev1.MachineTerminating
-			if err := r.Status().Update(ctx, m); err != nil {
-				return ctrl.Result{}, err
-			}
-		}
-		if res, err := r.reconcileDelete(ctx, m); err != nil {
-			return res, err
-		}
-		controllerutil.RemoveFinalizer(m, machinev1.MachineFinalizer)
-		if err := r.Update(ctx, m); err != nil {
-			return ctrl.Result{}, err
-		}
-		return ctrl.Result{}, nil
-	}
-
 	// Patch any changes to Machine object on each reconciliation.
 	patchHelper, err := patch.NewHelper(m, r.Client)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
+	var finalized bool
 	defer func() {
-		r.reconcilePhase(ctx, m)
+		// The phase of a paused Machine is left as it is.
+		if !util.IsPaused(m) {
+			r.reconcilePhase(ctx, m)
+		}
 		if err := patchHelper.Patch(ctx, m); err != nil {
 			if reterr == nil {
 				reterr = err
 			}
+			return
+		}
+		// The deletion is only done once the finalizer removal is patched.
+		if finalized {
+			machineDeletionDuration.Observe(time.Since(m.DeletionTimestamp.Time).Seconds())
 		}
 	}()
 
+	// Skip reconciliation while the Machine is paused, only reporting it.
+	if util.IsPaused(m) {
+		log.Info("Reconciliation is paused for this object")
+		conditions.MarkTrue(m, machinev1.PausedCondition)
+		return ctrl.Result{}, nil
+	}
+	conditions.Delete(m, machinev1.PausedCondition)
+
+	// Handle deletion reconciliation loop.
+	if !m.ObjectMeta.DeletionTimestamp.IsZero() {
+		r.setPhase(m, machinev1.MachineTerminating)
+		if err := r.reconcileDelete(ctx, m); err != nil {
+			if requeueErr, ok := errors.Cause(err).(mapierrors.HasRequeueAfterError); ok {
+				log.V(1).Info("Deletion of Machine asked to requeue", "err", err.Error())
+				return ctrl.Result{RequeueAfter: requeueErr.GetRequeueAfter()}, nil
+			}
+			return ctrl.Result{}, err
+		}
+		controllerutil.RemoveFinalizer(m, machinev1.MachineFinalizer)
+		finalized = true
+		return ctrl.Result{}, nil
+	}
+
 	// If the Machine doesn't have a finalizer, add one.
 	controllerutil.AddFinalizer(m, machinev1.MachineFinalizer)
 
+	// Clear the failure if an operator has asked for it.
+	r.reconcileClearFailure(m)
+
 	// Call the inner reconciliation methods.
 	reconciliationErrors := []error{
+		r.reconcileMachineClass(ctx, m),
+		r.reconcileConfig(ctx, m),
 		r.reconcileInfrastructure(ctx, m),
 		r.reconcileNodeRef(ctx, m),
+		r.reconcileNodeMetadata(ctx, m),
+		r.reconcileCertificateExpiry(m),
 	}
 
 	// Parse the errors, making sure we record if there is a RequeueAfterError.
@@ -154,11 +319,18 @@ func (r *MachineReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr e
 	return res, kerrors.NewAggregate(errs)
 }
 
-func (r *MachineReconciler) reconcileDelete(ctx context.Context, m *machinev1.Machine) (ctrl.Result, error) {
+func (r *MachineReconciler) reconcileDelete(ctx context.Context, m *machinev1.Machine) error {
 	logger := r.Log.WithValues("machine", m.Name, "namespace", m.Namespace)
-	if m.Status.NodeRef == nil {
-		logger.Info("machine does not have NodeRef")
-		return ctrl.Result{}, nil
+
+	// Wait for other controllers to finish their cleanup before the Node is
+	// drained.
+	if err := r.reconcileDeleteHooks(m, machinev1.PreDrainDeleteHookAnnotationPrefix, machinev1.PreDrainDeleteHookSucceededCondition); err != nil {
+		return err
+	}
+
+	// Remove control plane Machines one at a time.
+	if err := r.reconcileControlPlaneDeletionGate(ctx, m); err != nil {
+		return err
 	}
 
 	err := r.isDeleteNodeAllowed(ctx, m)
@@ -168,29 +340,39 @@ func (r *MachineReconciler) reconcileDelete(ctx context.Context, m *machinev1.Ma
 		case errNoControlPlaneNodes, errLastControlPlaneNode, errNilNodeRef:
 			logger.Info("Deleting Kubernetes Node associated with Machine is not allowed", "node", m.Status.NodeRef, "cause", err)
 		default:
-			return ctrl.Result{}, errors.Wrapf(err, "failed to check if Kubernetes Node deletion is allowed")
+			return errors.Wrapf(err, "failed to check if Kubernetes Node deletion is allowed")
 		}
 	}
 
 	if isDeleteNodeAllowed {
+		// Remove the etcd member before the control plane Node goes away.
+		if err := r.reconcileEtcdMember(ctx, m); err != nil {
+			return err
+		}
+
 		// Drain node before deletion.
-		logger.Info("Draining node", "node", m.Status.NodeRef.Name)
-		if err := r.drainNode(ctx, m.Status.NodeRef.Name); err != nil {
-			r.recorder.Eventf(m, corev1.EventTypeWarning, "FailedDrainNode", "error draining Machine's node %q: %v", m.Status.NodeRef.Name, err)
-			return ctrl.Result{}, err
+		if err := r.reconcileDrain(ctx, m); err != nil {
+			return err
 		}
-		r.recorder.Eventf(m, corev1.EventTypeNormal, "SuccessfulDrainNode", "success draining Machine's node %q", m.Status.NodeRef.Name)
+	}
+
+	// Wait for other controllers to finish their cleanup before the
+	// infrastructure is deleted.
+	if err := r.reconcileDeleteHooks(m, machinev1.PreTerminateDeleteHookAnnotationPrefix, machinev1.PreTerminateDeleteHookSucceededCondition); err != nil {
+		return err
 	}
 
 	if err := r.reconcileDeleteExternal(ctx, m); err != nil {
 		// Return early and don't remove the finalizer if we got an error or
 		// the external reconciliation deletion isn't ready.
-		return ctrl.Result{}, err
+		return err
 	}
 
 	// We only delete the node after the underlying infrastructure is gone.
 	// https://github.com/kubernetes-sigs/cluster-api/issues/2565
-	if isDeleteNodeAllowed {
+	if !isDeleteNodeAllowed {
+		conditions.Delete(m, machinev1.NodeDeletedCondition)
+	} else {
 		logger.Info("Deleting node", "node", m.Status.NodeRef.Name)
 
 		var deleteNodeErr error
@@ -203,8 +385,11 @@ func (r *MachineReconciler) reconcileDelete(ctx context.Context, m *machinev1.Ma
 		if waitErr != nil {
 			logger.Error(deleteNodeErr, "Timed out deleting node, moving on", "node", m.Status.NodeRef.Name)
 			r.recorder.Eventf(m, corev1.EventTypeWarning, "FailedDeleteNode", "error deleting Machine's node: %v", deleteNodeErr)
+			conditions.MarkFalse(m, machinev1.NodeDeletedCondition, machinev1.DeletionFailedReason, "error deleting node %q: %v", m.Status.NodeRef.Name, deleteNodeErr)
+		} else {
+			conditions.MarkTrue(m, machinev1.NodeDeletedCondition)
 		}
 	}
 
-	return ctrl.Result{}, nil
+	return r.releaseControlPlaneDeletionLease(ctx, m)
 }
@@ -0,0 +1,110 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	"github.com/criticalstack/machine-api/util/conditions"
+)
+
+func newTestScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = machinev1.AddToScheme(scheme)
+	return scheme
+}
+
+func TestReconcilePaused(t *testing.T) {
+	g := NewWithT(t)
+
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "machine",
+			Namespace:   "default",
+			Annotations: map[string]string{machinev1.PausedAnnotation: ""},
+		},
+	}
+	c := fake.NewFakeClientWithScheme(newTestScheme(), m)
+	r := &MachineReconciler{
+		Client:   c,
+		Log:      log.NullLogger{},
+		recorder: record.NewFakeRecorder(10),
+	}
+	key := client.ObjectKey{Name: m.Name, Namespace: m.Namespace}
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	m = &machinev1.Machine{}
+	g.Expect(c.Get(context.Background(), key, m)).To(Succeed())
+	g.Expect(conditions.IsTrue(m, machinev1.PausedCondition)).To(BeTrue())
+	g.Expect(m.Finalizers).To(BeEmpty())
+	g.Expect(m.Status.Phase).To(BeEmpty())
+
+	// Unpausing removes the condition and resumes reconciliation.
+	delete(m.Annotations, machinev1.PausedAnnotation)
+	g.Expect(c.Update(context.Background(), m)).To(Succeed())
+	_, err = r.Reconcile(ctrl.Request{NamespacedName: key})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	m = &machinev1.Machine{}
+	g.Expect(c.Get(context.Background(), key, m)).To(Succeed())
+	g.Expect(conditions.Get(m, machinev1.PausedCondition)).To(BeNil())
+	g.Expect(m.Finalizers).To(ContainElement(machinev1.MachineFinalizer))
+	g.Expect(m.Status.Phase).To(Equal(machinev1.MachinePending))
+}
+
+func TestConfigToMachines(t *testing.T) {
+	g := NewWithT(t)
+
+	newMachine := func(name, namespace string, ref corev1.ObjectReference) *machinev1.Machine {
+		return &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       machinev1.MachineSpec{ConfigRef: ref},
+		}
+	}
+	cfg := &machinev1.Config{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"}}
+	r := &MachineReconciler{
+		Client: fake.NewFakeClientWithScheme(newTestScheme(),
+			newMachine("same-namespace", "default", corev1.ObjectReference{Name: "config"}),
+			newMachine("other-namespace", "other", corev1.ObjectReference{Name: "config", Namespace: "default"}),
+			newMachine("other-config", "default", corev1.ObjectReference{Name: "other"}),
+			newMachine("unrelated", "other", corev1.ObjectReference{Name: "config"}),
+		),
+		Log: log.NullLogger{},
+	}
+	g.Expect(r.configToMachines(handler.MapObject{Meta: cfg, Object: cfg})).To(ConsistOf(
+		reconcile.Request{NamespacedName: client.ObjectKey{Name: "same-namespace", Namespace: "default"}},
+		reconcile.Request{NamespacedName: client.ObjectKey{Name: "other-namespace", Namespace: "other"}},
+	))
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	"github.com/criticalstack/machine-api/util"
+	"github.com/criticalstack/machine-api/util/conditions"
+)
+
+// controlPlaneDeletionLeaseName is the name of the Lease, in the namespace of
+// the Machines, that serializes the removal of control plane Machines. It is
+// read from the API server, as caching it would watch every Lease of the
+// cluster, including the Node heartbeats.
+const controlPlaneDeletionLeaseName = "machine-api-control-plane-deletion"
+
+// reconcileControlPlaneDeletionGate allows a control plane Machine that is
+// being deleted to proceed only while it holds the control plane deletion
+// Lease, so that at most one control plane removal is in flight at a time.
+// Removals that would leave fewer than MinControlPlaneMachines healthy control
+// plane Machines are refused, releasing the Lease so that a refused Machine
+// does not block the others.
+func (r *MachineReconciler) reconcileControlPlaneDeletionGate(ctx context.Context, m *machinev1.Machine) error {
+	if !isControlPlaneMachine(m) {
+		return nil
+	}
+	log := r.Log.WithValues("machine", m.Name, "namespace", m.Namespace)
+
+	holder, err := r.acquireControlPlaneDeletionLease(ctx, m)
+	if err != nil {
+		return err
+	}
+	if holder != m.Name {
+		log.Info("Waiting for the deletion of another control plane machine", "holder", holder)
+		conditions.MarkFalse(m, machinev1.ControlPlaneDeletionAllowedCondition, machinev1.ControlPlaneDeletionInProgressReason, "waiting for the deletion of control plane machine %q", holder)
+		return r.requeueAfter(r.ControlPlaneDeletionRequeue)
+	}
+
+	if r.MinControlPlaneMachines > 0 {
+		healthy, err := r.healthyControlPlaneMachines(ctx, m)
+		if err != nil {
+			return err
+		}
+		if healthy < r.MinControlPlaneMachines {
+			log.Info("Refusing to remove control plane machine", "healthy", healthy, "minimum", r.MinControlPlaneMachines)
+			r.recorder.Eventf(m, corev1.EventTypeWarning, "ControlPlaneQuorumAtRisk", "refusing to remove control plane machine, %d healthy control plane machines would remain, minimum is %d", healthy, r.MinControlPlaneMachines)
+			conditions.MarkFalse(m, machinev1.ControlPlaneDeletionAllowedCondition, machinev1.ControlPlaneQuorumAtRiskReason, "%d healthy control plane machines would remain, minimum is %d", healthy, r.MinControlPlaneMachines)
+			if err := r.releaseControlPlaneDeletionLease(ctx, m); err != nil {
+				return err
+			}
+			return r.requeueAfter(r.ControlPlaneDeletionRequeue)
+		}
+	}
+	conditions.MarkTrue(m, machinev1.ControlPlaneDeletionAllowedCondition)
+	return nil
+}
+
+// acquireControlPlaneDeletionLease tries to acquire the control plane
+// deletion Lease for the Machine and returns the name of the Machine holding
+// it. The Lease is taken over when its holder no longer exists.
+func (r *MachineReconciler) acquireControlPlaneDeletionLease(ctx context.Context, m *machinev1.Machine) (string, error) {
+	lease := &coordinationv1.Lease{}
+	key := client.ObjectKey{Namespace: m.Namespace, Name: controlPlaneDeletionLeaseName}
+	if err := r.apiReader.Get(ctx, key, lease); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return "", errors.Wrap(err, "failed to get control plane deletion lease")
+		}
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+		}
+		setLeaseHolder(lease, m.Name)
+		if err := r.Create(ctx, lease); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				return "", r.requeueAfter(r.ControlPlaneDeletionRequeue)
+			}
+			return "", errors.Wrap(err, "failed to create control plane deletion lease")
+		}
+		return m.Name, nil
+	}
+
+	holder := ""
+	if lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+	if holder == m.Name {
+		return holder, nil
+	}
+	if holder != "" {
+		held, err := r.isControlPlaneDeletionHolder(ctx, m.Namespace, holder)
+		if err != nil {
+			return "", err
+		}
+		if held {
+			return holder, nil
+		}
+	}
+
+	// The update is rejected with a conflict if another Machine took over
+	// the Lease in the meantime.
+	setLeaseHolder(lease, m.Name)
+	if err := r.Update(ctx, lease); err != nil {
+		if apierrors.IsConflict(err) {
+			return "", r.requeueAfter(r.ControlPlaneDeletionRequeue)
+		}
+		return "", errors.Wrap(err, "failed to update control plane deletion lease")
+	}
+	return m.Name, nil
+}
+
+// isControlPlaneDeletionHolder reports whether the named Machine still exists
+// and is being deleted, and so still holds the control plane deletion Lease.
+// A paused Machine does not, as its deletion makes no progress.
+func (r *MachineReconciler) isControlPlaneDeletionHolder(ctx context.Context, namespace, name string) (bool, error) {
+	holder := &machinev1.Machine{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, holder); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return !holder.DeletionTimestamp.IsZero() && !util.IsPaused(holder), nil
+}
+
+// releaseControlPlaneDeletionLease releases the control plane deletion Lease
+// if it is held by the Machine.
+func (r *MachineReconciler) releaseControlPlaneDeletionLease(ctx context.Context, m *machinev1.Machine) error {
+	if !isControlPlaneMachine(m) {
+		return nil
+	}
+	lease := &coordinationv1.Lease{}
+	if err := r.apiReader.Get(ctx, client.ObjectKey{Namespace: m.Namespace, Name: controlPlaneDeletionLeaseName}, lease); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != m.Name {
+		return nil
+	}
+	if err := r.Delete(ctx, lease, client.Preconditions{ResourceVersion: &lease.ResourceVersion}); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "failed to release control plane deletion lease")
+	}
+	return nil
+}
+
+func setLeaseHolder(lease *coordinationv1.Lease, holder string) {
+	now := metav1.NewMicroTime(metav1.Now().Time)
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+}
+
+// healthyControlPlaneMachines returns the number of control plane Machines,
+// other than the given one, whose Node is Ready.
+func (r *MachineReconciler) healthyControlPlaneMachines(ctx context.Context, m *machinev1.Machine) (int, error) {
+	machineList := &machinev1.MachineList{}
+	if err := r.List(ctx, machineList, client.InNamespace(m.Namespace)); err != nil {
+		return 0, err
+	}
+	healthy := 0
+	for i := range machineList.Items {
+		cp := &machineList.Items[i]
+		if cp.Name == m.Name || !isControlPlaneMachine(cp) || cp.Status.NodeRef == nil {
+			continue
+		}
+		node := &corev1.Node{}
+		if err := r.Get(ctx, client.ObjectKey{Name: cp.Status.NodeRef.Name}, node); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return 0, err
+		}
+		if nodeReadyStatus(node) == corev1.ConditionTrue {
+			healthy++
+		}
+	}
+	return healthy, nil
+}
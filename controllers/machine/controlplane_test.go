@@ -0,0 +1,169 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util/conditions"
+)
+
+func newControlPlaneMachine(name string, ready corev1.ConditionStatus) (*machinev1.Machine, *corev1.Node) {
+	now := metav1.Now()
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			Labels:            map[string]string{machinev1.MachineControlPlaneLabelName: ""},
+			DeletionTimestamp: &now,
+		},
+		Status: machinev1.MachineStatus{
+			NodeRef: &corev1.ObjectReference{Kind: "Node", Name: name},
+		},
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+		},
+	}
+	return m, node
+}
+
+func TestControlPlaneDeletionGate(t *testing.T) {
+	g := NewWithT(t)
+
+	cp1, node1 := newControlPlaneMachine("cp-1", corev1.ConditionTrue)
+	cp2, node2 := newControlPlaneMachine("cp-2", corev1.ConditionTrue)
+	cp3, node3 := newControlPlaneMachine("cp-3", corev1.ConditionTrue)
+	c := fake.NewFakeClientWithScheme(newTestScheme(), cp1, node1, cp2, node2, cp3, node3)
+	r := &MachineReconciler{
+		Client:            c,
+		Log:               log.NullLogger{},
+		apiReader:         c,
+		recorder:          record.NewFakeRecorder(10),
+		externalReadyWait: time.Second,
+	}
+	ctx := context.Background()
+
+	// Only the first control plane Machine may proceed.
+	g.Expect(r.reconcileControlPlaneDeletionGate(ctx, cp1)).To(Succeed())
+	g.Expect(conditions.IsTrue(cp1, machinev1.ControlPlaneDeletionAllowedCondition)).To(BeTrue())
+	g.Expect(r.reconcileControlPlaneDeletionGate(ctx, cp2)).To(BeAssignableToTypeOf(&mapierrors.RequeueAfterError{}))
+	g.Expect(conditions.Get(cp2, machinev1.ControlPlaneDeletionAllowedCondition).Reason).To(Equal(machinev1.ControlPlaneDeletionInProgressReason))
+	g.Expect(r.reconcileControlPlaneDeletionGate(ctx, cp1)).To(Succeed())
+
+	// Releasing the Lease lets the next one in.
+	g.Expect(r.releaseControlPlaneDeletionLease(ctx, cp1)).To(Succeed())
+	g.Expect(c.Delete(ctx, cp1)).To(Succeed())
+	g.Expect(c.Delete(ctx, node1)).To(Succeed())
+	g.Expect(r.reconcileControlPlaneDeletionGate(ctx, cp2)).To(Succeed())
+	g.Expect(r.reconcileControlPlaneDeletionGate(ctx, cp3)).To(BeAssignableToTypeOf(&mapierrors.RequeueAfterError{}))
+
+	// A holder that is gone without releasing the Lease is taken over.
+	g.Expect(c.Delete(ctx, cp2)).To(Succeed())
+	g.Expect(c.Delete(ctx, node2)).To(Succeed())
+	g.Expect(r.reconcileControlPlaneDeletionGate(ctx, cp3)).To(Succeed())
+
+	// A paused holder no longer holds the Lease.
+	cp4, node4 := newControlPlaneMachine("cp-4", corev1.ConditionTrue)
+	g.Expect(c.Create(ctx, cp4)).To(Succeed())
+	g.Expect(c.Create(ctx, node4)).To(Succeed())
+	g.Expect(r.reconcileControlPlaneDeletionGate(ctx, cp4)).To(BeAssignableToTypeOf(&mapierrors.RequeueAfterError{}))
+	cp3.Annotations = map[string]string{machinev1.PausedAnnotation: ""}
+	g.Expect(c.Update(ctx, cp3)).To(Succeed())
+	g.Expect(r.reconcileControlPlaneDeletionGate(ctx, cp4)).To(Succeed())
+	g.Expect(c.Delete(ctx, cp4)).To(Succeed())
+	g.Expect(c.Delete(ctx, node4)).To(Succeed())
+
+	// The last control plane Machine keeps its Node.
+	g.Expect(r.isDeleteNodeAllowed(ctx, cp3)).To(Equal(errLastControlPlaneNode))
+}
+
+func TestControlPlaneDeletionGateMinimum(t *testing.T) {
+	testCases := []struct {
+		name      string
+		ready     corev1.ConditionStatus
+		min       int
+		expectErr bool
+	}{
+		{
+			name:  "minimum disabled",
+			ready: corev1.ConditionFalse,
+		},
+		{
+			name:  "minimum kept",
+			ready: corev1.ConditionTrue,
+			min:   1,
+		},
+		{
+			name:      "only unhealthy members remain",
+			ready:     corev1.ConditionFalse,
+			min:       1,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cp1, node1 := newControlPlaneMachine("cp-1", corev1.ConditionTrue)
+			cp2, node2 := newControlPlaneMachine("cp-2", tc.ready)
+			cp2.DeletionTimestamp = nil
+			objs := []runtime.Object{cp1, node1, cp2, node2}
+			c := fake.NewFakeClientWithScheme(newTestScheme(), objs...)
+			r := &MachineReconciler{
+				Client:                  c,
+				Log:                     log.NullLogger{},
+				apiReader:               c,
+				MinControlPlaneMachines: tc.min,
+				recorder:                record.NewFakeRecorder(10),
+				externalReadyWait:       time.Second,
+			}
+
+			err := r.reconcileControlPlaneDeletionGate(context.Background(), cp1)
+			if tc.expectErr {
+				g.Expect(err).To(BeAssignableToTypeOf(&mapierrors.RequeueAfterError{}))
+				g.Expect(conditions.Get(cp1, machinev1.ControlPlaneDeletionAllowedCondition).Reason).To(Equal(machinev1.ControlPlaneQuorumAtRiskReason))
+
+				// The refused Machine does not keep the Lease.
+				lease := &coordinationv1.Lease{}
+				err := c.Get(context.Background(), client.ObjectKey{Namespace: cp1.Namespace, Name: controlPlaneDeletionLeaseName}, lease)
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	"github.com/criticalstack/machine-api/util"
+)
+
+// infrastructureNamespace returns the namespace of an object referenced by
+// the Machine. References may only point outside of the Machine namespace
+// into one of the AllowedInfrastructureNamespaces.
+func (r *MachineReconciler) infrastructureNamespace(m *machinev1.Machine, ref *corev1.ObjectReference) (string, error) {
+	if ref.Namespace == "" || ref.Namespace == m.Namespace {
+		return m.Namespace, nil
+	}
+	for _, ns := range r.AllowedInfrastructureNamespaces {
+		if ns == ref.Namespace {
+			return ns, nil
+		}
+	}
+	return "", errors.Errorf("%v %q of Machine %q in namespace %q references namespace %q, which is not allowed",
+		ref.GroupVersionKind().Kind, ref.Name, m.Name, m.Namespace, ref.Namespace)
+}
+
+// trackCrossNamespace marks an external object in another namespace than the
+// Machine as belonging to it. Owner references cannot cross namespaces, so
+// the Machine is tracked with labels instead, and a finalizer keeps the
+// object around until the Machine controller releases it. Objects tracked by
+// another Machine, or controlled by another object, are refused.
+func trackCrossNamespace(m *machinev1.Machine, obj *unstructured.Unstructured) error {
+	labels := obj.GetLabels()
+	if name, ok := labels[machinev1.MachineNameLabel]; ok && !isTrackedBy(m, obj) {
+		return errors.Errorf("%v %q in namespace %q already belongs to Machine %q in namespace %q",
+			obj.GetKind(), obj.GetName(), obj.GetNamespace(), name, labels[machinev1.MachineNamespaceLabel])
+	}
+	if owner := metav1.GetControllerOf(obj); owner != nil {
+		return errors.Errorf("%v %q in namespace %q is already controlled by %v %q",
+			obj.GetKind(), obj.GetName(), obj.GetNamespace(), owner.Kind, owner.Name)
+	}
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[machinev1.MachineNameLabel] = m.Name
+	labels[machinev1.MachineNamespaceLabel] = m.Namespace
+	obj.SetLabels(labels)
+
+	// Release the object once it is being deleted, so the deletion is not
+	// blocked by the Machine controller.
+	if obj.GetDeletionTimestamp().IsZero() {
+		controllerutil.AddFinalizer(obj, machinev1.InfrastructureFinalizer)
+	} else {
+		controllerutil.RemoveFinalizer(obj, machinev1.InfrastructureFinalizer)
+	}
+	return nil
+}
+
+// isTrackedBy returns whether the tracking labels of an object point at the
+// Machine.
+func isTrackedBy(m *machinev1.Machine, obj *unstructured.Unstructured) bool {
+	labels := obj.GetLabels()
+	return labels[machinev1.MachineNameLabel] == m.Name && labels[machinev1.MachineNamespaceLabel] == m.Namespace
+}
+
+// releaseCrossNamespace removes the finalizer of the Machine from an object
+// it tracks in another namespace.
+func (r *MachineReconciler) releaseCrossNamespace(ctx context.Context, m *machinev1.Machine, obj *unstructured.Unstructured) error {
+	if !isTrackedBy(m, obj) || !util.HasFinalizer(obj, machinev1.InfrastructureFinalizer) {
+		return nil
+	}
+	patch := client.MergeFrom(obj.DeepCopy())
+	controllerutil.RemoveFinalizer(obj, machinev1.InfrastructureFinalizer)
+	if err := r.Patch(ctx, obj, patch); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to release %v %q for Machine %q in namespace %q", obj.GetKind(), obj.GetName(), m.Name, m.Namespace)
+	}
+	return nil
+}
+
+// externalToMachines maps an external object to the Machine it belongs to,
+// either through its controller reference or, for objects in another
+// namespace, its tracking labels.
+func externalToMachines(o handler.MapObject) []reconcile.Request {
+	labels := o.Meta.GetLabels()
+	if name, ok := labels[machinev1.MachineNameLabel]; ok {
+		return []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: labels[machinev1.MachineNamespaceLabel], Name: name}}}
+	}
+	owner := metav1.GetControllerOf(o.Meta)
+	if owner == nil || owner.Kind != "Machine" || owner.APIVersion != machinev1.GroupVersion.String() {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: o.Meta.GetNamespace(), Name: owner.Name}}}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	"github.com/criticalstack/machine-api/util"
+)
+
+func TestInfrastructureNamespace(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &MachineReconciler{AllowedInfrastructureNamespaces: []string{"infra"}}
+	m := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"}}
+
+	ns, err := r.infrastructureNamespace(m, &corev1.ObjectReference{Name: "infra"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ns).To(Equal("default"))
+
+	ns, err = r.infrastructureNamespace(m, &corev1.ObjectReference{Name: "infra", Namespace: "infra"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ns).To(Equal("infra"))
+
+	_, err = r.infrastructureNamespace(m, &corev1.ObjectReference{Name: "infra", Namespace: "kube-system"})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestTrackCrossNamespace(t *testing.T) {
+	g := NewWithT(t)
+
+	m := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"}}
+	obj := newInfraMachine()
+	obj.SetNamespace("infra")
+
+	g.Expect(trackCrossNamespace(m, obj)).To(Succeed())
+	g.Expect(obj.GetLabels()).To(HaveKeyWithValue(machinev1.MachineNameLabel, "machine"))
+	g.Expect(obj.GetLabels()).To(HaveKeyWithValue(machinev1.MachineNamespaceLabel, "default"))
+	g.Expect(util.HasFinalizer(obj, machinev1.InfrastructureFinalizer)).To(BeTrue())
+
+	now := metav1.Now()
+	obj.SetDeletionTimestamp(&now)
+	g.Expect(trackCrossNamespace(m, obj)).To(Succeed())
+	g.Expect(util.HasFinalizer(obj, machinev1.InfrastructureFinalizer)).To(BeFalse())
+
+	// Objects of another Machine are left untouched.
+	other := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}}
+	g.Expect(trackCrossNamespace(other, obj)).To(MatchError(ContainSubstring("already belongs to Machine")))
+	g.Expect(obj.GetLabels()).To(HaveKeyWithValue(machinev1.MachineNameLabel, "machine"))
+
+	controlled := newInfraMachine()
+	controlled.SetNamespace("infra")
+	controlled.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: "infrastructure.crit.sh/v1alpha1",
+		Kind:       "DockerCluster",
+		Name:       "cluster",
+		Controller: pointer.BoolPtr(true),
+	}})
+	g.Expect(trackCrossNamespace(m, controlled)).To(MatchError(ContainSubstring("already controlled by")))
+	g.Expect(controlled.GetLabels()).To(BeEmpty())
+}
+
+func TestExternalToMachines(t *testing.T) {
+	g := NewWithT(t)
+
+	obj := newInfraMachine()
+	g.Expect(externalToMachines(handler.MapObject{Meta: obj, Object: obj})).To(BeEmpty())
+
+	obj.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: machinev1.GroupVersion.String(),
+		Kind:       "Machine",
+		Name:       "owner",
+		Controller: pointer.BoolPtr(true),
+	}})
+	g.Expect(externalToMachines(handler.MapObject{Meta: obj, Object: obj})).To(ConsistOf(
+		reconcile.Request{NamespacedName: client.ObjectKey{Namespace: "default", Name: "owner"}},
+	))
+
+	obj.SetNamespace("infra")
+	obj.SetLabels(map[string]string{
+		machinev1.MachineNameLabel:      "machine",
+		machinev1.MachineNamespaceLabel: "default",
+	})
+	g.Expect(externalToMachines(handler.MapObject{Meta: obj, Object: obj})).To(ConsistOf(
+		reconcile.Request{NamespacedName: client.ObjectKey{Namespace: "default", Name: "machine"}},
+	))
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	kubedrain "k8s.io/kubectl/pkg/drain"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util/conditions"
+)
+
+const defaultDrainTimeout = 20 * time.Second
+
+// reconcileDrain drains the Node of a Machine that is being deleted, unless
+// draining is excluded by annotation or has been going on for longer than
+// Spec.NodeDrainTimeout, or the NodeDrainTimeout of the reconciler when it is
+// not set. The outcome is recorded in the NodeDrained condition, which ends
+// the drain.
+func (r *MachineReconciler) reconcileDrain(ctx context.Context, m *machinev1.Machine) error {
+	log := r.Log.WithValues("machine", m.Name, "namespace", m.Namespace, "node", m.Status.NodeRef.Name)
+
+	if _, ok := m.Annotations[machinev1.ExcludeNodeDrainingAnnotation]; ok {
+		log.Info("Skipping drain of node excluded by annotation")
+		return nil
+	}
+	if conditions.Get(m, machinev1.NodeDrainedCondition) != nil {
+		return nil
+	}
+
+	if m.Status.NodeDrainStartTime == nil {
+		now := metav1.Now()
+		m.Status.NodeDrainStartTime = &now
+	}
+	nodeDrainTimeout := r.NodeDrainTimeout
+	if m.Spec.NodeDrainTimeout != nil {
+		nodeDrainTimeout = m.Spec.NodeDrainTimeout.Duration
+	}
+	if nodeDrainTimeout > 0 {
+		if elapsed := time.Since(m.Status.NodeDrainStartTime.Time); elapsed > nodeDrainTimeout {
+			log.Info("Timed out draining node, moving on", "elapsed", elapsed)
+			nodeDrainFailuresTotal.WithLabelValues("NodeDrainTimeout").Inc()
+			r.recorder.Eventf(m, corev1.EventTypeWarning, "NodeDrainTimeout", "timed out draining Machine's node %q after %v, moving on", m.Status.NodeRef.Name, nodeDrainTimeout)
+			conditions.MarkFalse(m, machinev1.NodeDrainedCondition, machinev1.NodeDrainTimeoutReason, "timed out draining node %q after %v", m.Status.NodeRef.Name, nodeDrainTimeout)
+			return nil
+		}
+	}
+
+	log.Info("Draining node")
+	if err := r.drainNode(ctx, m); err != nil {
+		nodeDrainFailuresTotal.WithLabelValues("FailedDrainNode").Inc()
+		r.recorder.Eventf(m, corev1.EventTypeWarning, "FailedDrainNode", "error draining Machine's node %q: %v", m.Status.NodeRef.Name, err)
+		return err
+	}
+	nodeDrainDuration.Observe(time.Since(m.Status.NodeDrainStartTime.Time).Seconds())
+	r.recorder.Eventf(m, corev1.EventTypeNormal, "SuccessfulDrainNode", "success draining Machine's node %q", m.Status.NodeRef.Name)
+	conditions.MarkTrue(m, machinev1.NodeDrainedCondition)
+	return nil
+}
+
+func (r *MachineReconciler) drainNode(ctx context.Context, m *machinev1.Machine) error {
+	nodeName := m.Status.NodeRef.Name
+	log := r.Log.WithValues("node", nodeName)
+
+	client, err := kubernetes.NewForConfig(r.config)
+	if err != nil {
+		return err
+	}
+
+	node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// If an admin deletes the node directly, we'll end up here.
+			log.Error(err, "Could not find node from noderef, it may have already been deleted")
+			return nil
+		}
+		return errors.Errorf("unable to get node %q: %v", nodeName, err)
+	}
+
+	drainer := newDrainer(client, m.Spec.Drain, r.DrainTimeout)
+	drainer.Ctx = ctx
+	drainer.OnPodDeletedOrEvicted = func(pod *corev1.Pod, usingEviction bool) {
+		verbStr := "Deleted"
+		if usingEviction {
+			verbStr = "Evicted"
+		}
+		log.Info(fmt.Sprintf("%s pod from Node", verbStr), "pod", fmt.Sprintf("%s/%s", pod.Name, pod.Namespace))
+	}
+
+	log.Info("cordon node")
+	if err := kubedrain.RunCordonOrUncordon(drainer, node, true); err != nil {
+		// Machine will be re-reconciled after a cordon failure.
+		log.Error(err, "Cordon failed")
+		return errors.Errorf("unable to cordon node %s: %v", node.Name, err)
+	}
+
+	log.Info("draining node")
+	if err := runNodeDrain(drainer, node.Name, m.Spec.Drain); err != nil {
+		// Machine will be re-reconciled after a drain failure.
+		log.Error(err, "Drain failed")
+		return &mapierrors.RequeueAfterError{RequeueAfter: drainer.Timeout}
+	}
+	return nil
+}
+
+// newDrainer returns a drain helper configured from the DrainSpec of a
+// Machine, falling back to the defaults for any field that is not set. The
+// timeout, when positive, replaces the default timeout.
+func newDrainer(client kubernetes.Interface, spec *machinev1.DrainSpec, timeout time.Duration) *kubedrain.Helper {
+	drainer := &kubedrain.Helper{
+		Client:              client,
+		Force:               true,
+		IgnoreAllDaemonSets: true,
+		DeleteLocalData:     true,
+		GracePeriodSeconds:  -1,
+		// If a pod is not evicted in time, retry the eviction next time the
+		// machine gets reconciled again (to allow other machines to be
+		// reconciled).
+		Timeout: defaultDrainTimeout,
+		Out:     writer{klog.Info},
+		ErrOut:  writer{klog.Error},
+	}
+	if timeout > 0 {
+		drainer.Timeout = timeout
+	}
+	if spec == nil {
+		return drainer
+	}
+	if spec.Timeout != nil && spec.Timeout.Duration > 0 {
+		drainer.Timeout = spec.Timeout.Duration
+	}
+	if spec.GracePeriodSeconds != nil {
+		drainer.GracePeriodSeconds = *spec.GracePeriodSeconds
+	}
+	if spec.Force != nil {
+		drainer.Force = *spec.Force
+	}
+	if spec.DeleteEmptyDirData != nil {
+		drainer.DeleteLocalData = *spec.DeleteEmptyDirData
+	}
+	drainer.DisableEviction = spec.DisableEviction
+	drainer.SkipWaitForDeleteTimeoutSeconds = spec.SkipWaitForDeleteTimeoutSeconds
+	return drainer
+}
+
+// runNodeDrain is kubedrain.RunNodeDrain, leaving the pods selected by the
+// SkipPodSelector of the DrainSpec running on the Node.
+func runNodeDrain(drainer *kubedrain.Helper, nodeName string, spec *machinev1.DrainSpec) error {
+	list, errs := drainer.GetPodsForDeletion(nodeName)
+	if errs != nil {
+		return kerrors.NewAggregate(errs)
+	}
+	if warnings := list.Warnings(); warnings != "" {
+		fmt.Fprintf(drainer.ErrOut, "WARNING: %s\n", warnings)
+	}
+	skip := labels.Nothing()
+	if spec != nil && spec.SkipPodSelector != nil {
+		var err error
+		skip, err = metav1.LabelSelectorAsSelector(spec.SkipPodSelector)
+		if err != nil {
+			return errors.Wrap(err, "invalid drain skipPodSelector")
+		}
+	}
+	pods := make([]corev1.Pod, 0)
+	for _, pod := range list.Pods() {
+		if skip.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return drainer.DeleteOrEvictPods(pods)
+}
+
+// writer implements io.Writer interface as a pass-through for klog.
+type writer struct {
+	logFunc func(args ...interface{})
+}
+
+// Write passes string(p) into writer's logFunc and always returns len(p)
+func (w writer) Write(p []byte) (n int, err error) {
+	w.logFunc(string(p))
+	return len(p), nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+func TestNewDrainer(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		g := NewWithT(t)
+
+		d := newDrainer(nil, nil, 0)
+		g.Expect(d.Force).To(BeTrue())
+		g.Expect(d.DeleteLocalData).To(BeTrue())
+		g.Expect(d.IgnoreAllDaemonSets).To(BeTrue())
+		g.Expect(d.GracePeriodSeconds).To(Equal(-1))
+		g.Expect(d.Timeout).To(Equal(defaultDrainTimeout))
+		g.Expect(d.DisableEviction).To(BeFalse())
+	})
+
+	t.Run("default timeout", func(t *testing.T) {
+		g := NewWithT(t)
+
+		d := newDrainer(nil, &machinev1.DrainSpec{}, time.Minute)
+		g.Expect(d.Timeout).To(Equal(time.Minute))
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		g := NewWithT(t)
+
+		gracePeriod := 30
+		d := newDrainer(nil, &machinev1.DrainSpec{
+			Timeout:                         &metav1.Duration{Duration: 2 * time.Minute},
+			GracePeriodSeconds:              &gracePeriod,
+			Force:                           pointer.BoolPtr(false),
+			DeleteEmptyDirData:              pointer.BoolPtr(false),
+			DisableEviction:                 true,
+			SkipWaitForDeleteTimeoutSeconds: 60,
+		}, time.Minute)
+		g.Expect(d.Force).To(BeFalse())
+		g.Expect(d.DeleteLocalData).To(BeFalse())
+		g.Expect(d.GracePeriodSeconds).To(Equal(30))
+		g.Expect(d.Timeout).To(Equal(2 * time.Minute))
+		g.Expect(d.DisableEviction).To(BeTrue())
+		g.Expect(d.SkipWaitForDeleteTimeoutSeconds).To(Equal(60))
+	})
+}
+
+func TestReconcileDrainDefaultNodeDrainTimeout(t *testing.T) {
+	g := NewWithT(t)
+
+	recorder := record.NewFakeRecorder(1)
+	r := &MachineReconciler{Log: log.NullLogger{}, recorder: recorder, NodeDrainTimeout: time.Minute}
+	started := metav1.NewTime(time.Now().Add(-time.Hour))
+	m := &machinev1.Machine{
+		Status: machinev1.MachineStatus{
+			NodeRef:            &corev1.ObjectReference{Name: "node"},
+			NodeDrainStartTime: &started,
+		},
+	}
+	g.Expect(r.reconcileDrain(context.Background(), m)).To(Succeed())
+	g.Expect(recorder.Events).To(Receive(HavePrefix("Warning NodeDrainTimeout")))
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	"github.com/criticalstack/machine-api/util/conditions"
+	"github.com/criticalstack/machine-api/util/etcd"
+)
+
+// reconcileEtcdMember removes the etcd member running on the Node of a
+// control plane Machine that is being deleted. The removal is refused, and
+// the deletion of the Machine blocked, while it would cost the etcd cluster
+// its quorum.
+func (r *MachineReconciler) reconcileEtcdMember(ctx context.Context, m *machinev1.Machine) error {
+	if !isControlPlaneMachine(m) || m.Status.NodeRef == nil || r.EtcdClientSecret.Name == "" {
+		return nil
+	}
+	if conditions.IsTrue(m, machinev1.EtcdMemberRemovedCondition) {
+		return nil
+	}
+	log := r.Log.WithValues("machine", m.Name, "namespace", m.Namespace, "node", m.Status.NodeRef.Name)
+
+	// The Node may already be gone, in which case the member can only be
+	// matched by name.
+	node := &corev1.Node{}
+	if err := r.Get(ctx, client.ObjectKey{Name: m.Status.NodeRef.Name}, node); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to get node %q", m.Status.NodeRef.Name)
+		}
+		node = nil
+	}
+
+	c, err := r.newEtcdClient(ctx, m.Status.NodeRef.Name)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	members, err := c.MemberList(ctx)
+	if err != nil {
+		return err
+	}
+	member := etcdMemberForNode(members, m.Status.NodeRef.Name, node)
+	if member == nil {
+		log.Info("No etcd member found for node, assuming it was already removed")
+		conditions.MarkTrue(m, machinev1.EtcdMemberRemovedCondition)
+		return nil
+	}
+
+	healthy := make(map[uint64]bool)
+	for _, mem := range members {
+		healthy[mem.ID] = c.MemberHealthy(ctx, mem)
+	}
+	if err := etcd.CheckRemoveQuorum(members, healthy, member.ID); err != nil {
+		log.Info("Refusing to remove etcd member", "member", member.Name, "cause", err.Error())
+		r.recorder.Eventf(m, corev1.EventTypeWarning, "EtcdQuorumAtRisk", "refusing to remove etcd member %q: %v", member.Name, err)
+		conditions.MarkFalse(m, machinev1.EtcdMemberRemovedCondition, machinev1.EtcdQuorumAtRiskReason, "%v", err)
+		return r.requeueAfter(r.EtcdMemberRemovalRequeue)
+	}
+
+	log.Info("Removing etcd member", "member", member.Name)
+	if err := c.MemberRemove(ctx, member.ID); err != nil {
+		r.recorder.Eventf(m, corev1.EventTypeWarning, "FailedRemoveEtcdMember", "error removing etcd member %q: %v", member.Name, err)
+		return err
+	}
+	r.recorder.Eventf(m, corev1.EventTypeNormal, "SuccessfulRemoveEtcdMember", "success removing etcd member %q", member.Name)
+	conditions.MarkTrue(m, machinev1.EtcdMemberRemovedCondition)
+	return nil
+}
+
+// newEtcdClient returns an etcd client using the certificates from the
+// EtcdClientSecret, which is read from the API server rather than caching
+// every Secret of the cluster. Unless EtcdEndpoints is set, the client connects to the
+// other control plane Nodes, excluding the one being removed.
+func (r *MachineReconciler) newEtcdClient(ctx context.Context, excludeNode string) (*etcd.Client, error) {
+	secret := &corev1.Secret{}
+	if err := r.apiReader.Get(ctx, r.EtcdClientSecret, secret); err != nil {
+		return nil, errors.Wrapf(err, "failed to get etcd client secret %q", r.EtcdClientSecret)
+	}
+	tlsConfig, err := etcd.NewTLSConfig(secret.Data[etcd.CACertKey], secret.Data[etcd.ClientCertKey], secret.Data[etcd.ClientKeyKey])
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := r.EtcdEndpoints
+	if len(endpoints) == 0 {
+		nodes := &corev1.NodeList{}
+		if err := r.List(ctx, nodes, client.HasLabels{machinev1.MachineControlPlaneLabelName}); err != nil {
+			return nil, err
+		}
+		for _, n := range nodes.Items {
+			if n.Name == excludeNode {
+				continue
+			}
+			for _, addr := range n.Status.Addresses {
+				if addr.Type == corev1.NodeInternalIP {
+					endpoints = append(endpoints, etcd.ClientURL(addr.Address))
+				}
+			}
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, errors.New("no etcd endpoints available")
+	}
+	return etcd.New(endpoints, tlsConfig), nil
+}
+
+// etcdMemberForNode returns the etcd member that runs on the named Node. A
+// member matches when its name is the Node name or when one of its peer URLs
+// points at one of the Node addresses.
+func etcdMemberForNode(members []*etcd.Member, nodeName string, node *corev1.Node) *etcd.Member {
+	addrs := make(map[string]bool)
+	if node != nil {
+		for _, addr := range node.Status.Addresses {
+			addrs[addr.Address] = true
+		}
+	}
+	for _, mem := range members {
+		if mem.Name == nodeName {
+			return mem
+		}
+		for _, peerURL := range mem.PeerURLs {
+			u, err := url.Parse(peerURL)
+			if err != nil {
+				continue
+			}
+			host := u.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if addrs[host] {
+				return mem
+			}
+		}
+	}
+	return nil
+}
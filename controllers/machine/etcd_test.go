@@ -0,0 +1,171 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util/conditions"
+	"github.com/criticalstack/machine-api/util/etcd"
+)
+
+func TestEtcdMemberForNode(t *testing.T) {
+	g := NewWithT(t)
+
+	members := []*etcd.Member{
+		{ID: 1, Name: "cp-1", PeerURLs: []string{"https://10.0.0.1:2380"}},
+		{ID: 2, Name: "etcd-2", PeerURLs: []string{"https://10.0.0.2:2380"}},
+	}
+	node := &corev1.Node{
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.2"}},
+		},
+	}
+	g.Expect(etcdMemberForNode(members, "cp-1", nil)).To(Equal(members[0]))
+	g.Expect(etcdMemberForNode(members, "cp-2", node)).To(Equal(members[1]))
+	g.Expect(etcdMemberForNode(members, "cp-3", nil)).To(BeNil())
+}
+
+func TestReconcileEtcdMember(t *testing.T) {
+	testCases := []struct {
+		name          string
+		unhealthy     string
+		expectRemoved bool
+	}{
+		{
+			name:          "quorum is kept",
+			unhealthy:     "cp-1",
+			expectRemoved: true,
+		},
+		{
+			name:      "quorum is lost",
+			unhealthy: "cp-2",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			var removed string
+			var srv *httptest.Server
+			srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/v3/cluster/member/list":
+					fmt.Fprintf(w, `{"members":[`+
+						`{"ID":"1","name":"cp-1","clientURLs":["%[1]s/cp-1"]},`+
+						`{"ID":"2","name":"cp-2","clientURLs":["%[1]s/cp-2"]},`+
+						`{"ID":"3","name":"cp-3","clientURLs":["%[1]s/cp-3"]}]}`, srv.URL)
+				case r.URL.Path == "/v3/cluster/member/remove":
+					removed = "cp-1"
+					fmt.Fprint(w, `{}`)
+				case strings.HasPrefix(r.URL.Path, "/"+tc.unhealthy+"/"):
+					w.WriteHeader(http.StatusServiceUnavailable)
+				default:
+					fmt.Fprint(w, `{}`)
+				}
+			}))
+			defer srv.Close()
+
+			m := &machinev1.Machine{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "cp-1",
+					Namespace: "default",
+					Labels:    map[string]string{machinev1.MachineControlPlaneLabelName: ""},
+				},
+				Status: machinev1.MachineStatus{
+					NodeRef: &corev1.ObjectReference{Kind: "Node", Name: "cp-1"},
+				},
+			}
+			secret := newEtcdClientSecret(g, srv)
+			c := fake.NewFakeClientWithScheme(newTestScheme(), secret)
+			r := &MachineReconciler{
+				Client:            c,
+				Log:               log.NullLogger{},
+				EtcdClientSecret:  client.ObjectKey{Namespace: secret.Namespace, Name: secret.Name},
+				EtcdEndpoints:     []string{srv.URL},
+				recorder:          record.NewFakeRecorder(10),
+				externalReadyWait: time.Second,
+				apiReader:         c,
+			}
+
+			err := r.reconcileEtcdMember(context.Background(), m)
+			if tc.expectRemoved {
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(removed).To(Equal("cp-1"))
+				g.Expect(conditions.IsTrue(m, machinev1.EtcdMemberRemovedCondition)).To(BeTrue())
+			} else {
+				g.Expect(err).To(BeAssignableToTypeOf(&mapierrors.RequeueAfterError{}))
+				g.Expect(removed).To(BeEmpty())
+				c := conditions.Get(m, machinev1.EtcdMemberRemovedCondition)
+				g.Expect(c).NotTo(BeNil())
+				g.Expect(c.Reason).To(Equal(machinev1.EtcdQuorumAtRiskReason))
+			}
+		})
+	}
+}
+
+// newEtcdClientSecret returns an etcd client Secret trusting the test server
+// certificate along with a self-signed client certificate.
+func newEtcdClientSecret(g *WithT, srv *httptest.Server) *corev1.Secret {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).NotTo(HaveOccurred())
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "machine-api"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	g.Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "etcd-client", Namespace: "kube-system"},
+		Data: map[string][]byte{
+			etcd.CACertKey:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}),
+			etcd.ClientCertKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			etcd.ClientKeyKey:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		},
+	}
+}
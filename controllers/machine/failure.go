@@ -0,0 +1,109 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+)
+
+// setFailure records a failure reported by source on the Machine. Either of
+// reason or message may be empty.
+func setFailure(m *machinev1.Machine, source machinev1.MachineFailureSource, reason mapierrors.MachineStatusError, message string) {
+	m.Status.FailureSource = source
+	m.Status.FailureReason = nil
+	if reason != "" {
+		m.Status.FailureReason = mapierrors.MachineStatusErrorPtr(reason)
+	}
+	m.Status.FailureMessage = nil
+	if message != "" {
+		m.Status.FailureMessage = pointer.StringPtr(message)
+	}
+}
+
+// clearFailure clears the failure of the Machine if it was reported by source
+// and is not terminal. It returns true if the failure was cleared.
+func clearFailure(m *machinev1.Machine, source machinev1.MachineFailureSource) bool {
+	if m.Status.FailureSource != source {
+		return false
+	}
+	if m.Status.FailureReason != nil && m.Status.FailureReason.IsTerminal() {
+		return false
+	}
+	m.Status.ClearFailure()
+	return true
+}
+
+// clearInvalidConfig clears an InvalidConfig failure reported by source, once
+// what it was reported for is accepted again. Other failures are left to be
+// cleared by whatever reported them.
+func clearInvalidConfig(m *machinev1.Machine, source machinev1.MachineFailureSource) {
+	if m.Status.FailureReason != nil && *m.Status.FailureReason == mapierrors.InvalidConfigMachineError {
+		clearFailure(m, source)
+	}
+}
+
+// reconcileClearFailure clears the failure of the Machine, terminal or not,
+// when it has been requested with the ClearFailureAnnotation.
+func (r *MachineReconciler) reconcileClearFailure(m *machinev1.Machine) {
+	if _, ok := m.Annotations[machinev1.ClearFailureAnnotation]; !ok {
+		return
+	}
+	if m.Status.FailureReason != nil || m.Status.FailureMessage != nil {
+		r.Log.Info("clearing failure as requested by annotation", "machine", m.Name, "namespace", m.Namespace, "source", m.Status.FailureSource)
+		r.recorder.Event(m, corev1.EventTypeNormal, "FailureCleared", "Failure cleared as requested by annotation")
+		m.Status.ClearFailure()
+	}
+	delete(m.Annotations, machinev1.ClearFailureAnnotation)
+}
+
+// reconcileConfig reflects failures reported by the Config referenced by a
+// Machine onto the Machine.
+func (r *MachineReconciler) reconcileConfig(ctx context.Context, m *machinev1.Machine) error {
+	if m.Spec.ConfigRef.Name == "" {
+		clearFailure(m, machinev1.MachineFailureSourceConfig)
+		return nil
+	}
+	namespace := m.Spec.ConfigRef.Namespace
+	if namespace == "" {
+		namespace = m.Namespace
+	}
+	cfg := &machinev1.Config{}
+	if err := r.Get(ctx, client.ObjectKey{Name: m.Spec.ConfigRef.Name, Namespace: namespace}, cfg); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if cfg.Status.FailureReason == "" && cfg.Status.FailureMessage == "" {
+		if clearFailure(m, machinev1.MachineFailureSourceConfig) {
+			r.recorder.Eventf(m, corev1.EventTypeNormal, "FailureCleared", "Config %q no longer reports a failure", cfg.Name)
+		}
+		return nil
+	}
+	setFailure(m, machinev1.MachineFailureSourceConfig, mapierrors.MachineStatusError(cfg.Status.FailureReason),
+		fmt.Sprintf("Failure detected from referenced Config %q: %s", cfg.Name, cfg.Status.FailureMessage))
+	return nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+)
+
+func TestClearFailure(t *testing.T) {
+	cases := []struct {
+		name          string
+		source        machinev1.MachineFailureSource
+		reason        mapierrors.MachineStatusError
+		clearSource   machinev1.MachineFailureSource
+		expectCleared bool
+	}{
+		{
+			name:          "transient failure from same source",
+			source:        machinev1.MachineFailureSourceInfrastructure,
+			reason:        mapierrors.CreateMachineError,
+			clearSource:   machinev1.MachineFailureSourceInfrastructure,
+			expectCleared: true,
+		},
+		{
+			name:          "failure without reason from same source",
+			source:        machinev1.MachineFailureSourceConfig,
+			clearSource:   machinev1.MachineFailureSourceConfig,
+			expectCleared: true,
+		},
+		{
+			name:          "transient failure from other source",
+			source:        machinev1.MachineFailureSourceInfrastructure,
+			reason:        mapierrors.CreateMachineError,
+			clearSource:   machinev1.MachineFailureSourceConfig,
+			expectCleared: false,
+		},
+		{
+			name:          "terminal failure from same source",
+			source:        machinev1.MachineFailureSourceInfrastructure,
+			reason:        mapierrors.InvalidConfigurationMachineError,
+			clearSource:   machinev1.MachineFailureSourceInfrastructure,
+			expectCleared: false,
+		},
+		{
+			name:          "failure without source",
+			reason:        mapierrors.CreateMachineError,
+			clearSource:   machinev1.MachineFailureSourceInfrastructure,
+			expectCleared: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			m := &machinev1.Machine{}
+			setFailure(m, tc.source, tc.reason, "boom")
+			g.Expect(m.Status.FailureMessage).NotTo(BeNil())
+
+			g.Expect(clearFailure(m, tc.clearSource)).To(Equal(tc.expectCleared))
+			if tc.expectCleared {
+				g.Expect(m.Status.FailureSource).To(BeEmpty())
+				g.Expect(m.Status.FailureReason).To(BeNil())
+				g.Expect(m.Status.FailureMessage).To(BeNil())
+			} else {
+				g.Expect(m.Status.FailureSource).To(Equal(tc.source))
+				g.Expect(m.Status.FailureMessage).NotTo(BeNil())
+			}
+		})
+	}
+}
+
+func TestReconcileConfigRecovers(t *testing.T) {
+	g := NewWithT(t)
+
+	cfg := &machinev1.Config{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "default"},
+		Status: machinev1.ConfigStatus{
+			FailureReason:  string(mapierrors.InvalidConfigMachineError),
+			FailureMessage: "invalid configuration type: <nil>",
+		},
+	}
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "default"},
+		Spec:       machinev1.MachineSpec{ConfigRef: corev1.ObjectReference{Name: "worker"}},
+	}
+	c := fake.NewFakeClientWithScheme(newTestScheme(), cfg)
+	r := &MachineReconciler{Client: c, Log: log.NullLogger{}, recorder: record.NewFakeRecorder(1)}
+
+	g.Expect(r.reconcileConfig(context.Background(), m)).To(Succeed())
+	g.Expect(m.Status.FailureSource).To(Equal(machinev1.MachineFailureSourceConfig))
+	g.Expect(m.Status.FailureReason).To(Equal(mapierrors.MachineStatusErrorPtr(mapierrors.InvalidConfigMachineError)))
+
+	// The Config is fixed and rendered.
+	cfg.Status.FailureReason = ""
+	cfg.Status.FailureMessage = ""
+	cfg.Status.Ready = true
+	g.Expect(c.Status().Update(context.Background(), cfg)).To(Succeed())
+
+	g.Expect(r.reconcileConfig(context.Background(), m)).To(Succeed())
+	g.Expect(m.Status.FailureSource).To(BeEmpty())
+	g.Expect(m.Status.FailureReason).To(BeNil())
+	g.Expect(m.Status.FailureMessage).To(BeNil())
+}
+
+func TestReconcileInfrastructureRecovers(t *testing.T) {
+	g := NewWithT(t)
+
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "default"},
+		Spec: machinev1.MachineSpec{
+			InfrastructureRef: &corev1.ObjectReference{
+				APIVersion: "infrastructure.crit.sh/v1alpha1",
+				Kind:       "DockerMachine",
+				Name:       "infra",
+				Namespace:  "infra",
+			},
+		},
+	}
+	r := &MachineReconciler{
+		Client:            fake.NewFakeClientWithScheme(runtime.NewScheme()),
+		Log:               log.NullLogger{},
+		recorder:          record.NewFakeRecorder(1),
+		externalReadyWait: time.Second,
+	}
+
+	g.Expect(r.reconcileInfrastructure(context.Background(), m)).To(Succeed())
+	g.Expect(m.Status.FailureSource).To(Equal(machinev1.MachineFailureSourceInfrastructure))
+	g.Expect(m.Status.FailureReason).To(Equal(mapierrors.MachineStatusErrorPtr(mapierrors.InvalidConfigMachineError)))
+
+	// The namespace is allowed, and the Machine waits for its
+	// infrastructure object.
+	r.AllowedInfrastructureNamespaces = []string{"infra"}
+	g.Expect(mapierrors.IsRequeueAfter(r.reconcileInfrastructure(context.Background(), m))).To(BeTrue())
+	g.Expect(m.Status.FailureSource).To(BeEmpty())
+	g.Expect(m.Status.FailureReason).To(BeNil())
+	g.Expect(m.Status.FailureMessage).To(BeNil())
+}
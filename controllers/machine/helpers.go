@@ -25,16 +25,13 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/klog"
-	kubedrain "k8s.io/kubectl/pkg/drain"
-	"k8s.io/utils/pointer"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 
 	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
 	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util"
+	"github.com/criticalstack/machine-api/util/conditions"
 	"github.com/criticalstack/machine-api/util/external"
 	"github.com/criticalstack/machine-api/util/patch"
 )
@@ -43,24 +40,44 @@ import (
 func (r *MachineReconciler) reconcileExternal(ctx context.Context, m *machinev1.Machine, ref *corev1.ObjectReference) (external.ReconcileOutput, error) {
 	logger := r.Log.WithValues("machine", m.Name, "namespace", m.Namespace)
 
-	obj, err := external.Get(ctx, r.Client, ref, m.Namespace)
+	namespace, err := r.infrastructureNamespace(m, ref)
+	if err != nil {
+		return external.ReconcileOutput{}, err
+	}
+	obj, err := external.Get(ctx, r.Client, ref, namespace)
 	if err != nil {
 		if apierrors.IsNotFound(errors.Cause(err)) {
 			return external.ReconcileOutput{}, errors.Wrapf(&mapierrors.RequeueAfterError{RequeueAfter: r.externalReadyWait},
 				"could not find %v %q for Machine %q in namespace %q, requeuing",
-				ref.GroupVersionKind(), ref.Name, m.Name, m.Namespace)
+				ref.GroupVersionKind(), ref.Name, m.Name, namespace)
 		}
 		return external.ReconcileOutput{}, err
 	}
 
+	// Leave paused external objects untouched, only watching them to be
+	// notified when they are unpaused.
+	if util.IsPaused(obj) {
+		logger.V(1).Info("External object is paused", "kind", obj.GetKind(), "name", obj.GetName())
+		if err := r.externalTracker.Watch(logger, obj, &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(externalToMachines)}); err != nil {
+			return external.ReconcileOutput{}, err
+		}
+		return external.ReconcileOutput{Result: obj, Paused: true}, nil
+	}
+
 	// Initialize the patch helper.
 	patchHelper, err := patch.NewHelper(obj, r.Client)
 	if err != nil {
 		return external.ReconcileOutput{}, err
 	}
 
-	// Set external object ControllerReference to the Machine.
-	if err := controllerutil.SetControllerReference(m, obj, r.scheme); err != nil {
+	// Set external object ControllerReference to the Machine, or track the
+	// Machine on objects in another namespace.
+	if obj.GetNamespace() == m.Namespace {
+		if err := controllerutil.SetControllerReference(m, obj, r.scheme); err != nil {
+			return external.ReconcileOutput{}, err
+		}
+	} else if err := trackCrossNamespace(m, obj); err != nil {
+		setFailure(m, machinev1.MachineFailureSourceInfrastructure, mapierrors.InvalidConfigMachineError, err.Error())
 		return external.ReconcileOutput{}, err
 	}
 
@@ -70,7 +87,7 @@ func (r *MachineReconciler) reconcileExternal(ctx context.Context, m *machinev1.
 	}
 
 	// Ensure we add a watcher to the external object.
-	if err := r.externalTracker.Watch(logger, obj, &handler.EnqueueRequestForOwner{OwnerType: &machinev1.Machine{}}); err != nil {
+	if err := r.externalTracker.Watch(logger, obj, &handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(externalToMachines)}); err != nil {
 		return external.ReconcileOutput{}, err
 	}
 
@@ -79,94 +96,94 @@ func (r *MachineReconciler) reconcileExternal(ctx context.Context, m *machinev1.
 	if err != nil {
 		return external.ReconcileOutput{}, err
 	}
-	if failureReason != "" {
-		machineStatusError := mapierrors.MachineStatusError(failureReason)
-		m.Status.FailureReason = &machineStatusError
-	}
-	if failureMessage != "" {
-		m.Status.FailureMessage = pointer.StringPtr(
-			fmt.Sprintf("Failure detected from referenced resource %v with name %q: %s",
-				obj.GroupVersionKind(), obj.GetName(), failureMessage),
-		)
+	if failureReason == "" && failureMessage == "" {
+		// Clear the failure once the referenced resource stops reporting it.
+		if clearFailure(m, machinev1.MachineFailureSourceInfrastructure) {
+			r.recorder.Eventf(m, corev1.EventTypeNormal, "FailureCleared", "%v %q no longer reports a failure", obj.GroupVersionKind().Kind, obj.GetName())
+		}
+	} else {
+		if failureMessage != "" {
+			failureMessage = fmt.Sprintf("Failure detected from referenced resource %v with name %q: %s",
+				obj.GroupVersionKind(), obj.GetName(), failureMessage)
+		}
+		setFailure(m, machinev1.MachineFailureSourceInfrastructure, mapierrors.MachineStatusError(failureReason), failureMessage)
 	}
 
 	return external.ReconcileOutput{Result: obj}, nil
 }
 
-func (r *MachineReconciler) drainNode(ctx context.Context, nodeName string) error {
-	log := r.Log.WithValues("node", nodeName)
-
-	client, err := kubernetes.NewForConfig(r.config)
+// reconcileDeleteExternal deletes the infrastructure object of a Machine and
+// waits for it to be gone, honoring any finalizers on it. The deletion moves
+// on without the infrastructure object once InfrastructureDeleteTimeout has
+// passed.
+func (r *MachineReconciler) reconcileDeleteExternal(ctx context.Context, m *machinev1.Machine) error {
+	if m.Spec.InfrastructureRef == nil {
+		conditions.MarkTrue(m, machinev1.InfrastructureDeletedCondition)
+		return nil
+	}
+	namespace, err := r.infrastructureNamespace(m, m.Spec.InfrastructureRef)
 	if err != nil {
-		return err
+		// The namespace is no longer allowed, so the object is not deleted,
+		// but it is still released if this Machine tracked it before.
+		obj, err := external.Get(ctx, r.Client, m.Spec.InfrastructureRef, m.Spec.InfrastructureRef.Namespace)
+		if err != nil && !apierrors.IsNotFound(errors.Cause(err)) {
+			return errors.Wrapf(err, "failed to get InfrastructureRef %q for Machine %q in namespace %q", m.Spec.InfrastructureRef.Name, m.Name, m.Namespace)
+		}
+		if err == nil {
+			if err := r.releaseCrossNamespace(ctx, m, obj); err != nil {
+				return err
+			}
+		}
+		conditions.MarkTrue(m, machinev1.InfrastructureDeletedCondition)
+		return nil
 	}
-
-	node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	obj, err := external.Get(ctx, r.Client, m.Spec.InfrastructureRef, namespace)
 	if err != nil {
-		if apierrors.IsNotFound(err) {
-			// If an admin deletes the node directly, we'll end up here.
-			log.Error(err, "Could not find node from noderef, it may have already been deleted")
+		if apierrors.IsNotFound(errors.Cause(err)) {
+			conditions.MarkTrue(m, machinev1.InfrastructureDeletedCondition)
 			return nil
 		}
-		return errors.Errorf("unable to get node %q: %v", nodeName, err)
-	}
-
-	drainer := &kubedrain.Helper{
-		Client:              client,
-		Force:               true,
-		IgnoreAllDaemonSets: true,
-		DeleteLocalData:     true,
-		GracePeriodSeconds:  -1,
-		// If a pod is not evicted in 20 seconds, retry the eviction next time the
-		// machine gets reconciled again (to allow other machines to be reconciled).
-		Timeout: 20 * time.Second,
-		OnPodDeletedOrEvicted: func(pod *corev1.Pod, usingEviction bool) {
-			verbStr := "Deleted"
-			if usingEviction {
-				verbStr = "Evicted"
-			}
-			log.Info(fmt.Sprintf("%s pod from Node", verbStr), "pod", fmt.Sprintf("%s/%s", pod.Name, pod.Namespace))
-		},
-		Out:    writer{klog.Info},
-		ErrOut: writer{klog.Error},
+		return errors.Wrapf(err, "failed to get InfrastructureRef %q for Machine %q in namespace %q", m.Spec.InfrastructureRef.Name, m.Name, m.Namespace)
 	}
-
-	log.Info("cordon node")
-	if err := kubedrain.RunCordonOrUncordon(drainer, node, true); err != nil {
-		// Machine will be re-reconciled after a cordon failure.
-		log.Error(err, "Cordon failed")
-		return errors.Errorf("unable to cordon node %s: %v", node.Name, err)
+	if util.IsPaused(obj) {
+		conditions.Set(m, &machinev1.Condition{
+			Type:    machinev1.PausedCondition,
+			Status:  corev1.ConditionTrue,
+			Reason:  machinev1.InfrastructurePausedReason,
+			Message: fmt.Sprintf("%v %q is paused", obj.GetKind(), obj.GetName()),
+		})
+		return errors.Wrapf(r.requeueAfter(r.InfrastructureDeletionRequeue),
+			"waiting for paused %v %q of Machine %q in namespace %q", obj.GetKind(), obj.GetName(), m.Name, m.Namespace)
+	}
+	// Release objects in another namespace, which are not garbage collected
+	// along with the Machine.
+	if err := r.releaseCrossNamespace(ctx, m, obj); err != nil {
+		return err
 	}
-
-	log.Info("draining node")
-	if err := kubedrain.RunNodeDrain(drainer, node.Name); err != nil {
-		// Machine will be re-reconciled after a drain failure.
-		log.Error(err, "Drain failed")
-		return &mapierrors.RequeueAfterError{RequeueAfter: 20 * time.Second}
+	if obj.GetDeletionTimestamp().IsZero() {
+		if err := r.Delete(ctx, obj); err != nil {
+			if apierrors.IsNotFound(err) {
+				conditions.MarkTrue(m, machinev1.InfrastructureDeletedCondition)
+				return nil
+			}
+			return errors.Wrapf(err, "failed to delete InfrastructureRef %q for Machine %q in namespace %q", obj.GetName(), m.Name, m.Namespace)
+		}
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "DeletingInfrastructure", "deleting %v %q", obj.GetKind(), obj.GetName())
 	}
-	return nil
-}
-
-// writer implements io.Writer interface as a pass-through for klog.
-type writer struct {
-	logFunc func(args ...interface{})
-}
 
-// Write passes string(p) into writer's logFunc and always returns len(p)
-func (w writer) Write(p []byte) (n int, err error) {
-	w.logFunc(string(p))
-	return len(p), nil
-}
-
-func (r *MachineReconciler) reconcileDeleteExternal(ctx context.Context, m *machinev1.Machine) error {
-	obj, err := external.Get(ctx, r.Client, m.Spec.InfrastructureRef, m.Namespace)
-	if err != nil && !apierrors.IsNotFound(errors.Cause(err)) {
-		return errors.Wrapf(err, "failed to get InfrastructureRef %q for Machine %q in namespace %q", m.Spec.InfrastructureRef.Name, m.Name, m.Namespace)
-	}
-	if err := r.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
-		return errors.Wrapf(err, "failed to delete InfrastructureRef %q for Machine %q in namespace %q", obj.GetName(), m.Name, m.Namespace)
+	if c := conditions.Get(m, machinev1.InfrastructureDeletedCondition); c != nil && c.Status == corev1.ConditionFalse && r.InfrastructureDeleteTimeout > 0 {
+		if time.Since(c.LastTransitionTime.Time) > r.InfrastructureDeleteTimeout {
+			r.Log.Info("Timed out waiting for infrastructure to be deleted, moving on", "machine", m.Name, "namespace", m.Namespace, "infrastructure", obj.GetName())
+			r.recorder.Eventf(m, corev1.EventTypeWarning, "InfrastructureDeleteTimeout", "timed out waiting for %v %q to be deleted after %v, moving on", obj.GetKind(), obj.GetName(), r.InfrastructureDeleteTimeout)
+			conditions.MarkFalse(m, machinev1.InfrastructureDeletedCondition, machinev1.DeletionTimeoutReason,
+				"%v %q was not deleted after %v", obj.GetKind(), obj.GetName(), r.InfrastructureDeleteTimeout)
+			return nil
+		}
 	}
-	return nil
+	conditions.MarkFalse(m, machinev1.InfrastructureDeletedCondition, machinev1.DeletingReason,
+		"waiting for %v %q to be deleted, finalizers: %v", obj.GetKind(), obj.GetName(), obj.GetFinalizers())
+	return errors.Wrapf(r.requeueAfter(r.InfrastructureDeletionRequeue),
+		"waiting for %v %q of Machine %q in namespace %q to be deleted", obj.GetKind(), obj.GetName(), m.Name, m.Namespace)
 }
 
 func (r *MachineReconciler) deleteNode(ctx context.Context, name string) error {
@@ -195,39 +212,37 @@ func isControlPlaneMachine(machine *machinev1.Machine) bool {
 }
 
 // isDeleteNodeAllowed returns nil only if the Machine's NodeRef is not nil
-// and if the Machine is not the last control plane node in the cluster.
+// and if the Machine is not the last healthy control plane node in the
+// cluster.
 func (r *MachineReconciler) isDeleteNodeAllowed(ctx context.Context, m *machinev1.Machine) error {
 	// Cannot delete something that doesn't exist.
 	if m.Status.NodeRef == nil {
 		return errNilNodeRef
 	}
+	if !isControlPlaneMachine(m) {
+		return nil
+	}
 
-	// Get all of the machines that belong to this cluster.
-	machineList := &machinev1.MachineList{}
-	if err := r.List(ctx, machineList, client.InNamespace(m.Namespace)); err != nil {
+	// Only healthy control plane members count, other control plane
+	// Machines being deleted are still members until their Node is gone and
+	// their removal is serialized by the control plane deletion gate.
+	healthy, err := r.healthyControlPlaneMachines(ctx, m)
+	if err != nil {
 		return err
 	}
-	machines := make([]*machinev1.Machine, 0)
-	for i, m := range machineList.Items {
-		if isControlPlaneMachine(&m) {
-			machines = append(machines, &machineList.Items[i])
-		}
-	}
-
-	// Whether or not it is okay to delete the NodeRef depends on the
-	// number of remaining control plane members and whether or not this
-	// machine is one of them.
-	switch numControlPlaneMachines := len(machines); {
-	//case numControlPlaneMachines == 0:
-	//// Do not delete the NodeRef if there are no remaining members of
-	//// the control plane.
-	//return errNoControlPlaneNodes
-	case numControlPlaneMachines == 1 && isControlPlaneMachine(m):
+	if healthy == 0 {
 		// Do not delete the NodeRef if this is the last member of the
 		// control plane.
 		return errLastControlPlaneNode
-	default:
-		// Otherwise it is okay to delete the NodeRef.
-		return nil
 	}
+	return nil
+}
+
+// requeueAfter returns the error requeuing a Machine after wait, or after the
+// external ready wait when wait is zero.
+func (r *MachineReconciler) requeueAfter(wait time.Duration) *mapierrors.RequeueAfterError {
+	if wait == 0 {
+		wait = r.externalReadyWait
+	}
+	return &mapierrors.RequeueAfterError{RequeueAfter: wait}
 }
@@ -0,0 +1,149 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util/conditions"
+)
+
+func newInfraMachine(finalizers ...string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("infrastructure.crit.sh/v1alpha1")
+	u.SetKind("DockerMachine")
+	u.SetName("infra")
+	u.SetNamespace("default")
+	u.SetFinalizers(finalizers)
+	return u
+}
+
+func TestReconcileDeleteExternal(t *testing.T) {
+	newMachine := func() *machinev1.Machine {
+		return &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+			Spec: machinev1.MachineSpec{
+				InfrastructureRef: &corev1.ObjectReference{
+					APIVersion: "infrastructure.crit.sh/v1alpha1",
+					Kind:       "DockerMachine",
+					Name:       "infra",
+				},
+			},
+		}
+	}
+
+	t.Run("without infrastructure reference", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := &MachineReconciler{Client: fake.NewFakeClientWithScheme(runtime.NewScheme())}
+		m := newMachine()
+		m.Spec.InfrastructureRef = nil
+		g.Expect(r.reconcileDeleteExternal(context.Background(), m)).To(Succeed())
+		g.Expect(conditions.IsTrue(m, machinev1.InfrastructureDeletedCondition)).To(BeTrue())
+	})
+
+	t.Run("waits for infrastructure to be gone", func(t *testing.T) {
+		g := NewWithT(t)
+
+		c := fake.NewFakeClientWithScheme(runtime.NewScheme(), newInfraMachine())
+		r := &MachineReconciler{
+			Client:            c,
+			Log:               log.NullLogger{},
+			recorder:          record.NewFakeRecorder(10),
+			externalReadyWait: time.Second,
+		}
+		m := newMachine()
+		err := r.reconcileDeleteExternal(context.Background(), m)
+		g.Expect(mapierrors.IsRequeueAfter(err)).To(BeTrue())
+		cond := conditions.Get(m, machinev1.InfrastructureDeletedCondition)
+		g.Expect(cond).NotTo(BeNil())
+		g.Expect(cond.Status).To(Equal(corev1.ConditionFalse))
+		g.Expect(cond.Reason).To(Equal(machinev1.DeletingReason))
+
+		g.Expect(r.reconcileDeleteExternal(context.Background(), m)).To(Succeed())
+		g.Expect(conditions.IsTrue(m, machinev1.InfrastructureDeletedCondition)).To(BeTrue())
+	})
+
+	t.Run("moves on after timeout", func(t *testing.T) {
+		g := NewWithT(t)
+
+		now := metav1.Now()
+		infra := newInfraMachine("infrastructure.crit.sh")
+		infra.SetDeletionTimestamp(&now)
+		r := &MachineReconciler{
+			Client:                      fake.NewFakeClientWithScheme(runtime.NewScheme(), infra),
+			Log:                         log.NullLogger{},
+			recorder:                    record.NewFakeRecorder(10),
+			externalReadyWait:           time.Second,
+			InfrastructureDeleteTimeout: time.Minute,
+		}
+		m := newMachine()
+		err := r.reconcileDeleteExternal(context.Background(), m)
+		g.Expect(mapierrors.IsRequeueAfter(err)).To(BeTrue())
+
+		m.Status.Conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(-2 * time.Minute))
+		g.Expect(r.reconcileDeleteExternal(context.Background(), m)).To(Succeed())
+		cond := conditions.Get(m, machinev1.InfrastructureDeletedCondition)
+		g.Expect(cond.Status).To(Equal(corev1.ConditionFalse))
+		g.Expect(cond.Reason).To(Equal(machinev1.DeletionTimeoutReason))
+	})
+	t.Run("releases objects in namespaces no longer allowed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		infra := newInfraMachine(machinev1.InfrastructureFinalizer)
+		infra.SetNamespace("infra")
+		infra.SetLabels(map[string]string{
+			machinev1.MachineNameLabel:      "machine",
+			machinev1.MachineNamespaceLabel: "default",
+		})
+		c := fake.NewFakeClientWithScheme(runtime.NewScheme(), infra)
+		r := &MachineReconciler{Client: c, Log: log.NullLogger{}, recorder: record.NewFakeRecorder(10)}
+		m := newMachine()
+		m.Spec.InfrastructureRef.Namespace = "infra"
+		g.Expect(r.reconcileDeleteExternal(context.Background(), m)).To(Succeed())
+		g.Expect(conditions.IsTrue(m, machinev1.InfrastructureDeletedCondition)).To(BeTrue())
+
+		// The object is released, but not deleted.
+		released := newInfraMachine()
+		g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "infra", Name: "infra"}, released)).To(Succeed())
+		g.Expect(released.GetFinalizers()).To(BeEmpty())
+		g.Expect(released.GetDeletionTimestamp()).To(BeNil())
+	})
+}
+
+func TestRequeueAfter(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &MachineReconciler{externalReadyWait: 30 * time.Second, DeleteHookRequeue: 5 * time.Second}
+	g.Expect(r.requeueAfter(r.DeleteHookRequeue).RequeueAfter).To(Equal(5 * time.Second))
+	g.Expect(r.requeueAfter(r.EtcdMemberRemovalRequeue).RequeueAfter).To(Equal(30 * time.Second))
+}
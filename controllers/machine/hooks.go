@@ -0,0 +1,54 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	"github.com/criticalstack/machine-api/util/conditions"
+)
+
+// reconcileDeleteHooks pauses the deletion of a Machine while lifecycle hook
+// annotations with the given prefix are present, reporting the blocking hooks
+// in the given condition.
+func (r *MachineReconciler) reconcileDeleteHooks(m *machinev1.Machine, prefix string, condition machinev1.ConditionType) error {
+	hooks := lifecycleHooks(m, prefix)
+	if len(hooks) == 0 {
+		conditions.MarkTrue(m, condition)
+		return nil
+	}
+	conditions.MarkFalse(m, condition, machinev1.WaitingExternalHookReason, "waiting for hooks: %s", strings.Join(hooks, ", "))
+	return errors.Wrapf(r.requeueAfter(r.DeleteHookRequeue),
+		"deletion of Machine %q in namespace %q is waiting for hooks %v", m.Name, m.Namespace, hooks)
+}
+
+// lifecycleHooks returns the sorted lifecycle hook annotations of a Machine
+// with the given prefix.
+func lifecycleHooks(m *machinev1.Machine, prefix string) []string {
+	hooks := make([]string, 0)
+	for k := range m.Annotations {
+		if strings.HasPrefix(k, prefix+"/") {
+			hooks = append(hooks, k)
+		}
+	}
+	sort.Strings(hooks)
+	return hooks
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util/conditions"
+)
+
+func TestReconcileDeleteHooks(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &MachineReconciler{}
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				machinev1.PreDrainDeleteHookAnnotationPrefix + "/storage":       "",
+				machinev1.PreDrainDeleteHookAnnotationPrefix + "/etcd":          "",
+				machinev1.PreTerminateDeleteHookAnnotationPrefix + "/inventory": "",
+				"other.annotation/value":                                        "",
+			},
+		},
+	}
+
+	err := r.reconcileDeleteHooks(m, machinev1.PreDrainDeleteHookAnnotationPrefix, machinev1.PreDrainDeleteHookSucceededCondition)
+	g.Expect(mapierrors.IsRequeueAfter(err)).To(BeTrue())
+	c := conditions.Get(m, machinev1.PreDrainDeleteHookSucceededCondition)
+	g.Expect(c).NotTo(BeNil())
+	g.Expect(c.Status).To(Equal(corev1.ConditionFalse))
+	g.Expect(c.Reason).To(Equal(machinev1.WaitingExternalHookReason))
+	g.Expect(c.Message).To(Equal("waiting for hooks: pre-drain.delete.hook.machine.crit.sh/etcd, pre-drain.delete.hook.machine.crit.sh/storage"))
+
+	delete(m.Annotations, machinev1.PreDrainDeleteHookAnnotationPrefix+"/storage")
+	delete(m.Annotations, machinev1.PreDrainDeleteHookAnnotationPrefix+"/etcd")
+	g.Expect(r.reconcileDeleteHooks(m, machinev1.PreDrainDeleteHookAnnotationPrefix, machinev1.PreDrainDeleteHookSucceededCondition)).To(Succeed())
+	g.Expect(conditions.IsTrue(m, machinev1.PreDrainDeleteHookSucceededCondition)).To(BeTrue())
+
+	err = r.reconcileDeleteHooks(m, machinev1.PreTerminateDeleteHookAnnotationPrefix, machinev1.PreTerminateDeleteHookSucceededCondition)
+	g.Expect(mapierrors.IsRequeueAfter(err)).To(BeTrue())
+	g.Expect(conditions.IsTrue(m, machinev1.PreTerminateDeleteHookSucceededCondition)).To(BeFalse())
+}
@@ -22,20 +22,36 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/pointer"
 
 	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
 	mapierrors "github.com/criticalstack/machine-api/errors"
 	"github.com/criticalstack/machine-api/util"
+	"github.com/criticalstack/machine-api/util/conditions"
 	"github.com/criticalstack/machine-api/util/external"
 )
 
 // reconcileInfrastructure reconciles the Spec.InfrastructureRef object on a Machine.
 func (r *MachineReconciler) reconcileInfrastructure(ctx context.Context, m *machinev1.Machine) error {
 	if m.Spec.InfrastructureRef == nil {
-		r.Log.Info("infrastructure reference is empty", "machine", m.Name)
+		if m.Spec.InfrastructureTemplateRef == nil {
+			r.Log.Info("infrastructure reference is empty", "machine", m.Name)
+			return nil
+		}
+		if err := r.reconcileInfrastructureTemplate(ctx, m); err != nil || m.Spec.InfrastructureRef == nil {
+			return err
+		}
+	}
+
+	if _, err := r.infrastructureNamespace(m, m.Spec.InfrastructureRef); err != nil {
+		r.Log.Info("infrastructure reference is not allowed", "machine", m.Name, "namespace", m.Namespace, "cause", err.Error())
+		setFailure(m, machinev1.MachineFailureSourceInfrastructure, mapierrors.InvalidConfigMachineError, err.Error())
 		return nil
 	}
+	clearInvalidConfig(m, machinev1.MachineFailureSourceInfrastructure)
 
 	// Call generic external reconciler.
 	infraReconcileResult, err := r.reconcileExternal(ctx, m, m.Spec.InfrastructureRef)
@@ -43,14 +59,24 @@ func (r *MachineReconciler) reconcileInfrastructure(ctx context.Context, m *mach
 		if m.Status.InfrastructureReady && strings.Contains(err.Error(), "could not find") {
 			// Infra object went missing after the machine was up and running
 			r.Log.Error(err, "Machine infrastructure reference has been deleted after being ready, setting failure state")
-			m.Status.FailureReason = mapierrors.MachineStatusErrorPtr(mapierrors.InvalidConfigurationMachineError)
-			m.Status.FailureMessage = pointer.StringPtr(fmt.Sprintf("Machine infrastructure resource %v with name %q has been deleted after being ready",
-				m.Spec.InfrastructureRef.GroupVersionKind(), m.Spec.InfrastructureRef.Name))
+			setFailure(m, machinev1.MachineFailureSourceInfrastructure, mapierrors.InvalidConfigMachineError,
+				fmt.Sprintf("Machine infrastructure resource %v with name %q has been deleted after being ready",
+					m.Spec.InfrastructureRef.GroupVersionKind(), m.Spec.InfrastructureRef.Name))
 		}
 		return err
 	}
 	infraConfig := infraReconcileResult.Result
 
+	if infraReconcileResult.Paused {
+		conditions.Set(m, &machinev1.Condition{
+			Type:    machinev1.PausedCondition,
+			Status:  corev1.ConditionTrue,
+			Reason:  machinev1.InfrastructurePausedReason,
+			Message: fmt.Sprintf("%v %q is paused", infraConfig.GetKind(), infraConfig.GetName()),
+		})
+		return nil
+	}
+
 	if !infraConfig.GetDeletionTimestamp().IsZero() {
 		return nil
 	}
@@ -60,6 +86,9 @@ func (r *MachineReconciler) reconcileInfrastructure(ctx context.Context, m *mach
 	if err != nil {
 		return err
 	}
+	if ready && !m.Status.InfrastructureReady {
+		observeStartup(m, infrastructureReadyStage)
+	}
 	m.Status.InfrastructureReady = ready
 	if !ready {
 		return errors.Wrapf(&mapierrors.RequeueAfterError{RequeueAfter: r.externalReadyWait},
@@ -95,3 +124,75 @@ func (r *MachineReconciler) reconcileInfrastructure(ctx context.Context, m *mach
 	m.Spec.ProviderID = pointer.StringPtr(providerID)
 	return nil
 }
+
+// reconcileInfrastructureTemplate creates the infrastructure object of a
+// Machine from its Spec.InfrastructureTemplateRef, and sets
+// Spec.InfrastructureRef to it.
+//
+// The object is created in the namespace of the template. In the Machine
+// namespace it is named after the Machine and controlled by it; owner
+// references cannot cross namespaces, so in an allowed infrastructure
+// namespace it is named "<namespace>-<name>" after the Machine and tracked
+// with the Machine labels instead.
+func (r *MachineReconciler) reconcileInfrastructureTemplate(ctx context.Context, m *machinev1.Machine) error {
+	tmplRef := m.Spec.InfrastructureTemplateRef
+	namespace, err := r.infrastructureNamespace(m, tmplRef)
+	if err != nil {
+		r.Log.Info("infrastructure template reference is not allowed", "machine", m.Name, "namespace", m.Namespace, "cause", err.Error())
+		setFailure(m, machinev1.MachineFailureSourceInfrastructure, mapierrors.InvalidConfigMachineError, err.Error())
+		return nil
+	}
+	clearInvalidConfig(m, machinev1.MachineFailureSourceInfrastructure)
+
+	in := &external.CloneTemplateInput{
+		TemplateRef: tmplRef,
+		Namespace:   namespace,
+		Name:        m.Name,
+	}
+	if namespace == m.Namespace {
+		in.OwnerRef = metav1.NewControllerRef(m, machinev1.GroupVersion.WithKind("Machine"))
+	} else {
+		in.Name = fmt.Sprintf("%s-%s", m.Namespace, m.Name)
+		in.Labels = map[string]string{
+			machinev1.MachineNameLabel:      m.Name,
+			machinev1.MachineNamespaceLabel: m.Namespace,
+		}
+	}
+	ref, err := external.CloneTemplate(ctx, r.Client, in)
+	switch {
+	case err == nil:
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "SuccessfulCreateInfrastructure", "created %v %q from %v %q", ref.Kind, ref.Name, tmplRef.Kind, tmplRef.Name)
+	case apierrors.IsNotFound(errors.Cause(err)):
+		return errors.Wrapf(&mapierrors.RequeueAfterError{RequeueAfter: r.externalReadyWait},
+			"could not find %v %q for Machine %q in namespace %q, requeuing",
+			tmplRef.GroupVersionKind(), tmplRef.Name, m.Name, m.Namespace)
+	case apierrors.IsAlreadyExists(errors.Cause(err)):
+		// The object was created by an earlier reconciliation that failed
+		// to record it on the Machine, unless something else owns it.
+		ref = &corev1.ObjectReference{
+			APIVersion: tmplRef.APIVersion,
+			Kind:       strings.TrimSuffix(tmplRef.Kind, external.TemplateSuffix),
+			Name:       in.Name,
+			Namespace:  namespace,
+		}
+		obj, err := external.Get(ctx, r.Client, ref, namespace)
+		if err != nil {
+			return err
+		}
+		owned := isTrackedBy(m, obj)
+		if namespace == m.Namespace {
+			owner := metav1.GetControllerOf(obj)
+			owned = owner != nil && owner.UID == m.UID
+		}
+		if !owned {
+			setFailure(m, machinev1.MachineFailureSourceInfrastructure, mapierrors.InvalidConfigMachineError,
+				fmt.Sprintf("%v %q already exists and does not belong to the Machine", ref.Kind, ref.Name))
+			return nil
+		}
+		ref = external.GetObjectReference(obj)
+	default:
+		return err
+	}
+	m.Spec.InfrastructureRef = ref
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+)
+
+func TestReconcileInfrastructureTemplate(t *testing.T) {
+	newTemplate := func() *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{"image": "kindest/node"},
+				},
+			},
+		}}
+		u.SetAPIVersion("infrastructure.crit.sh/v1alpha1")
+		u.SetKind("DockerMachineTemplate")
+		u.SetName("worker")
+		u.SetNamespace("default")
+		return u
+	}
+	newMachine := func() *machinev1.Machine {
+		return &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default", UID: "machine-uid"},
+			Spec: machinev1.MachineSpec{
+				InfrastructureTemplateRef: &corev1.ObjectReference{
+					APIVersion: "infrastructure.crit.sh/v1alpha1",
+					Kind:       "DockerMachineTemplate",
+					Name:       "worker",
+				},
+			},
+		}
+	}
+	newReconciler := func(objs ...runtime.Object) *MachineReconciler {
+		return &MachineReconciler{
+			Client:   fake.NewFakeClientWithScheme(runtime.NewScheme(), objs...),
+			Log:      log.NullLogger{},
+			recorder: record.NewFakeRecorder(10),
+		}
+	}
+
+	t.Run("clones the template", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := newReconciler(newTemplate())
+		m := newMachine()
+		g.Expect(r.reconcileInfrastructureTemplate(context.Background(), m)).To(Succeed())
+		g.Expect(m.Spec.InfrastructureRef).NotTo(BeNil())
+		g.Expect(m.Spec.InfrastructureRef.Kind).To(Equal("DockerMachine"))
+		g.Expect(m.Spec.InfrastructureRef.Name).To(Equal("machine"))
+
+		obj := newInfraMachine()
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "machine"}, obj)).To(Succeed())
+		g.Expect(obj.GetLabels()).NotTo(HaveKey(machinev1.MachineNameLabel))
+		g.Expect(metav1.GetControllerOf(obj).UID).To(Equal(m.UID))
+
+		// A lost update of the Machine picks the object back up.
+		m.Spec.InfrastructureRef = nil
+		g.Expect(r.reconcileInfrastructureTemplate(context.Background(), m)).To(Succeed())
+		g.Expect(m.Spec.InfrastructureRef).NotTo(BeNil())
+		g.Expect(m.Status.FailureReason).To(BeNil())
+	})
+
+	t.Run("clones a template of another namespace", func(t *testing.T) {
+		g := NewWithT(t)
+
+		tmpl := newTemplate()
+		tmpl.SetNamespace("infra")
+		r := newReconciler(tmpl)
+		r.AllowedInfrastructureNamespaces = []string{"infra"}
+		m := newMachine()
+		m.Spec.InfrastructureTemplateRef.Namespace = "infra"
+		g.Expect(r.reconcileInfrastructureTemplate(context.Background(), m)).To(Succeed())
+		g.Expect(m.Spec.InfrastructureRef).NotTo(BeNil())
+		g.Expect(m.Spec.InfrastructureRef.Namespace).To(Equal("infra"))
+		g.Expect(m.Spec.InfrastructureRef.Name).To(Equal("default-machine"))
+
+		obj := newInfraMachine()
+		g.Expect(r.Get(context.Background(), client.ObjectKey{Namespace: "infra", Name: "default-machine"}, obj)).To(Succeed())
+		g.Expect(isTrackedBy(m, obj)).To(BeTrue())
+		g.Expect(obj.GetOwnerReferences()).To(BeEmpty())
+
+		// A lost update of the Machine picks the object back up.
+		m.Spec.InfrastructureRef = nil
+		g.Expect(r.reconcileInfrastructureTemplate(context.Background(), m)).To(Succeed())
+		g.Expect(m.Spec.InfrastructureRef).NotTo(BeNil())
+		g.Expect(m.Status.FailureReason).To(BeNil())
+	})
+
+	t.Run("fails on an existing object of another owner", func(t *testing.T) {
+		g := NewWithT(t)
+
+		existing := newInfraMachine()
+		existing.SetName("machine")
+		r := newReconciler(newTemplate(), existing)
+		m := newMachine()
+		g.Expect(r.reconcileInfrastructureTemplate(context.Background(), m)).To(Succeed())
+		g.Expect(m.Spec.InfrastructureRef).To(BeNil())
+		g.Expect(m.Status.FailureReason).NotTo(BeNil())
+	})
+
+	t.Run("waits for the template", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := newReconciler()
+		m := newMachine()
+		err := r.reconcileInfrastructureTemplate(context.Background(), m)
+		g.Expect(mapierrors.IsRequeueAfter(err)).To(BeTrue())
+		g.Expect(m.Spec.InfrastructureRef).To(BeNil())
+	})
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util/conditions"
+)
+
+// reconcileMachineClass builds a Machine from its MachineClass, filling the
+// defaults of the class into the unset fields of the Machine. This happens
+// once, later changes to the class are only reported through the
+// MachineClassUpToDate condition.
+func (r *MachineReconciler) reconcileMachineClass(ctx context.Context, m *machinev1.Machine) error {
+	if m.Spec.MachineClassName == "" {
+		conditions.Delete(m, machinev1.MachineClassUpToDateCondition)
+		return nil
+	}
+	mc := &machinev1.MachineClass{}
+	if err := r.Get(ctx, client.ObjectKey{Name: m.Spec.MachineClassName, Namespace: m.Namespace}, mc); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		conditions.Set(m, &machinev1.Condition{
+			Type:    machinev1.MachineClassUpToDateCondition,
+			Status:  corev1.ConditionFalse,
+			Reason:  machinev1.MachineClassNotFoundReason,
+			Message: fmt.Sprintf("MachineClass %q does not exist", m.Spec.MachineClassName),
+		})
+		if m.Status.MachineClassGeneration != 0 {
+			return nil
+		}
+		return errors.Wrapf(&mapierrors.RequeueAfterError{RequeueAfter: r.externalReadyWait},
+			"could not find MachineClass %q for Machine %q in namespace %q, requeuing",
+			m.Spec.MachineClassName, m.Name, m.Namespace)
+	}
+
+	if m.Status.MachineClassGeneration == 0 {
+		applyMachineClass(m, mc)
+		m.Status.MachineClassGeneration = mc.Generation
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "MachineClassApplied", "applied generation %d of MachineClass %q", mc.Generation, mc.Name)
+	}
+	if m.Status.MachineClassGeneration != mc.Generation {
+		conditions.Set(m, &machinev1.Condition{
+			Type:   machinev1.MachineClassUpToDateCondition,
+			Status: corev1.ConditionFalse,
+			Reason: machinev1.MachineClassOutdatedReason,
+			Message: fmt.Sprintf("Machine was built from generation %d of MachineClass %q, which is at generation %d",
+				m.Status.MachineClassGeneration, mc.Name, mc.Generation),
+		})
+		return nil
+	}
+	conditions.MarkTrue(m, machinev1.MachineClassUpToDateCondition)
+	return nil
+}
+
+// applyMachineClass fills the defaults of a MachineClass into the unset
+// fields of a Machine. Labels, annotations and taints are merged, with those
+// of the Machine winning.
+func applyMachineClass(m *machinev1.Machine, mc *machinev1.MachineClass) {
+	if m.Spec.ConfigRef.Name == "" && mc.Spec.ConfigRef != nil {
+		m.Spec.ConfigRef = *mc.Spec.ConfigRef
+	}
+	if m.Spec.InfrastructureRef == nil && m.Spec.InfrastructureTemplateRef == nil && mc.Spec.InfrastructureTemplateRef != nil {
+		ref := *mc.Spec.InfrastructureTemplateRef
+		m.Spec.InfrastructureTemplateRef = &ref
+	}
+	m.Spec.NodeLabels = mergeStringMap(m.Spec.NodeLabels, mc.Spec.NodeLabels)
+	m.Spec.NodeAnnotations = mergeStringMap(m.Spec.NodeAnnotations, mc.Spec.NodeAnnotations)
+	for _, t := range mc.Spec.NodeTaints {
+		found := false
+		for _, mt := range m.Spec.NodeTaints {
+			if mt.MatchTaint(&t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			m.Spec.NodeTaints = append(m.Spec.NodeTaints, t)
+		}
+	}
+	if m.Spec.Drain == nil && mc.Spec.Drain != nil {
+		m.Spec.Drain = mc.Spec.Drain.DeepCopy()
+	}
+	if m.Spec.NodeDrainTimeout == nil && mc.Spec.NodeDrainTimeout != nil {
+		timeout := *mc.Spec.NodeDrainTimeout
+		m.Spec.NodeDrainTimeout = &timeout
+	}
+}
+
+// mergeStringMap adds the entries of defaults that are missing from m.
+func mergeStringMap(m, defaults map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return m
+	}
+	if m == nil {
+		m = make(map[string]string, len(defaults))
+	}
+	for k, v := range defaults {
+		if _, ok := m[k]; !ok {
+			m[k] = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+	"github.com/criticalstack/machine-api/util/conditions"
+)
+
+func TestApplyMachineClass(t *testing.T) {
+	g := NewWithT(t)
+
+	mc := &machinev1.MachineClass{
+		Spec: machinev1.MachineClassSpec{
+			ConfigRef:                 &corev1.ObjectReference{Name: "worker"},
+			InfrastructureTemplateRef: &corev1.ObjectReference{Kind: "DockerMachineTemplate", Name: "worker"},
+			NodeLabels:                map[string]string{"role": "worker", "zone": "a"},
+			NodeTaints: []corev1.Taint{
+				{Key: "dedicated", Value: "class", Effect: corev1.TaintEffectNoSchedule},
+				{Key: "gpu", Effect: corev1.TaintEffectNoSchedule},
+			},
+			NodeDrainTimeout: &metav1.Duration{Duration: time.Minute},
+		},
+	}
+	m := &machinev1.Machine{
+		Spec: machinev1.MachineSpec{
+			ConfigRef:  corev1.ObjectReference{Name: "custom"},
+			NodeLabels: map[string]string{"zone": "b"},
+			NodeTaints: []corev1.Taint{
+				{Key: "dedicated", Value: "machine", Effect: corev1.TaintEffectNoSchedule},
+			},
+		},
+	}
+	applyMachineClass(m, mc)
+	g.Expect(m.Spec.ConfigRef.Name).To(Equal("custom"))
+	g.Expect(m.Spec.InfrastructureTemplateRef).To(Equal(mc.Spec.InfrastructureTemplateRef))
+	g.Expect(m.Spec.NodeLabels).To(Equal(map[string]string{"role": "worker", "zone": "b"}))
+	g.Expect(m.Spec.NodeTaints).To(ConsistOf(
+		corev1.Taint{Key: "dedicated", Value: "machine", Effect: corev1.TaintEffectNoSchedule},
+		corev1.Taint{Key: "gpu", Effect: corev1.TaintEffectNoSchedule},
+	))
+	g.Expect(m.Spec.NodeDrainTimeout.Duration).To(Equal(time.Minute))
+	g.Expect(m.Spec.Drain).To(BeNil())
+}
+
+func TestReconcileMachineClass(t *testing.T) {
+	g := NewWithT(t)
+
+	mc := &machinev1.MachineClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "default", Generation: 1},
+		Spec: machinev1.MachineClassSpec{
+			ConfigRef: &corev1.ObjectReference{Name: "worker"},
+		},
+	}
+	c := fake.NewFakeClientWithScheme(newTestScheme())
+	r := &MachineReconciler{
+		Client:            c,
+		Log:               log.NullLogger{},
+		recorder:          record.NewFakeRecorder(10),
+		externalReadyWait: time.Second,
+	}
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "default"},
+		Spec:       machinev1.MachineSpec{MachineClassName: "worker"},
+	}
+
+	// Waits for the class before building the Machine.
+	err := r.reconcileMachineClass(context.Background(), m)
+	g.Expect(mapierrors.IsRequeueAfter(err)).To(BeTrue())
+	g.Expect(conditions.Get(m, machinev1.MachineClassUpToDateCondition).Reason).To(Equal(machinev1.MachineClassNotFoundReason))
+
+	g.Expect(c.Create(context.Background(), mc)).To(Succeed())
+	g.Expect(r.reconcileMachineClass(context.Background(), m)).To(Succeed())
+	g.Expect(m.Spec.ConfigRef.Name).To(Equal("worker"))
+	g.Expect(m.Status.MachineClassGeneration).To(Equal(int64(1)))
+	g.Expect(conditions.IsTrue(m, machinev1.MachineClassUpToDateCondition)).To(BeTrue())
+
+	// Changes to the class are reported, but not applied.
+	mc.Spec.ConfigRef.Name = "other"
+	mc.Generation = 2
+	g.Expect(c.Update(context.Background(), mc)).To(Succeed())
+	g.Expect(r.reconcileMachineClass(context.Background(), m)).To(Succeed())
+	g.Expect(m.Spec.ConfigRef.Name).To(Equal("worker"))
+	g.Expect(m.Status.MachineClassGeneration).To(Equal(int64(1)))
+	g.Expect(conditions.Get(m, machinev1.MachineClassUpToDateCondition).Reason).To(Equal(machinev1.MachineClassOutdatedReason))
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+// Stages of the startup of a Machine, measured from its creation.
+const (
+	infrastructureReadyStage = "infrastructure_ready"
+	nodeRefStage             = "node_ref"
+	runningStage             = "running"
+)
+
+var (
+	machineStartupDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "machine_api_machine_startup_duration_seconds",
+			Help:    "Time from the creation of a machine to the infrastructure being ready, the node being linked, and the machine running.",
+			Buckets: prometheus.ExponentialBuckets(10, 2, 10),
+		},
+		[]string{"stage"},
+	)
+	nodeDrainDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "machine_api_node_drain_duration_seconds",
+			Help:    "Time taken to drain the node of a deleted machine.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		},
+	)
+	nodeDrainFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "machine_api_node_drain_failures_total",
+			Help: "Number of failed attempts to drain the node of a deleted machine, by reason.",
+		},
+		[]string{"reason"},
+	)
+	machineDeletionDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "machine_api_machine_deletion_duration_seconds",
+			Help:    "Time from the deletion of a machine to the removal of its finalizer.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		machineStartupDuration,
+		nodeDrainDuration,
+		nodeDrainFailuresTotal,
+		machineDeletionDuration,
+	)
+}
+
+// observeStartup observes the time since the creation of a Machine for a
+// stage of its startup.
+func observeStartup(m *machinev1.Machine, stage string) {
+	if m.CreationTimestamp.IsZero() {
+		return
+	}
+	machineStartupDuration.WithLabelValues(stage).Observe(time.Since(m.CreationTimestamp.Time).Seconds())
+}
+
+var machinesDesc = prometheus.NewDesc(
+	"machine_api_machines",
+	"Number of machines, by namespace, phase and infrastructure kind.",
+	[]string{"namespace", "phase", "infrastructure_kind"},
+	nil,
+)
+
+// machineCollector counts the Machines in the cache of the manager each
+// time metrics are scraped, so Machines that are gone are never reported.
+type machineCollector struct {
+	client client.Reader
+	log    logr.Logger
+}
+
+func (c *machineCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- machinesDesc
+}
+
+func (c *machineCollector) Collect(ch chan<- prometheus.Metric) {
+	machines := &machinev1.MachineList{}
+	if err := c.client.List(context.Background(), machines); err != nil {
+		c.log.Error(err, "cannot list machines for metrics")
+		return
+	}
+	type key struct {
+		namespace, phase, kind string
+	}
+	counts := make(map[key]int)
+	for _, m := range machines.Items {
+		k := key{namespace: m.Namespace, phase: string(m.Status.Phase)}
+		if m.Spec.InfrastructureRef != nil {
+			k.kind = m.Spec.InfrastructureRef.Kind
+		}
+		counts[k]++
+	}
+	for k, n := range counts {
+		ch <- prometheus.MustNewConstMetric(machinesDesc, prometheus.GaugeValue, float64(n), k.namespace, k.phase, k.kind)
+	}
+}
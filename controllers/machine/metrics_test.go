@@ -0,0 +1,173 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	"github.com/criticalstack/machine-api/util/conditions"
+)
+
+func sampleCount(t *testing.T, o prometheus.Observer) uint64 {
+	m := &dto.Metric{}
+	if err := o.(prometheus.Metric).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMachineCollector(t *testing.T) {
+	g := NewWithT(t)
+
+	newMachine := func(name, namespace string, phase machinev1.MachinePhase, kind string) *machinev1.Machine {
+		m := &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Status:     machinev1.MachineStatus{Phase: phase},
+		}
+		if kind != "" {
+			m.Spec.InfrastructureRef = &corev1.ObjectReference{Kind: kind, Name: name}
+		}
+		return m
+	}
+	c := &machineCollector{
+		client: fake.NewFakeClientWithScheme(newTestScheme(),
+			newMachine("a", "default", machinev1.MachineRunning, "AWSMachine"),
+			newMachine("b", "default", machinev1.MachineRunning, "AWSMachine"),
+			newMachine("c", "default", machinev1.MachinePending, ""),
+			newMachine("d", "other", machinev1.MachineRunning, "DockerMachine"),
+		),
+		log: log.NullLogger{},
+	}
+	g.Expect(testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP machine_api_machines Number of machines, by namespace, phase and infrastructure kind.
+# TYPE machine_api_machines gauge
+machine_api_machines{infrastructure_kind="",namespace="default",phase="Pending"} 1
+machine_api_machines{infrastructure_kind="AWSMachine",namespace="default",phase="Running"} 2
+machine_api_machines{infrastructure_kind="DockerMachine",namespace="other",phase="Running"} 1
+`))).To(Succeed())
+}
+
+func TestSetPhaseObservesStartup(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &MachineReconciler{recorder: record.NewFakeRecorder(10)}
+	running := machineStartupDuration.WithLabelValues(runningStage)
+	before := sampleCount(t, running)
+	m := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Minute))}}
+
+	r.setPhase(m, machinev1.MachineProvisioned)
+	g.Expect(sampleCount(t, running)).To(Equal(before))
+	r.setPhase(m, machinev1.MachineRunning)
+	g.Expect(sampleCount(t, running)).To(Equal(before + 1))
+
+	// A Machine that comes back after its Node stopped reporting has
+	// already started.
+	r.setPhase(m, machinev1.MachineUnknown)
+	r.setPhase(m, machinev1.MachineRunning)
+	g.Expect(sampleCount(t, running)).To(Equal(before + 1))
+
+	// Neither does a Machine whose Node flaps to NotReady.
+	m.Status.NodeRef = &corev1.ObjectReference{Name: "node"}
+	notReady := &corev1.Node{Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionFalse}}}}
+	r.setPhase(m, machinePhase(m, true, notReady))
+	g.Expect(m.Status.Phase).To(Equal(machinev1.MachineUnknown))
+	r.setPhase(m, machinev1.MachineRunning)
+	g.Expect(sampleCount(t, running)).To(Equal(before + 1))
+}
+
+func TestReconcileDrainTimeoutMetric(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &MachineReconciler{Log: log.NullLogger{}, recorder: record.NewFakeRecorder(1)}
+	started := metav1.NewTime(time.Now().Add(-time.Hour))
+	m := &machinev1.Machine{
+		Spec: machinev1.MachineSpec{NodeDrainTimeout: &metav1.Duration{Duration: time.Minute}},
+		Status: machinev1.MachineStatus{
+			NodeRef:            &corev1.ObjectReference{Name: "node"},
+			NodeDrainStartTime: &started,
+		},
+	}
+	counter := nodeDrainFailuresTotal.WithLabelValues("NodeDrainTimeout")
+	before := testutil.ToFloat64(counter)
+	g.Expect(r.reconcileDrain(context.Background(), m)).To(Succeed())
+	g.Expect(testutil.ToFloat64(counter)).To(Equal(before + 1))
+	g.Expect(conditions.Get(m, machinev1.NodeDrainedCondition).Reason).To(Equal(machinev1.NodeDrainTimeoutReason))
+
+	// Requeues of the deleting Machine do not count the timeout again.
+	g.Expect(r.reconcileDrain(context.Background(), m)).To(Succeed())
+	g.Expect(testutil.ToFloat64(counter)).To(Equal(before + 1))
+}
+
+// failingPatchClient fails to patch objects.
+type failingPatchClient struct {
+	client.Client
+}
+
+func (c failingPatchClient) Patch(context.Context, runtime.Object, client.Patch, ...client.PatchOption) error {
+	return errors.New("patch failed")
+}
+
+func TestReconcileDeleteMetric(t *testing.T) {
+	g := NewWithT(t)
+
+	deleted := metav1.NewTime(time.Now().Add(-time.Minute))
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "machine",
+			Namespace:         "default",
+			DeletionTimestamp: &deleted,
+			Finalizers:        []string{machinev1.MachineFinalizer},
+		},
+	}
+	c := fake.NewFakeClientWithScheme(newTestScheme(), m)
+	r := &MachineReconciler{
+		Client:   failingPatchClient{c},
+		Log:      log.NullLogger{},
+		recorder: record.NewFakeRecorder(10),
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKey{Name: m.Name, Namespace: m.Namespace}}
+	before := sampleCount(t, machineDeletionDuration)
+
+	// The deletion is not observed until the finalizer removal is patched.
+	_, err := r.Reconcile(req)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(sampleCount(t, machineDeletionDuration)).To(Equal(before))
+
+	r.Client = c
+	_, err = r.Reconcile(req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sampleCount(t, machineDeletionDuration)).To(Equal(before + 1))
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+// reconcileNodeMetadata keeps the labels, annotations and taints from the
+// Machine spec reconciled onto the linked Node. Only the keys recorded in the
+// owned annotations on the Node are ever updated or removed, so changes made
+// by the kubelet or other managers are left alone.
+func (r *MachineReconciler) reconcileNodeMetadata(ctx context.Context, m *machinev1.Machine) error {
+	if m.Status.NodeRef == nil {
+		return nil
+	}
+
+	node := &corev1.Node{}
+	if err := r.Get(ctx, client.ObjectKey{Name: m.Status.NodeRef.Name}, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	ref, err := json.Marshal(corev1.ObjectReference{
+		APIVersion: machinev1.GroupVersion.String(),
+		Kind:       "Machine",
+		Name:       m.Name,
+		Namespace:  m.Namespace,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Clearing the resourceVersion of the original object makes the merge
+	// patch include it, so the patch fails on conflict rather than
+	// overwriting taints that were changed concurrently.
+	orig := node.DeepCopy()
+	orig.ResourceVersion = ""
+
+	var ownedLabels, ownedAnnotations, ownedTaints []string
+	node.Labels, ownedLabels = syncOwnedMap(node.Labels, m.Spec.NodeLabels, parseOwned(node.Annotations[machinev1.NodeOwnedLabelsAnnotation]))
+	desiredAnnotations := make(map[string]string)
+	for k, v := range m.Spec.NodeAnnotations {
+		switch k {
+		case machinev1.NodeOwnerLabelName, machinev1.NodeOwnedLabelsAnnotation, machinev1.NodeOwnedAnnotationsAnnotation, machinev1.NodeOwnedTaintsAnnotation:
+			continue
+		}
+		desiredAnnotations[k] = v
+	}
+	node.Annotations, ownedAnnotations = syncOwnedMap(node.Annotations, desiredAnnotations, parseOwned(node.Annotations[machinev1.NodeOwnedAnnotationsAnnotation]))
+	node.Spec.Taints, ownedTaints = syncOwnedTaints(node.Spec.Taints, m.Spec.NodeTaints, parseOwned(node.Annotations[machinev1.NodeOwnedTaintsAnnotation]))
+
+	if node.Annotations == nil {
+		node.Annotations = make(map[string]string)
+	}
+	node.Annotations[machinev1.NodeOwnerLabelName] = string(ref)
+	setOwned(node.Annotations, machinev1.NodeOwnedLabelsAnnotation, ownedLabels)
+	setOwned(node.Annotations, machinev1.NodeOwnedAnnotationsAnnotation, ownedAnnotations)
+	setOwned(node.Annotations, machinev1.NodeOwnedTaintsAnnotation, ownedTaints)
+
+	if reflect.DeepEqual(orig.ObjectMeta.Labels, node.Labels) &&
+		reflect.DeepEqual(orig.ObjectMeta.Annotations, node.Annotations) &&
+		reflect.DeepEqual(orig.Spec.Taints, node.Spec.Taints) {
+		return nil
+	}
+	if err := r.Patch(ctx, node, client.MergeFrom(orig)); err != nil {
+		return errors.Wrapf(err, "failed to update metadata of node %q for Machine %q in namespace %q", node.Name, m.Name, m.Namespace)
+	}
+	return nil
+}
+
+// syncOwnedMap sets the desired keys in current and removes the keys that
+// were previously owned but are no longer desired. It returns the updated map
+// along with the new set of owned keys.
+func syncOwnedMap(current, desired map[string]string, owned []string) (map[string]string, []string) {
+	if current == nil {
+		if len(desired) == 0 {
+			return nil, nil
+		}
+		current = make(map[string]string)
+	}
+	for _, k := range owned {
+		if _, ok := desired[k]; !ok {
+			delete(current, k)
+		}
+	}
+	keys := make([]string, 0, len(desired))
+	for k, v := range desired {
+		current[k] = v
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return current, keys
+}
+
+// syncOwnedTaints adds or updates the desired taints and removes the taints
+// that were previously owned but are no longer desired, identifying taints by
+// key and effect. It returns the updated taints along with the new set of
+// owned taints.
+func syncOwnedTaints(current, desired []corev1.Taint, owned []string) ([]corev1.Taint, []string) {
+	desiredKeys := make(map[string]corev1.Taint)
+	keys := make([]string, 0, len(desired))
+	for _, t := range desired {
+		desiredKeys[taintKey(t)] = t
+		keys = append(keys, taintKey(t))
+	}
+	sort.Strings(keys)
+	ownedKeys := make(map[string]bool)
+	for _, k := range owned {
+		ownedKeys[k] = true
+	}
+
+	taints := make([]corev1.Taint, 0, len(current)+len(desired))
+	for _, t := range current {
+		k := taintKey(t)
+		if d, ok := desiredKeys[k]; ok {
+			t.Value = d.Value
+			delete(desiredKeys, k)
+		} else if ownedKeys[k] {
+			continue
+		}
+		taints = append(taints, t)
+	}
+	for _, t := range desired {
+		if _, ok := desiredKeys[taintKey(t)]; ok {
+			taints = append(taints, t)
+		}
+	}
+	if len(taints) == 0 {
+		return nil, keys
+	}
+	return taints, keys
+}
+
+func taintKey(t corev1.Taint) string {
+	return t.Key + ":" + string(t.Effect)
+}
+
+func parseOwned(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func setOwned(annotations map[string]string, key string, owned []string) {
+	if len(owned) == 0 {
+		delete(annotations, key)
+		return
+	}
+	annotations[key] = strings.Join(owned, ",")
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSyncOwnedMap(t *testing.T) {
+	cases := []struct {
+		name          string
+		current       map[string]string
+		desired       map[string]string
+		owned         []string
+		expected      map[string]string
+		expectedOwned []string
+	}{
+		{
+			name:          "adds desired keys",
+			current:       map[string]string{"kubernetes.io/hostname": "node-1"},
+			desired:       map[string]string{"pool": "gpu", "team": "infra"},
+			expected:      map[string]string{"kubernetes.io/hostname": "node-1", "pool": "gpu", "team": "infra"},
+			expectedOwned: []string{"pool", "team"},
+		},
+		{
+			name:          "removes previously owned keys only",
+			current:       map[string]string{"kubernetes.io/hostname": "node-1", "pool": "gpu", "team": "infra", "other": "x"},
+			desired:       map[string]string{"pool": "cpu"},
+			owned:         []string{"pool", "team"},
+			expected:      map[string]string{"kubernetes.io/hostname": "node-1", "pool": "cpu", "other": "x"},
+			expectedOwned: []string{"pool"},
+		},
+		{
+			name:          "takes ownership of existing keys",
+			current:       map[string]string{"pool": "manual"},
+			desired:       map[string]string{"pool": "gpu"},
+			expected:      map[string]string{"pool": "gpu"},
+			expectedOwned: []string{"pool"},
+		},
+		{
+			name:          "nothing desired on empty map",
+			expected:      nil,
+			expectedOwned: nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			actual, owned := syncOwnedMap(tc.current, tc.desired, tc.owned)
+			g.Expect(actual).To(Equal(tc.expected))
+			if len(tc.expectedOwned) == 0 {
+				g.Expect(owned).To(BeEmpty())
+			} else {
+				g.Expect(owned).To(Equal(tc.expectedOwned))
+			}
+		})
+	}
+}
+
+func TestSyncOwnedTaints(t *testing.T) {
+	notReady := corev1.Taint{Key: "node.kubernetes.io/not-ready", Effect: corev1.TaintEffectNoSchedule}
+	gpu := corev1.Taint{Key: "gpu", Value: "true", Effect: corev1.TaintEffectNoSchedule}
+
+	cases := []struct {
+		name          string
+		current       []corev1.Taint
+		desired       []corev1.Taint
+		owned         []string
+		expected      []corev1.Taint
+		expectedOwned []string
+	}{
+		{
+			name:          "adds desired taints",
+			current:       []corev1.Taint{notReady},
+			desired:       []corev1.Taint{gpu},
+			expected:      []corev1.Taint{notReady, gpu},
+			expectedOwned: []string{"gpu:NoSchedule"},
+		},
+		{
+			name:          "updates value of owned taint",
+			current:       []corev1.Taint{notReady, {Key: "gpu", Value: "false", Effect: corev1.TaintEffectNoSchedule}},
+			desired:       []corev1.Taint{gpu},
+			owned:         []string{"gpu:NoSchedule"},
+			expected:      []corev1.Taint{notReady, gpu},
+			expectedOwned: []string{"gpu:NoSchedule"},
+		},
+		{
+			name:     "removes owned taints no longer desired",
+			current:  []corev1.Taint{notReady, gpu},
+			owned:    []string{"gpu:NoSchedule"},
+			expected: []corev1.Taint{notReady},
+		},
+		{
+			name:     "keeps taints owned by others",
+			current:  []corev1.Taint{notReady},
+			owned:    []string{"gpu:NoSchedule"},
+			expected: []corev1.Taint{notReady},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			actual, owned := syncOwnedTaints(tc.current, tc.desired, tc.owned)
+			g.Expect(actual).To(Equal(tc.expected))
+			if len(tc.expectedOwned) == 0 {
+				g.Expect(owned).To(BeEmpty())
+			} else {
+				g.Expect(owned).To(Equal(tc.expectedOwned))
+			}
+		})
+	}
+}
@@ -55,6 +55,7 @@ func (r *MachineReconciler) reconcileNodeRef(ctx context.Context, m *machinev1.M
 			v, _ := semver.Parse(strings.TrimPrefix(node.Status.NodeInfo.KubeletVersion, "v"))
 			m.Status.SetVersion(v.String())
 			log.Info("Set Machine's NodeRef", "noderef", m.Status.NodeRef.Name)
+			observeStartup(m, nodeRefStage)
 			r.recorder.Event(m, corev1.EventTypeNormal, "SuccessfulSetNodeRef", m.Status.NodeRef.Name)
 			return nil
 		}
@@ -19,25 +19,138 @@ package machine
 import (
 	"context"
 
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
 	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	"github.com/criticalstack/machine-api/util/external"
 )
 
+// reconcilePhase gathers the observed state of the infrastructure object and
+// the Node for a Machine and moves the Machine to the resulting phase.
 func (r *MachineReconciler) reconcilePhase(ctx context.Context, m *machinev1.Machine) {
-	if m.Status.Phase == "" {
-		m.Status.Phase = machinev1.MachinePending
+	log := r.Log.WithValues("machine", m.Name, "namespace", m.Namespace)
+
+	infraExists := false
+	if m.Spec.InfrastructureRef != nil {
+		// An infrastructure object in a namespace that is not allowed is
+		// never looked at.
+		if namespace, err := r.infrastructureNamespace(m, m.Spec.InfrastructureRef); err == nil {
+			_, err := external.Get(ctx, r.Client, m.Spec.InfrastructureRef, namespace)
+			switch {
+			case err == nil:
+				infraExists = true
+			case !apierrors.IsNotFound(errors.Cause(err)):
+				log.Error(err, "cannot determine if infrastructure exists, keeping current phase")
+				return
+			}
+		}
 	}
 
+	var node *corev1.Node
 	if m.Status.NodeRef != nil {
-		m.Status.Phase = machinev1.MachineRunning
+		node = &corev1.Node{}
+		if err := r.Get(ctx, client.ObjectKey{Name: m.Status.NodeRef.Name}, node); err != nil {
+			if !apierrors.IsNotFound(err) {
+				log.Error(err, "cannot get node, keeping current phase", "node", m.Status.NodeRef.Name)
+				return
+			}
+			node = nil
+		}
 	}
 
-	// Set the phase to "failed" if any of Status.FailureReason or Status.FailureMessage is not-nil.
-	if m.Status.FailureReason != nil || m.Status.FailureMessage != nil {
-		m.Status.Phase = machinev1.MachineFailed
+	r.setPhase(m, machinePhase(m, infraExists, node))
+}
+
+// setPhase sets the phase of the Machine, recording an event whenever the
+// phase changes.
+func (r *MachineReconciler) setPhase(m *machinev1.Machine, phase machinev1.MachinePhase) {
+	if m.Status.Phase == phase {
+		return
 	}
+	if m.Status.Phase == "" {
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "PhaseChanged", "Machine phase set to %s", phase)
+	} else {
+		r.recorder.Eventf(m, corev1.EventTypeNormal, "PhaseChanged", "Machine phase changed from %s to %s", m.Status.Phase, phase)
+	}
+	// Machines coming back to Running from Unknown have started before and
+	// are not observed again.
+	switch m.Status.Phase {
+	case "", machinev1.MachinePending, machinev1.MachineProvisioning, machinev1.MachineProvisioned:
+		if phase == machinev1.MachineRunning {
+			observeStartup(m, runningStage)
+		}
+	}
+	m.Status.Phase = phase
+}
 
-	// Set the phase to "deleting" if the deletion timestamp is set.
+// machinePhase determines the phase of a Machine:
+//
+//	Pending:      the infrastructure object is not referenced or does not
+//	              exist yet
+//	Provisioning: the infrastructure object exists but is not ready
+//	Provisioned:  the infrastructure is ready, waiting for the Node
+//	Running:      the Node is linked and Ready
+//	Unknown:      the Node is linked but has stopped reporting its status,
+//	              or is no longer Ready after having been Running
+//	Failed:       a failure reason or message is set
+//	Terminating:  the Machine is being deleted
+func machinePhase(m *machinev1.Machine, infraExists bool, node *corev1.Node) machinev1.MachinePhase {
+	// Set the phase to "Terminating" if the deletion timestamp is set.
 	if !m.DeletionTimestamp.IsZero() {
-		m.Status.Phase = machinev1.MachineTerminating
+		return machinev1.MachineTerminating
+	}
+
+	// Set the phase to "Failed" if any of Status.FailureReason or
+	// Status.FailureMessage is not-nil.
+	if m.Status.FailureReason != nil || m.Status.FailureMessage != nil {
+		return machinev1.MachineFailed
+	}
+
+	if m.Status.NodeRef != nil {
+		if node == nil {
+			return machinev1.MachineUnknown
+		}
+		switch nodeReadyStatus(node) {
+		case corev1.ConditionTrue:
+			return machinev1.MachineRunning
+		case corev1.ConditionFalse:
+			// A Node that has been Ready before is flapping rather than
+			// joining, and does not move the Machine back to a pre-join
+			// phase.
+			if hasRun(m) {
+				return machinev1.MachineUnknown
+			}
+			return machinev1.MachineProvisioned
+		default:
+			return machinev1.MachineUnknown
+		}
+	}
+
+	if m.Status.InfrastructureReady {
+		return machinev1.MachineProvisioned
+	}
+	if infraExists {
+		return machinev1.MachineProvisioning
+	}
+	return machinev1.MachinePending
+}
+
+// hasRun returns whether the Machine has been Running, as it is Running or
+// Unknown.
+func hasRun(m *machinev1.Machine) bool {
+	return m.Status.Phase == machinev1.MachineRunning || m.Status.Phase == machinev1.MachineUnknown
+}
+
+// nodeReadyStatus returns the status of the NodeReady condition, or
+// ConditionUnknown if the Node has not reported it.
+func nodeReadyStatus(node *corev1.Node) corev1.ConditionStatus {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status
+		}
 	}
+	return corev1.ConditionUnknown
 }
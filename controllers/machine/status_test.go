@@ -0,0 +1,167 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	mapierrors "github.com/criticalstack/machine-api/errors"
+)
+
+func TestMachinePhase(t *testing.T) {
+	now := metav1.Now()
+	nodeRef := &corev1.ObjectReference{Kind: "Node", Name: "node-1"}
+	nodeWithReady := func(status corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{
+					{Type: corev1.NodeReady, Status: status},
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		name        string
+		machine     machinev1.Machine
+		infraExists bool
+		node        *corev1.Node
+		expected    machinev1.MachinePhase
+	}{
+		{
+			name:     "new machine without infrastructure",
+			expected: machinev1.MachinePending,
+		},
+		{
+			name: "infrastructure referenced but missing",
+			machine: machinev1.Machine{
+				Spec: machinev1.MachineSpec{InfrastructureRef: &corev1.ObjectReference{Name: "infra"}},
+			},
+			expected: machinev1.MachinePending,
+		},
+		{
+			name: "infrastructure exists but is not ready",
+			machine: machinev1.Machine{
+				Spec: machinev1.MachineSpec{InfrastructureRef: &corev1.ObjectReference{Name: "infra"}},
+			},
+			infraExists: true,
+			expected:    machinev1.MachineProvisioning,
+		},
+		{
+			name: "infrastructure ready without node",
+			machine: machinev1.Machine{
+				Spec:   machinev1.MachineSpec{InfrastructureRef: &corev1.ObjectReference{Name: "infra"}},
+				Status: machinev1.MachineStatus{InfrastructureReady: true},
+			},
+			infraExists: true,
+			expected:    machinev1.MachineProvisioned,
+		},
+		{
+			name: "node linked but not ready",
+			machine: machinev1.Machine{
+				Status: machinev1.MachineStatus{InfrastructureReady: true, NodeRef: nodeRef},
+			},
+			infraExists: true,
+			node:        nodeWithReady(corev1.ConditionFalse),
+			expected:    machinev1.MachineProvisioned,
+		},
+		{
+			name: "running node no longer ready",
+			machine: machinev1.Machine{
+				Status: machinev1.MachineStatus{InfrastructureReady: true, NodeRef: nodeRef, Phase: machinev1.MachineRunning},
+			},
+			infraExists: true,
+			node:        nodeWithReady(corev1.ConditionFalse),
+			expected:    machinev1.MachineUnknown,
+		},
+		{
+			name: "node linked and ready",
+			machine: machinev1.Machine{
+				Status: machinev1.MachineStatus{InfrastructureReady: true, NodeRef: nodeRef},
+			},
+			infraExists: true,
+			node:        nodeWithReady(corev1.ConditionTrue),
+			expected:    machinev1.MachineRunning,
+		},
+		{
+			name: "node stopped reporting",
+			machine: machinev1.Machine{
+				Status: machinev1.MachineStatus{InfrastructureReady: true, NodeRef: nodeRef, Phase: machinev1.MachineRunning},
+			},
+			infraExists: true,
+			node:        nodeWithReady(corev1.ConditionUnknown),
+			expected:    machinev1.MachineUnknown,
+		},
+		{
+			name: "node without ready condition",
+			machine: machinev1.Machine{
+				Status: machinev1.MachineStatus{InfrastructureReady: true, NodeRef: nodeRef},
+			},
+			infraExists: true,
+			node:        &corev1.Node{},
+			expected:    machinev1.MachineUnknown,
+		},
+		{
+			name: "linked node is gone",
+			machine: machinev1.Machine{
+				Status: machinev1.MachineStatus{InfrastructureReady: true, NodeRef: nodeRef, Phase: machinev1.MachineRunning},
+			},
+			infraExists: true,
+			expected:    machinev1.MachineUnknown,
+		},
+		{
+			name: "failure reported",
+			machine: machinev1.Machine{
+				Status: machinev1.MachineStatus{
+					InfrastructureReady: true,
+					NodeRef:             nodeRef,
+					FailureReason:       mapierrors.MachineStatusErrorPtr(mapierrors.CreateMachineError),
+					FailureMessage:      pointer.StringPtr("instance terminated"),
+				},
+			},
+			infraExists: true,
+			node:        nodeWithReady(corev1.ConditionTrue),
+			expected:    machinev1.MachineFailed,
+		},
+		{
+			name: "deleting machine",
+			machine: machinev1.Machine{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &now},
+				Status: machinev1.MachineStatus{
+					FailureMessage: pointer.StringPtr("instance terminated"),
+				},
+			},
+			expected: machinev1.MachineTerminating,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(machinePhase(&tc.machine, tc.infraExists, tc.node)).To(Equal(tc.expected))
+		})
+	}
+}
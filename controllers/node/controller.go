@@ -19,21 +19,21 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"time"
 
-	nodeutil "github.com/criticalstack/crit/pkg/kubernetes/util/node"
 	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 
 	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	"github.com/criticalstack/machine-api/util/index"
 )
 
 // NodeReconciler reconciles a corev1.Node object and creates Machine objects
@@ -44,20 +44,28 @@ type NodeReconciler struct {
 	Log    logr.Logger
 	Scheme *runtime.Scheme
 
-	config *rest.Config
+	// Namespace is the namespace adopted Machines are created in.
+	Namespace string
+
+	// AdoptionDelay is the minimum age of a Node before it is adopted. It
+	// gives Machines provisioned by the machine-api time to link their Node
+	// before it is mistaken for an unmanaged one.
+	AdoptionDelay time.Duration
 }
 
 func (r *NodeReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
-	r.config = mgr.GetConfig()
+	if r.Namespace == "" {
+		r.Namespace = metav1.NamespaceSystem
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		WithOptions(options).
 		For(&corev1.Node{}).
 		Complete(r)
 }
 
-// +kubebuilder:rbac:groups=machine.crit.sh,resources=machines;machines/status,verbs=get;list;watch
-// +kubebuilder:rbac:groups=machine.crit.sh,resources=configs;configs/status,verbs=get;list;watch
-// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=machine.crit.sh,resources=machines,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=machine.crit.sh,resources=machines/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;patch
 
 func (r *NodeReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -66,69 +74,112 @@ func (r *NodeReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	n := &corev1.Node{}
 	if err := r.Get(ctx, req.NamespacedName, n); err != nil {
 		if apierrors.IsNotFound(err) {
-			// TODO(chrism): handle node deletion?
-			return ctrl.Result{}, nil
+			return ctrl.Result{}, r.deleteAdoptedMachines(ctx, req.Name)
 		}
 		return ctrl.Result{}, err
 	}
 
-	annotations := n.GetAnnotations()
-	if _, ok := annotations[machinev1.NodeOwnerLabelName]; !ok {
-		log.Info("machine label not found")
-		if err := r.ensureMachineForNode(ctx, n); err != nil {
-			return ctrl.Result{}, err
-		}
+	if _, ok := n.Annotations[machinev1.NodeOwnerLabelName]; ok {
+		return ctrl.Result{}, nil
+	}
+	if age := time.Since(n.CreationTimestamp.Time); age < r.AdoptionDelay {
+		return ctrl.Result{RequeueAfter: r.AdoptionDelay - age}, nil
 	}
-	return ctrl.Result{}, nil
+	log.Info("machine annotation not found")
+	return ctrl.Result{}, r.ensureMachineForNode(ctx, n)
 }
 
 func (r *NodeReconciler) ensureMachineForNode(ctx context.Context, n *corev1.Node) error {
 	log := r.Log.WithValues("node", n.Name)
 
-	machines := &machinev1.MachineList{}
-	if err := r.List(ctx, machines); err != nil {
-		return err
-	}
-	for _, m := range machines.Items {
-		if m.Spec.ProviderID != nil && *m.Spec.ProviderID != "" && *m.Spec.ProviderID == n.Spec.ProviderID {
+	if n.Spec.ProviderID != "" {
+		machines := &machinev1.MachineList{}
+		if err := r.List(ctx, machines, client.MatchingFields{index.MachineProviderIDField: n.Spec.ProviderID}); err != nil {
+			return err
+		}
+		if len(machines.Items) > 0 {
 			log.V(1).Info("node already has a machine associated with it, only needs an annotation")
-			return r.setMachineAnnotation(ctx, &m, n.Name)
+			return r.setMachineAnnotation(ctx, n, &machines.Items[0])
 		}
 	}
+
 	m := &machinev1.Machine{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      n.Name,
-			Namespace: metav1.NamespaceSystem,
-		},
-		Spec: machinev1.MachineSpec{
-			ProviderID: pointer.StringPtr(n.Spec.ProviderID),
+			Namespace: r.Namespace,
+			Labels: map[string]string{
+				machinev1.MachineAdoptedLabelName: "true",
+			},
 		},
 	}
+	if n.Spec.ProviderID != "" {
+		m.Spec.ProviderID = pointer.StringPtr(n.Spec.ProviderID)
+	}
+	if v, ok := n.Labels[machinev1.MachineControlPlaneLabelName]; ok {
+		m.Labels[machinev1.MachineControlPlaneLabelName] = v
+	}
 	if err := r.Create(ctx, m); err != nil {
 		if !apierrors.IsAlreadyExists(err) {
 			return err
 		}
+		if err := r.Get(ctx, client.ObjectKey{Name: m.Name, Namespace: m.Namespace}, m); err != nil {
+			return err
+		}
+		if _, ok := m.Labels[machinev1.MachineAdoptedLabelName]; !ok {
+			return errors.Errorf("cannot adopt node %q, machine %q already exists in namespace %q", n.Name, m.Name, m.Namespace)
+		}
+	}
+	log.Info("adopted node", "machine", m.Name, "namespace", m.Namespace)
+
+	// Nodes without a ProviderID cannot be linked by the Machine controller,
+	// so the adopted Machine is linked here.
+	if m.Status.NodeRef == nil {
+		m.Status.NodeRef = &corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Node",
+			Name:       n.Name,
+		}
+		if err := r.Status().Update(ctx, m); err != nil {
+			return err
+		}
 	}
-	return r.setMachineAnnotation(ctx, m, n.Name)
+	return r.setMachineAnnotation(ctx, n, m)
 }
 
-func (r *NodeReconciler) setMachineAnnotation(ctx context.Context, m *machinev1.Machine, name string) error {
-	ref := corev1.ObjectReference{
-		APIVersion: m.APIVersion,
+func (r *NodeReconciler) setMachineAnnotation(ctx context.Context, n *corev1.Node, m *machinev1.Machine) error {
+	data, err := json.Marshal(corev1.ObjectReference{
+		APIVersion: machinev1.GroupVersion.String(),
 		Kind:       "Machine",
-		Name:       m.ObjectMeta.Name,
+		Name:       m.Name,
 		Namespace:  m.Namespace,
-	}
-	data, err := json.Marshal(ref)
+	})
 	if err != nil {
 		return err
 	}
-	k, err := kubernetes.NewForConfig(r.config)
-	if err != nil {
+	patch := client.MergeFrom(n.DeepCopy())
+	if n.Annotations == nil {
+		n.Annotations = make(map[string]string)
+	}
+	n.Annotations[machinev1.NodeOwnerLabelName] = string(data)
+	return r.Patch(ctx, n, patch)
+}
+
+// deleteAdoptedMachines deletes the adopted Machines linked to a Node that
+// no longer exists. Machines provisioned by the machine-api are left alone.
+func (r *NodeReconciler) deleteAdoptedMachines(ctx context.Context, nodeName string) error {
+	machines := &machinev1.MachineList{}
+	if err := r.List(ctx, machines, client.InNamespace(r.Namespace), client.HasLabels{machinev1.MachineAdoptedLabelName}, client.MatchingFields{index.MachineNodeNameField: nodeName}); err != nil {
 		return err
 	}
-	return nodeutil.PatchNode(ctx, k, name, func(n *corev1.Node) {
-		annotations := n.GetAnnotations()
-		annotations[machinev1.NodeOwnerLabelName] = string(data)
-	})
+	for i := range machines.Items {
+		m := &machines.Items[i]
+		if m.Status.NodeRef == nil || m.Status.NodeRef.Name != nodeName || !m.DeletionTimestamp.IsZero() {
+			continue
+		}
+		r.Log.Info("deleting adopted machine of removed node", "node", nodeName, "machine", m.Name, "namespace", m.Namespace)
+		if err := r.Delete(ctx, m); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,110 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+const (
+	testNamespace = "default"
+	timeout       = 10 * time.Second
+	interval      = 250 * time.Millisecond
+)
+
+var _ = Describe("NodeReconciler", func() {
+	ctx := context.Background()
+
+	nodeOwner := func(name string) func() string {
+		return func() string {
+			n := &corev1.Node{}
+			if err := k8sClient.Get(ctx, client.ObjectKey{Name: name}, n); err != nil {
+				return ""
+			}
+			ref := corev1.ObjectReference{}
+			_ = json.Unmarshal([]byte(n.Annotations[machinev1.NodeOwnerLabelName]), &ref)
+			return ref.Name
+		}
+	}
+
+	It("adopts unmanaged nodes", func() {
+		n := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "unmanaged",
+				Labels: map[string]string{machinev1.MachineControlPlaneLabelName: ""},
+			},
+			Spec: corev1.NodeSpec{ProviderID: "aws:///us-east-1a/i-unmanaged"},
+		}
+		Expect(k8sClient.Create(ctx, n)).To(Succeed())
+
+		m := &machinev1.Machine{}
+		key := client.ObjectKey{Name: n.Name, Namespace: testNamespace}
+		Eventually(func() *corev1.ObjectReference {
+			if err := k8sClient.Get(ctx, key, m); err != nil {
+				return nil
+			}
+			return m.Status.NodeRef
+		}, timeout, interval).ShouldNot(BeNil())
+		Expect(m.Status.NodeRef.Name).To(Equal(n.Name))
+		Expect(m.Labels).To(HaveKeyWithValue(machinev1.MachineAdoptedLabelName, "true"))
+		Expect(m.Labels).To(HaveKey(machinev1.MachineControlPlaneLabelName))
+		Expect(m.Spec.ProviderID).To(Equal(pointer.StringPtr(n.Spec.ProviderID)))
+		Eventually(nodeOwner(n.Name), timeout, interval).Should(Equal(m.Name))
+
+		By("deleting the adopted machine when the node goes away")
+		Expect(k8sClient.Delete(ctx, n)).To(Succeed())
+		Eventually(func() bool {
+			return apierrors.IsNotFound(k8sClient.Get(ctx, key, &machinev1.Machine{}))
+		}, timeout, interval).Should(BeTrue())
+	})
+
+	It("links nodes to machines by provider id", func() {
+		m := &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "managed-machine", Namespace: testNamespace},
+			Spec:       machinev1.MachineSpec{ProviderID: pointer.StringPtr("aws:///us-east-1a/i-managed")},
+		}
+		Expect(k8sClient.Create(ctx, m)).To(Succeed())
+		n := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "managed"},
+			Spec:       corev1.NodeSpec{ProviderID: "aws:///us-east-1a/i-managed"},
+		}
+		Expect(k8sClient.Create(ctx, n)).To(Succeed())
+
+		Eventually(nodeOwner(n.Name), timeout, interval).Should(Equal(m.Name))
+		Consistently(func() bool {
+			return apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKey{Name: n.Name, Namespace: testNamespace}, &machinev1.Machine{}))
+		}, time.Second, interval).Should(BeTrue())
+
+		By("leaving machines that were not adopted when the node goes away")
+		Expect(k8sClient.Delete(ctx, n)).To(Succeed())
+		Consistently(func() error {
+			return k8sClient.Get(ctx, client.ObjectKey{Name: m.Name, Namespace: testNamespace}, &machinev1.Machine{})
+		}, time.Second, interval).Should(Succeed())
+	})
+})
@@ -0,0 +1,214 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orphan
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+// InfrastructureGroup is the API group of infrastructure objects.
+const InfrastructureGroup = "infrastructure.crit.sh"
+
+// object is a Kubernetes object with metadata.
+type object interface {
+	runtime.Object
+	metav1.Object
+}
+
+// orphan is an object found without the owner or reference it should have.
+type orphan struct {
+	Kind   string
+	Object object
+	Reason string
+}
+
+// inventory holds the objects cross-referenced by the scanner.
+type inventory struct {
+	Nodes     []corev1.Node
+	Machines  []machinev1.Machine
+	Configs   []machinev1.Config
+	Providers []machinev1.InfrastructureProvider
+	Classes   []machinev1.MachineClass
+	// Secrets are the Secrets owned by Configs.
+	Secrets []corev1.Secret
+	// Infrastructure are the objects of the infrastructure API group.
+	Infrastructure []unstructured.Unstructured
+}
+
+// objectKey identifies an object of any kind.
+type objectKey struct {
+	GroupKind schema.GroupKind
+	Namespace string
+	Name      string
+}
+
+func refKey(ref *corev1.ObjectReference, namespace string) objectKey {
+	if ref.Namespace != "" {
+		namespace = ref.Namespace
+	}
+	return objectKey{
+		GroupKind: ref.GroupVersionKind().GroupKind(),
+		Namespace: namespace,
+		Name:      ref.Name,
+	}
+}
+
+// findOrphans returns:
+//
+//	Nodes that no Machine is linked to
+//	Machines whose infrastructure object no longer exists, once it existed
+//	Configs that no Machine references
+//	Config data Secrets that their Config no longer uses
+//	infrastructure objects that no Machine, MachineClass or
+//	InfrastructureProvider references and that are not controlled by
+//	another object
+//
+// Objects that are being deleted are skipped.
+func findOrphans(inv *inventory) []orphan {
+	orphans := make([]orphan, 0)
+
+	nodes := make(map[string]bool)
+	configs := make(map[objectKey]bool)
+	infra := make(map[objectKey]bool)
+	for _, m := range inv.Machines {
+		if m.Status.NodeRef != nil {
+			nodes[m.Status.NodeRef.Name] = true
+		}
+		if m.Spec.ConfigRef.Name != "" {
+			ref := m.Spec.ConfigRef
+			ref.APIVersion, ref.Kind = machinev1.GroupVersion.String(), "Config"
+			configs[refKey(&ref, m.Namespace)] = true
+		}
+		if m.Spec.InfrastructureRef != nil {
+			infra[refKey(m.Spec.InfrastructureRef, m.Namespace)] = true
+		}
+		if m.Spec.InfrastructureTemplateRef != nil {
+			infra[refKey(m.Spec.InfrastructureTemplateRef, m.Namespace)] = true
+		}
+	}
+	for _, mc := range inv.Classes {
+		if mc.Spec.ConfigRef != nil {
+			ref := *mc.Spec.ConfigRef
+			ref.APIVersion, ref.Kind = machinev1.GroupVersion.String(), "Config"
+			configs[refKey(&ref, mc.Namespace)] = true
+		}
+		if mc.Spec.InfrastructureTemplateRef != nil {
+			infra[refKey(mc.Spec.InfrastructureTemplateRef, mc.Namespace)] = true
+		}
+	}
+	for _, ip := range inv.Providers {
+		infra[refKey(&ip.Spec.InfrastructureRef, ip.Spec.InfrastructureRef.Namespace)] = true
+	}
+
+	existingInfra := make(map[objectKey]bool)
+	for _, obj := range inv.Infrastructure {
+		existingInfra[objectKey{
+			GroupKind: obj.GroupVersionKind().GroupKind(),
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+		}] = true
+	}
+	dataSecrets := make(map[objectKey]string)
+	for _, cfg := range inv.Configs {
+		key := objectKey{Namespace: cfg.Namespace, Name: cfg.Name}
+		dataSecrets[key] = ""
+		if cfg.Status.DataSecretName != nil {
+			dataSecrets[key] = *cfg.Status.DataSecretName
+		}
+	}
+
+	for i := range inv.Nodes {
+		n := &inv.Nodes[i]
+		if isDeleting(n) || nodes[n.Name] {
+			continue
+		}
+		orphans = append(orphans, orphan{Kind: "Node", Object: n, Reason: "no Machine is linked to the Node"})
+	}
+	for i := range inv.Machines {
+		m := &inv.Machines[i]
+		if isDeleting(m) || m.Spec.InfrastructureRef == nil || !infrastructureExisted(m) {
+			continue
+		}
+		key := refKey(m.Spec.InfrastructureRef, m.Namespace)
+		if key.GroupKind.Group != InfrastructureGroup || existingInfra[key] {
+			continue
+		}
+		orphans = append(orphans, orphan{Kind: "Machine", Object: m, Reason: fmt.Sprintf("%s %q no longer exists", key.GroupKind.Kind, key.Name)})
+	}
+	for i := range inv.Configs {
+		cfg := &inv.Configs[i]
+		key := objectKey{GroupKind: machinev1.GroupVersion.WithKind("Config").GroupKind(), Namespace: cfg.Namespace, Name: cfg.Name}
+		if isDeleting(cfg) || configs[key] {
+			continue
+		}
+		orphans = append(orphans, orphan{Kind: "Config", Object: cfg, Reason: "no Machine or MachineClass references the Config"})
+	}
+	for i := range inv.Secrets {
+		s := &inv.Secrets[i]
+		if isDeleting(s) {
+			continue
+		}
+		for _, owner := range s.OwnerReferences {
+			if owner.Kind != "Config" || owner.APIVersion != machinev1.GroupVersion.String() {
+				continue
+			}
+			name, ok := dataSecrets[objectKey{Namespace: s.Namespace, Name: owner.Name}]
+			switch {
+			case !ok:
+				orphans = append(orphans, orphan{Kind: "Secret", Object: s, Reason: fmt.Sprintf("Config %q no longer exists", owner.Name)})
+			case name != s.Name:
+				orphans = append(orphans, orphan{Kind: "Secret", Object: s, Reason: fmt.Sprintf("Config %q does not use the Secret", owner.Name)})
+			}
+			break
+		}
+	}
+	for i := range inv.Infrastructure {
+		obj := &inv.Infrastructure[i]
+		key := objectKey{GroupKind: obj.GroupVersionKind().GroupKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}
+		if isDeleting(obj) || infra[key] || metav1.GetControllerOf(obj) != nil {
+			continue
+		}
+		orphans = append(orphans, orphan{Kind: obj.GetKind(), Object: obj, Reason: "no Machine, MachineClass or InfrastructureProvider references the object"})
+	}
+	return orphans
+}
+
+// infrastructureExisted returns whether the infrastructure object of the
+// Machine has existed. Pending Machines wait for their infrastructure object
+// to be created, so it missing does not make them orphans.
+func infrastructureExisted(m *machinev1.Machine) bool {
+	if m.Status.InfrastructureReady || m.Status.NodeRef != nil {
+		return true
+	}
+	switch m.Status.Phase {
+	case machinev1.MachineProvisioning, machinev1.MachineProvisioned, machinev1.MachineRunning, machinev1.MachineUnknown:
+		return true
+	}
+	return false
+}
+
+func isDeleting(obj metav1.Object) bool {
+	return !obj.GetDeletionTimestamp().IsZero()
+}
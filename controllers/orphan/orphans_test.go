@@ -0,0 +1,121 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orphan
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/pointer"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+func newInfra(name string) unstructured.Unstructured {
+	obj := unstructured.Unstructured{}
+	obj.SetAPIVersion(InfrastructureGroup + "/v1alpha1")
+	obj.SetKind("DockerMachine")
+	obj.SetName(name)
+	obj.SetNamespace("default")
+	return obj
+}
+
+func TestFindOrphans(t *testing.T) {
+	g := NewWithT(t)
+
+	configOwner := []metav1.OwnerReference{{APIVersion: machinev1.GroupVersion.String(), Kind: "Config", Name: "worker"}}
+	infraRef := func(name string) *corev1.ObjectReference {
+		return &corev1.ObjectReference{APIVersion: InfrastructureGroup + "/v1alpha1", Kind: "DockerMachine", Name: name}
+	}
+	now := metav1.Now()
+
+	inv := &inventory{
+		Nodes: []corev1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "linked"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "unlinked"}},
+		},
+		Machines: []machinev1.Machine{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "default"},
+				Spec: machinev1.MachineSpec{
+					ConfigRef:         corev1.ObjectReference{Name: "worker"},
+					InfrastructureRef: infraRef("worker"),
+				},
+				Status: machinev1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "linked"}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "vanished", Namespace: "default"},
+				Spec:       machinev1.MachineSpec{InfrastructureRef: infraRef("vanished")},
+				Status:     machinev1.MachineStatus{Phase: machinev1.MachineProvisioning},
+			},
+			{
+				// Pending Machines wait for their infrastructure object
+				// to be created.
+				ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "default"},
+				Spec:       machinev1.MachineSpec{InfrastructureRef: infraRef("pending")},
+				Status:     machinev1.MachineStatus{Phase: machinev1.MachinePending},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "deleting", Namespace: "default", DeletionTimestamp: &now},
+				Spec:       machinev1.MachineSpec{InfrastructureRef: infraRef("deleting")},
+			},
+		},
+		Configs: []machinev1.Config{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "default"},
+				Status:     machinev1.ConfigStatus{DataSecretName: pointer.StringPtr("worker-current")},
+			},
+			{ObjectMeta: metav1.ObjectMeta{Name: "unused", Namespace: "default"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "class", Namespace: "default"}},
+		},
+		Classes: []machinev1.MachineClass{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "default"},
+				Spec: machinev1.MachineClassSpec{
+					ConfigRef:                 &corev1.ObjectReference{Name: "class"},
+					InfrastructureTemplateRef: infraRef("template"),
+				},
+			},
+		},
+		Providers: []machinev1.InfrastructureProvider{
+			{Spec: machinev1.InfrastructureProviderSpec{InfrastructureRef: corev1.ObjectReference{
+				APIVersion: InfrastructureGroup + "/v1alpha1", Kind: "DockerMachine", Name: "provider", Namespace: "default",
+			}}},
+		},
+		Secrets: []corev1.Secret{
+			{ObjectMeta: metav1.ObjectMeta{Name: "worker-current", Namespace: "default", OwnerReferences: configOwner}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "worker-leaked", Namespace: "default", OwnerReferences: configOwner}},
+		},
+		Infrastructure: []unstructured.Unstructured{newInfra("worker"), newInfra("provider"), newInfra("template"), newInfra("unreferenced")},
+	}
+
+	found := make(map[string]string)
+	for _, o := range findOrphans(inv) {
+		found[o.Kind+"/"+o.Object.GetName()] = o.Reason
+	}
+	g.Expect(found).To(HaveLen(5))
+	g.Expect(found).To(HaveKey("Node/unlinked"))
+	g.Expect(found).To(HaveKeyWithValue("Machine/vanished", `DockerMachine "vanished" no longer exists`))
+	g.Expect(found).To(HaveKey("Config/unused"))
+	g.Expect(found).To(HaveKeyWithValue("Secret/worker-leaked", `Config "worker" does not use the Secret`))
+	g.Expect(found).To(HaveKey("DockerMachine/unreferenced"))
+	g.Expect(found).NotTo(HaveKey("Machine/pending"))
+}
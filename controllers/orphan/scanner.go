@@ -0,0 +1,257 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orphan
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+var orphansGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "machine_api_orphans",
+		Help: "Number of orphaned objects found by the last orphan scan, by kind.",
+	},
+	[]string{"kind"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(orphansGauge)
+}
+
+// Scanner periodically cross-references Nodes, Machines, Configs, Config data
+// Secrets and infrastructure objects to find orphans. Orphans are reported as
+// events and through the machine_api_orphans gauge, and are optionally
+// garbage collected. Nodes are never garbage collected, as they may have been
+// created outside of the machine-api.
+type Scanner struct {
+	client.Client
+	Log logr.Logger
+
+	// Interval is the time between scans.
+	Interval time.Duration
+
+	// GarbageCollect enables deleting orphans that have been found orphaned
+	// for at least GracePeriod.
+	GarbageCollect bool
+	GracePeriod    time.Duration
+
+	// Namespaces restricts the scan to these namespaces. Nodes are not
+	// scanned then, as they may be linked to Machines of other namespaces.
+	Namespaces []string
+
+	discovery discovery.DiscoveryInterface
+	recorder  record.EventRecorder
+
+	// firstSeen holds when each current orphan was first found orphaned, as
+	// an object may be orphaned long after it was created.
+	firstSeen map[types.UID]time.Time
+}
+
+func (s *Scanner) SetupWithManager(mgr ctrl.Manager) error {
+	dc, err := discovery.NewDiscoveryClientForConfig(mgr.GetConfig())
+	if err != nil {
+		return errors.Wrap(err, "failed to create discovery client")
+	}
+	s.discovery = dc
+	s.recorder = mgr.GetEventRecorderFor("orphan-scanner")
+	return mgr.Add(s)
+}
+
+// +kubebuilder:rbac:groups=machine.crit.sh,resources=machines;configs;infrastructureproviders,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=machine.crit.sh,resources=machineclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;delete
+// +kubebuilder:rbac:groups=infrastructure.crit.sh,resources=*,verbs=get;list;watch;delete
+
+// Start runs the scanner until the stop channel is closed.
+func (s *Scanner) Start(stop <-chan struct{}) error {
+	wait.Until(func() {
+		if err := s.scan(context.Background()); err != nil {
+			s.Log.Error(err, "orphan scan failed")
+		}
+	}, s.Interval, stop)
+	return nil
+}
+
+func (s *Scanner) scan(ctx context.Context) error {
+	inv, err := s.inventory(ctx)
+	if err != nil {
+		return err
+	}
+	orphans := findOrphans(inv)
+
+	counts := make(map[string]float64)
+	for _, kind := range []string{"Node", "Machine", "Config", "Secret"} {
+		counts[kind] = 0
+	}
+	now := time.Now()
+	seen := make(map[types.UID]time.Time, len(orphans))
+	defer func() { s.firstSeen = seen }()
+	for _, o := range orphans {
+		counts[o.Kind]++
+		uid := o.Object.GetUID()
+		firstSeen, ok := s.firstSeen[uid]
+		if !ok {
+			firstSeen = now
+		}
+		seen[uid] = firstSeen
+		log := s.Log.WithValues("kind", o.Kind, "name", o.Object.GetName(), "namespace", o.Object.GetNamespace())
+		log.Info("Found orphan", "reason", o.Reason)
+		s.recorder.Eventf(o.Object, corev1.EventTypeWarning, "Orphaned", "%s %q is orphaned: %s", o.Kind, o.Object.GetName(), o.Reason)
+
+		if !s.GarbageCollect || o.Kind == "Node" || now.Sub(firstSeen) < s.GracePeriod {
+			continue
+		}
+		if err := s.Delete(ctx, o.Object, client.Preconditions{UID: &uid}); err != nil && !apierrors.IsNotFound(err) {
+			log.Error(err, "failed to delete orphan")
+			continue
+		}
+		log.Info("Deleted orphan")
+		s.recorder.Eventf(o.Object, corev1.EventTypeNormal, "DeletedOrphan", "deleted orphaned %s %q", o.Kind, o.Object.GetName())
+	}
+	orphansGauge.Reset()
+	for kind, n := range counts {
+		orphansGauge.WithLabelValues(kind).Set(n)
+	}
+	return nil
+}
+
+func (s *Scanner) inventory(ctx context.Context) (*inventory, error) {
+	inv := &inventory{}
+
+	if len(s.Namespaces) == 0 {
+		nodes := &corev1.NodeList{}
+		if err := s.List(ctx, nodes); err != nil {
+			return nil, err
+		}
+		inv.Nodes = nodes.Items
+	}
+	machines := &machinev1.MachineList{}
+	if err := s.List(ctx, machines); err != nil {
+		return nil, err
+	}
+	inv.Machines = machines.Items
+	configs := &machinev1.ConfigList{}
+	if err := s.List(ctx, configs); err != nil {
+		return nil, err
+	}
+	inv.Configs = configs.Items
+	providers := &machinev1.InfrastructureProviderList{}
+	if err := s.List(ctx, providers); err != nil {
+		return nil, err
+	}
+	inv.Providers = providers.Items
+	classes := &machinev1.MachineClassList{}
+	if err := s.List(ctx, classes); err != nil {
+		return nil, err
+	}
+	inv.Classes = classes.Items
+
+	secrets := &corev1.SecretList{}
+	if err := s.List(ctx, secrets); err != nil {
+		return nil, err
+	}
+	for _, secret := range secrets.Items {
+		for _, owner := range secret.OwnerReferences {
+			if owner.Kind == "Config" && owner.APIVersion == machinev1.GroupVersion.String() {
+				inv.Secrets = append(inv.Secrets, secret)
+				break
+			}
+		}
+	}
+
+	kinds, err := s.infrastructureKinds()
+	if err != nil {
+		return nil, err
+	}
+	// Unstructured objects are not cached, so they are listed in each
+	// namespace rather than across the cluster.
+	namespaces := s.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	for _, gvk := range kinds {
+		for _, ns := range namespaces {
+			list := &unstructured.UnstructuredList{}
+			list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+			if err := s.List(ctx, list, client.InNamespace(ns)); err != nil {
+				return nil, errors.Wrapf(err, "failed to list %v", gvk)
+			}
+			inv.Infrastructure = append(inv.Infrastructure, list.Items...)
+		}
+	}
+	return inv, nil
+}
+
+// infrastructureKinds discovers the listable kinds of the infrastructure API
+// group, in its preferred version.
+func (s *Scanner) infrastructureKinds() ([]schema.GroupVersionKind, error) {
+	groups, err := s.discovery.ServerGroups()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to discover API groups")
+	}
+	kinds := make([]schema.GroupVersionKind, 0)
+	for _, g := range groups.Groups {
+		if g.Name != InfrastructureGroup {
+			continue
+		}
+		resources, err := s.discovery.ServerResourcesForGroupVersion(g.PreferredVersion.GroupVersion)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to discover %s resources", g.PreferredVersion.GroupVersion)
+		}
+		gv, err := schema.ParseGroupVersion(resources.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range resources.APIResources {
+			if strings.Contains(r.Name, "/") || !hasVerb(r, "list") {
+				continue
+			}
+			kinds = append(kinds, gv.WithKind(r.Kind))
+		}
+	}
+	return kinds, nil
+}
+
+func hasVerb(r metav1.APIResource, verb string) bool {
+	for _, v := range r.Verbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
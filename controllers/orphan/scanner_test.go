@@ -0,0 +1,120 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orphan
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+func TestInventoryNamespaces(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = machinev1.AddToScheme(scheme)
+	gv := schema.GroupVersion{Group: InfrastructureGroup, Version: "v1alpha1"}
+	scheme.AddKnownTypeWithName(gv.WithKind("DockerMachine"), &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(gv.WithKind("DockerMachineList"), &unstructured.UnstructuredList{})
+	watched := newInfra("watched")
+	other := newInfra("other")
+	other.SetNamespace("other")
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}}
+	discovery := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{
+		Resources: []*metav1.APIResourceList{{
+			GroupVersion: gv.String(),
+			APIResources: []metav1.APIResource{
+				{Name: "dockermachines", Kind: "DockerMachine", Namespaced: true, Verbs: metav1.Verbs{"list"}},
+			},
+		}},
+	}}
+	s := &Scanner{
+		Client:    fake.NewFakeClientWithScheme(scheme, &watched, &other, node),
+		Log:       log.NullLogger{},
+		discovery: discovery,
+	}
+
+	inv, err := s.inventory(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(inv.Nodes).To(HaveLen(1))
+	g.Expect(inv.Infrastructure).To(HaveLen(2))
+
+	s.Namespaces = []string{"default"}
+	inv, err = s.inventory(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(inv.Nodes).To(BeEmpty())
+	g.Expect(inv.Infrastructure).To(HaveLen(1))
+	g.Expect(inv.Infrastructure[0].GetName()).To(Equal("watched"))
+}
+
+func TestScanGracePeriod(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = machinev1.AddToScheme(scheme)
+	m := &machinev1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "vanished",
+			Namespace:         "default",
+			UID:               types.UID("vanished"),
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-24 * time.Hour)),
+		},
+		Spec: machinev1.MachineSpec{
+			InfrastructureRef: &corev1.ObjectReference{APIVersion: InfrastructureGroup + "/v1alpha1", Kind: "DockerMachine", Name: "vanished"},
+		},
+		Status: machinev1.MachineStatus{InfrastructureReady: true},
+	}
+	s := &Scanner{
+		Client:         fake.NewFakeClientWithScheme(scheme, m),
+		Log:            log.NullLogger{},
+		GarbageCollect: true,
+		GracePeriod:    time.Hour,
+		discovery:      &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{}},
+		recorder:       record.NewFakeRecorder(10),
+	}
+	ctx := context.Background()
+	key := client.ObjectKey{Namespace: m.Namespace, Name: m.Name}
+
+	// An old Machine is not deleted when it is first found orphaned.
+	g.Expect(s.scan(ctx)).To(Succeed())
+	g.Expect(s.Get(ctx, key, &machinev1.Machine{})).To(Succeed())
+	g.Expect(s.firstSeen).To(HaveKey(m.UID))
+
+	s.firstSeen[m.UID] = time.Now().Add(-time.Hour)
+	g.Expect(s.scan(ctx)).To(Succeed())
+	g.Expect(s.Get(ctx, key, &machinev1.Machine{})).NotTo(Succeed())
+}
@@ -102,4 +102,25 @@ const (
 	// not result in a Node joining the cluster within a given timeout
 	// and that are managed by a MachineSet
 	JoinClusterTimeoutMachineError = "JoinClusterTimeoutError"
+
+	// This error indicates that the Config referenced by the Machine cannot
+	// be validated or rendered into bootstrap data, or that its
+	// infrastructure reference cannot be used. It is not terminal for the
+	// Machine, as it goes away once the Config or the reference is fixed.
+	//
+	// Example: the Config does not contain a crit configuration, or the
+	// infrastructure reference points at a namespace that is not allowed.
+	InvalidConfigMachineError MachineStatusError = "InvalidConfig"
 )
+
+// IsTerminal returns true if the MachineStatusError indicates a problem that
+// will not go away without manual intervention, so it should not be cleared
+// automatically when its source stops reporting it.
+func (e MachineStatusError) IsTerminal() bool {
+	switch e {
+	case InvalidConfigurationMachineError, UnsupportedChangeMachineError:
+		return true
+	default:
+		return false
+	}
+}
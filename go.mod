@@ -10,7 +10,9 @@ require (
 	github.com/onsi/ginkgo v1.12.1
 	github.com/onsi/gomega v1.10.1
 	github.com/pkg/errors v0.9.1
-	github.com/prometheus/client_golang v1.5.0 // indirect
+	github.com/prometheus/client_golang v1.5.0
+	github.com/prometheus/client_model v0.2.0
+	go.uber.org/zap v1.15.0
 	google.golang.org/appengine v1.6.1 // indirect
 	k8s.io/api v0.18.5
 	k8s.io/apimachinery v0.18.5
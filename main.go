@@ -17,22 +17,36 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
-	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 
+	configv1alpha1 "github.com/criticalstack/machine-api/api/config/v1alpha1"
 	machinev1alpha1 "github.com/criticalstack/machine-api/api/v1alpha1"
+	adoptioncontroller "github.com/criticalstack/machine-api/controllers/adoption"
 	configcontroller "github.com/criticalstack/machine-api/controllers/config"
 	csrapprovercontroller "github.com/criticalstack/machine-api/controllers/csrapprover"
 	infraprovidercontroller "github.com/criticalstack/machine-api/controllers/infraprovider"
 	machinecontroller "github.com/criticalstack/machine-api/controllers/machine"
+	nodecontroller "github.com/criticalstack/machine-api/controllers/node"
+	orphancontroller "github.com/criticalstack/machine-api/controllers/orphan"
+	"github.com/criticalstack/machine-api/util/health"
+	"github.com/criticalstack/machine-api/util/index"
+	"github.com/criticalstack/machine-api/util/namespacecache"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -49,90 +63,209 @@ func init() {
 }
 
 func main() {
-	var metricsAddr string
-	var enableLeaderElection bool
-	var configConcurrency int
-	var machineConcurrency int
-	var nodeConcurrency int
-	var csrApproverConcurreny int
-	var infraProviderConcurrency int
-	var externalReadyWait time.Duration
-	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
-	flag.IntVar(&configConcurrency, "config-concurrency", 10,
-		"Number of configs to process simultaneously")
-	flag.IntVar(&machineConcurrency, "machine-concurrency", 10,
-		"Number of machines to process simultaneously")
-	flag.IntVar(&nodeConcurrency, "node-concurrency", 10,
-		"Number of nodes to process simultaneously")
-	flag.IntVar(&csrApproverConcurreny, "csrapprover-concurrency", 10,
-		"Number of csrs to process simultaneously")
-	flag.IntVar(&infraProviderConcurrency, "infraprovider-concurrency", 10,
-		"Number of infraproviders to process simultaneously")
-	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
-		"Enable leader election for controller manager. "+
-			"Enabling this will ensure there is only one active controller manager.")
-	flag.DurationVar(&externalReadyWait, "external-ready-wait", 30*time.Second,
-		"Amount of time to wait between polls for external resources to be ready")
+	var configFile string
+	cfg := &configv1alpha1.MachineAPIManagerConfiguration{}
+	configv1alpha1.SetDefaults_MachineAPIManagerConfiguration(cfg)
+	flag.StringVar(&configFile, "config", "",
+		"The MachineAPIManagerConfiguration file to load, flags set on the command line override its values")
+	bindFlags(flag.CommandLine, cfg)
 	flag.Parse()
 
-	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	// The logger depends on the configuration, errors loading it are
+	// printed as they are.
+	if configFile != "" {
+		var err error
+		if cfg, err = loadConfig(configFile, flag.CommandLine); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to load config file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	logger, err := newLogger(cfg.Logging)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid logging configuration: %v\n", err)
+		os.Exit(1)
+	}
+	ctrl.SetLogger(logger)
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
-		Port:               9443,
-		LeaderElection:     enableLeaderElection,
-		LeaderElectionID:   "78c2e11e.crit.sh",
-	})
+	c := cfg.Controllers
+	var etcdSecretKey types.NamespacedName
+	if c.Machine.EtcdClientSecret != "" {
+		parts := strings.SplitN(c.Machine.EtcdClientSecret, "/", 2)
+		if len(parts) != 2 {
+			setupLog.Error(nil, "invalid etcd client secret, expected namespace/name", "value", c.Machine.EtcdClientSecret)
+			os.Exit(1)
+		}
+		etcdSecretKey = types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+	}
+
+	options := ctrl.Options{
+		Scheme:                  scheme,
+		MetricsBindAddress:      cfg.MetricsBindAddress,
+		HealthProbeBindAddress:  cfg.HealthProbeBindAddress,
+		Port:                    cfg.Webhook.Port,
+		LeaderElection:          cfg.LeaderElection.Enabled,
+		LeaderElectionID:        cfg.LeaderElection.ID,
+		LeaderElectionNamespace: cfg.LeaderElection.Namespace,
+		LeaseDuration:           durationPtr(cfg.LeaderElection.LeaseDuration),
+		RenewDeadline:           durationPtr(cfg.LeaderElection.RenewDeadline),
+		RetryPeriod:             durationPtr(cfg.LeaderElection.RetryPeriod),
+	}
+	if len(cfg.WatchNamespaces) > 0 {
+		if err := validateWatchNamespaces(cfg); err != nil {
+			setupLog.Error(err, "invalid watch namespaces")
+			os.Exit(1)
+		}
+		setupLog.Info("restricting manager to namespaces", "namespaces", cfg.WatchNamespaces)
+		options.NewCache = namespacecache.New(cfg.WatchNamespaces)
+	}
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	if err = (&configcontroller.ConfigReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Config"),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: configConcurrency}); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Config")
+	if err = index.AddDefaultIndexes(context.Background(), mgr); err != nil {
+		setupLog.Error(err, "unable to add field indexes")
 		os.Exit(1)
 	}
-	if err = (&machinecontroller.MachineReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Machine"),
-	}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: machineConcurrency}, externalReadyWait); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Machine")
-		os.Exit(1)
+	if c.Config.IsEnabled() {
+		if err = (&configcontroller.ConfigReconciler{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("controllers").WithName("Config"),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: c.Config.Concurrency}); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Config")
+			os.Exit(1)
+		}
 	}
-	// if err = (&nodecontroller.NodeReconciler{
-	// 	Client: mgr.GetClient(),
-	// 	Log:    ctrl.Log.WithName("controllers").WithName("Node"),
-	// 	Scheme: mgr.GetScheme(),
-	// }).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: nodeConcurrency}); err != nil {
-	// 	setupLog.Error(err, "unable to create controller", "controller", "Node")
-	// 	os.Exit(1)
-	// }
-	if err = (&csrapprovercontroller.CSRApproverReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("CSRApprover"),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: nodeConcurrency}); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "CSRApprover")
-		os.Exit(1)
+	if c.Machine.IsEnabled() {
+		if err = (&machinecontroller.MachineReconciler{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("controllers").WithName("Machine"),
+
+			InfrastructureDeleteTimeout: c.Machine.InfrastructureDeleteTimeout.Duration,
+			EtcdClientSecret:            etcdSecretKey,
+			EtcdEndpoints:               c.Machine.EtcdEndpoints,
+			MinControlPlaneMachines:     c.Machine.MinControlPlaneMachines,
+
+			AllowedInfrastructureNamespaces: c.Machine.AllowedInfrastructureNamespaces,
+			CertificateExpiryThreshold:      c.Machine.CertificateExpiryThreshold.Duration,
+			DrainTimeout:                    c.Machine.Drain.Timeout.Duration,
+			NodeDrainTimeout:                c.Machine.Drain.NodeDrainTimeout.Duration,
+
+			DeleteHookRequeue:             c.Machine.Requeue.DeleteHooks.Duration,
+			ControlPlaneDeletionRequeue:   c.Machine.Requeue.ControlPlaneDeletion.Duration,
+			EtcdMemberRemovalRequeue:      c.Machine.Requeue.EtcdMemberRemoval.Duration,
+			InfrastructureDeletionRequeue: c.Machine.Requeue.InfrastructureDeletion.Duration,
+		}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: c.Machine.Concurrency}, c.ExternalReadyWait.Duration); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Machine")
+			os.Exit(1)
+		}
 	}
-	if err = (&infraprovidercontroller.InfrastructureProviderReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("InfrastructureProvider"),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: infraProviderConcurrency}, externalReadyWait); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "InfrastructureProvider")
-		os.Exit(1)
+	if c.Node.IsEnabled() {
+		if err = (&nodecontroller.NodeReconciler{
+			Client:        mgr.GetClient(),
+			Log:           ctrl.Log.WithName("controllers").WithName("Node"),
+			Scheme:        mgr.GetScheme(),
+			Namespace:     c.Node.Namespace,
+			AdoptionDelay: c.Node.AdoptionDelay.Duration,
+		}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: c.Node.Concurrency}); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Node")
+			os.Exit(1)
+		}
+	}
+	if c.CSRApprover.IsEnabled() {
+		if err = (&csrapprovercontroller.CSRApproverReconciler{
+			Client:      mgr.GetClient(),
+			Log:         ctrl.Log.WithName("controllers").WithName("CSRApprover"),
+			Scheme:      mgr.GetScheme(),
+			DenyInvalid: c.CSRApprover.DenyInvalid,
+
+			IgnoreUnknownMachines: len(cfg.WatchNamespaces) > 0,
+		}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: c.CSRApprover.Concurrency}); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CSRApprover")
+			os.Exit(1)
+		}
+	}
+	if c.InfrastructureProvider.IsEnabled() {
+		if err = (&infraprovidercontroller.InfrastructureProviderReconciler{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("controllers").WithName("InfrastructureProvider"),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: c.InfrastructureProvider.Concurrency}, c.ExternalReadyWait.Duration); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "InfrastructureProvider")
+			os.Exit(1)
+		}
+	}
+	for _, kind := range c.Adoption.InfrastructureKinds {
+		gvk, _ := schema.ParseKindArg(kind)
+		if gvk == nil {
+			setupLog.Error(nil, "invalid infrastructure kind to adopt, expected Kind.version.group", "value", kind)
+			os.Exit(1)
+		}
+		if err = (&adoptioncontroller.InfrastructureAdoptionReconciler{
+			Client:           mgr.GetClient(),
+			Log:              ctrl.Log.WithName("controllers").WithName("Adoption").WithName(gvk.Kind),
+			GroupVersionKind: *gvk,
+		}).SetupWithManager(mgr, controller.Options{MaxConcurrentReconciles: c.Adoption.Concurrency}); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Adoption", "kind", gvk.Kind)
+			os.Exit(1)
+		}
+	}
+	if c.Orphan.ScanInterval.Duration > 0 {
+		if err = (&orphancontroller.Scanner{
+			Client:         mgr.GetClient(),
+			Log:            ctrl.Log.WithName("controllers").WithName("Orphan"),
+			Interval:       c.Orphan.ScanInterval.Duration,
+			GarbageCollect: c.Orphan.GarbageCollect,
+			GracePeriod:    c.Orphan.GracePeriod.Duration,
+			Namespaces:     cfg.WatchNamespaces,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Orphan")
+			os.Exit(1)
+		}
 	}
 	// +kubebuilder:scaffold:builder
 
+	if err := addHealthChecks(mgr, cfg.Webhook); err != nil {
+		setupLog.Error(err, "unable to set up health checks")
+		os.Exit(1)
+	}
+
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// durationPtr returns the duration of d, or nil if d is not set.
+func durationPtr(d *metav1.Duration) *time.Duration {
+	if d == nil {
+		return nil
+	}
+	return &d.Duration
+}
+
+// addHealthChecks adds the liveness and readiness checks of the manager.
+// The manager is ready once the informers of the Machines, Nodes and Configs
+// have synced, it is elected leader, and the webhook server is serving when
+// webhooks are enabled.
+func addHealthChecks(mgr ctrl.Manager, webhook configv1alpha1.WebhookConfiguration) error {
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("informers", health.InformersSynced(mgr.GetCache(), mgr.GetScheme(),
+		&machinev1alpha1.Machine{}, &corev1.Node{}, &machinev1alpha1.Config{})); err != nil {
+		return err
+	}
+	if err := mgr.AddReadyzCheck("leader-election", health.Elected(mgr.Elected())); err != nil {
+		return err
+	}
+	if !webhook.Enabled {
+		return nil
+	}
+	// Getting the webhook server adds it to the manager.
+	server := mgr.GetWebhookServer()
+	return mgr.AddReadyzCheck("webhook", health.WebhookServing(server.Host, webhook.Port))
+}
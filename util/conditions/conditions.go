@@ -0,0 +1,116 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conditions
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+// Getter is implemented by resources that report conditions.
+type Getter interface {
+	GetConditions() machinev1.Conditions
+}
+
+// Setter is implemented by resources that can have their conditions set.
+type Setter interface {
+	Getter
+	SetConditions(machinev1.Conditions)
+}
+
+// Get returns the condition with the given type, or nil if it is not set.
+func Get(from Getter, t machinev1.ConditionType) *machinev1.Condition {
+	for _, c := range from.GetConditions() {
+		if c.Type == t {
+			return &c
+		}
+	}
+	return nil
+}
+
+// IsTrue returns true if the condition with the given type is True.
+func IsTrue(from Getter, t machinev1.ConditionType) bool {
+	if c := Get(from, t); c != nil {
+		return c.Status == corev1.ConditionTrue
+	}
+	return false
+}
+
+// Set sets the given condition, replacing any existing condition of the same
+// type. The LastTransitionTime is only updated when the status changes.
+func Set(to Setter, condition *machinev1.Condition) {
+	if to == nil || condition == nil {
+		return
+	}
+	conditions := to.GetConditions()
+	for i, c := range conditions {
+		if c.Type != condition.Type {
+			continue
+		}
+		if c.Status == condition.Status {
+			condition.LastTransitionTime = c.LastTransitionTime
+		} else {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		conditions[i] = *condition
+		to.SetConditions(conditions)
+		return
+	}
+	condition.LastTransitionTime = metav1.Now()
+	to.SetConditions(append(conditions, *condition))
+}
+
+// MarkTrue sets the condition with the given type to True.
+func MarkTrue(to Setter, t machinev1.ConditionType) {
+	Set(to, &machinev1.Condition{
+		Type:   t,
+		Status: corev1.ConditionTrue,
+	})
+}
+
+// MarkFalse sets the condition with the given type to False, with the given
+// reason and message.
+func MarkFalse(to Setter, t machinev1.ConditionType, reason string, messageFormat string, messageArgs ...interface{}) {
+	Set(to, &machinev1.Condition{
+		Type:    t,
+		Status:  corev1.ConditionFalse,
+		Reason:  reason,
+		Message: fmt.Sprintf(messageFormat, messageArgs...),
+	})
+}
+
+// Delete removes the condition with the given type.
+func Delete(to Setter, t machinev1.ConditionType) {
+	if to == nil {
+		return
+	}
+	conditions := to.GetConditions()
+	filtered := make(machinev1.Conditions, 0, len(conditions))
+	for _, c := range conditions {
+		if c.Type != t {
+			filtered = append(filtered, c)
+		}
+	}
+	if len(filtered) == 0 {
+		filtered = nil
+	}
+	to.SetConditions(filtered)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conditions
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+const testCondition machinev1.ConditionType = "Test"
+
+func TestSet(t *testing.T) {
+	g := NewWithT(t)
+
+	m := &machinev1.Machine{}
+	MarkFalse(m, testCondition, "Waiting", "waiting on %d hooks", 2)
+	c := Get(m, testCondition)
+	g.Expect(c).NotTo(BeNil())
+	g.Expect(c.Status).To(Equal(corev1.ConditionFalse))
+	g.Expect(c.Reason).To(Equal("Waiting"))
+	g.Expect(c.Message).To(Equal("waiting on 2 hooks"))
+	g.Expect(IsTrue(m, testCondition)).To(BeFalse())
+
+	// The transition time is kept while the status doesn't change.
+	past := metav1.NewTime(time.Now().Add(-time.Hour))
+	m.Status.Conditions[0].LastTransitionTime = past
+	MarkFalse(m, testCondition, "Waiting", "waiting on %d hooks", 1)
+	g.Expect(Get(m, testCondition).LastTransitionTime).To(Equal(past))
+	g.Expect(Get(m, testCondition).Message).To(Equal("waiting on 1 hooks"))
+
+	MarkTrue(m, testCondition)
+	g.Expect(m.Status.Conditions).To(HaveLen(1))
+	g.Expect(IsTrue(m, testCondition)).To(BeTrue())
+	g.Expect(Get(m, testCondition).LastTransitionTime).NotTo(Equal(past))
+}
+
+func TestDelete(t *testing.T) {
+	g := NewWithT(t)
+
+	m := &machinev1.Machine{}
+	MarkTrue(m, testCondition)
+	MarkTrue(m, "Other")
+	Delete(m, testCondition)
+	g.Expect(Get(m, testCondition)).To(BeNil())
+	g.Expect(m.Status.Conditions).To(HaveLen(1))
+	Delete(m, "Other")
+	g.Expect(m.Status.Conditions).To(BeNil())
+}
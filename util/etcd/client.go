@@ -0,0 +1,217 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package etcd provides a minimal etcd v3 cluster client. It talks to the
+// JSON gRPC gateway that etcd serves on its client port, which avoids pulling
+// the full etcd client (and its gRPC version requirements) into the
+// controller.
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+const (
+	// CACertKey is the Secret key holding the etcd CA certificate.
+	CACertKey = "ca.crt"
+
+	// ClientCertKey is the Secret key holding the etcd client certificate.
+	ClientCertKey = "tls.crt"
+
+	// ClientKeyKey is the Secret key holding the etcd client private key.
+	ClientKeyKey = "tls.key"
+
+	// DefaultClientPort is the port etcd serves clients on.
+	DefaultClientPort = 2379
+
+	defaultRequestTimeout = 10 * time.Second
+)
+
+// Member is an etcd cluster member as returned by the gateway.
+type Member struct {
+	ID         uint64   `json:"ID,string"`
+	Name       string   `json:"name,omitempty"`
+	PeerURLs   []string `json:"peerURLs,omitempty"`
+	ClientURLs []string `json:"clientURLs,omitempty"`
+	IsLearner  bool     `json:"isLearner,omitempty"`
+}
+
+// Client issues cluster requests against a set of etcd endpoints. Requests
+// are attempted against each endpoint in order until one succeeds.
+type Client struct {
+	Endpoints []string
+
+	client *http.Client
+}
+
+// New returns a Client for the given endpoints. The endpoints must be full
+// URLs, e.g. https://10.0.0.1:2379.
+func New(endpoints []string, tlsConfig *tls.Config) *Client {
+	return &Client{
+		Endpoints: endpoints,
+		client: &http.Client{
+			Timeout: defaultRequestTimeout,
+			Transport: &http.Transport{
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}
+}
+
+// Close closes the idle connections of the client. Every Client has its own
+// transport, so it must be closed once it is no longer used.
+func (c *Client) Close() {
+	c.client.CloseIdleConnections()
+}
+
+// NewTLSConfig builds a mutual TLS configuration from PEM encoded CA
+// certificate, client certificate and client key.
+func NewTLSConfig(caPEM, certPEM, keyPEM []byte) (*tls.Config, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load etcd client certificate")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("failed to load etcd CA certificate")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}, nil
+}
+
+// MemberList returns the current members of the cluster.
+func (c *Client) MemberList(ctx context.Context) ([]*Member, error) {
+	var resp struct {
+		Members []*Member `json:"members"`
+	}
+	if err := c.do(ctx, c.Endpoints, "/v3/cluster/member/list", struct{}{}, &resp); err != nil {
+		return nil, errors.Wrap(err, "failed to list etcd members")
+	}
+	return resp.Members, nil
+}
+
+// MemberRemove removes the member with the given ID from the cluster.
+func (c *Client) MemberRemove(ctx context.Context, id uint64) error {
+	req := struct {
+		ID uint64 `json:"ID,string"`
+	}{ID: id}
+	if err := c.do(ctx, c.Endpoints, "/v3/cluster/member/remove", req, nil); err != nil {
+		return errors.Wrapf(err, "failed to remove etcd member %x", id)
+	}
+	return nil
+}
+
+// MemberHealthy reports whether the member responds to a status request on
+// any of its client URLs.
+func (c *Client) MemberHealthy(ctx context.Context, m *Member) bool {
+	if len(m.ClientURLs) == 0 {
+		return false
+	}
+	return c.do(ctx, m.ClientURLs, "/v3/maintenance/status", struct{}{}, nil) == nil
+}
+
+func (c *Client) do(ctx context.Context, endpoints []string, path string, in, out interface{}) error {
+	if len(endpoints) == 0 {
+		return errors.New("no etcd endpoints")
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	errs := make([]error, 0)
+	for _, ep := range endpoints {
+		data, err := c.post(ctx, strings.TrimSuffix(ep, "/")+path, body)
+		if err != nil {
+			errs = append(errs, errors.Wrap(err, ep))
+			continue
+		}
+		if out == nil {
+			return nil
+		}
+		return json.Unmarshal(data, out)
+	}
+	return kerrors.NewAggregate(errs)
+}
+
+func (c *Client) post(ctx context.Context, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var gwErr struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(data, &gwErr); err == nil && gwErr.Message != "" {
+			return nil, errors.Errorf("%s: %s", resp.Status, gwErr.Message)
+		}
+		return nil, errors.New(resp.Status)
+	}
+	return data, nil
+}
+
+// CheckRemoveQuorum returns an error if removing the member with the given ID
+// would leave the cluster without a healthy quorum. The healthy map reports
+// the health of each member by ID.
+func CheckRemoveQuorum(members []*Member, healthy map[uint64]bool, id uint64) error {
+	remaining, healthyRemaining := 0, 0
+	for _, m := range members {
+		if m.ID == id || m.IsLearner {
+			continue
+		}
+		remaining++
+		if healthy[m.ID] {
+			healthyRemaining++
+		}
+	}
+	if remaining == 0 {
+		return errors.New("cannot remove the last etcd member")
+	}
+	if quorum := remaining/2 + 1; healthyRemaining < quorum {
+		return errors.Errorf("removing etcd member %x would leave %d of %d healthy members, quorum requires %d", id, healthyRemaining, remaining, quorum)
+	}
+	return nil
+}
+
+// ClientURL returns the etcd client URL for the given host.
+func ClientURL(host string) string {
+	return fmt.Sprintf("https://%s:%d", host, DefaultClientPort)
+}
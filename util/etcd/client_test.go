@@ -0,0 +1,130 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestClient(t *testing.T) {
+	g := NewWithT(t)
+
+	var removed string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/cluster/member/list":
+			_, _ = w.Write([]byte(`{"header":{},"members":[{"ID":"18446744073709551615","name":"cp-1","peerURLs":["https://10.0.0.1:2380"],"clientURLs":["https://10.0.0.1:2379"]}]}`))
+		case "/v3/cluster/member/remove":
+			data, _ := ioutil.ReadAll(r.Body)
+			var req map[string]string
+			_ = json.Unmarshal(data, &req)
+			removed = req["ID"]
+			_, _ = w.Write([]byte(`{}`))
+		case "/healthy/v3/maintenance/status":
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":"etcdserver: unhealthy cluster","message":"etcdserver: unhealthy cluster","code":14}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := New([]string{"https://127.0.0.1:1", srv.URL}, srv.Client().Transport.(*http.Transport).TLSClientConfig)
+
+	members, err := c.MemberList(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(members).To(HaveLen(1))
+	g.Expect(members[0].ID).To(Equal(uint64(18446744073709551615)))
+	g.Expect(members[0].Name).To(Equal("cp-1"))
+	g.Expect(members[0].PeerURLs).To(ConsistOf("https://10.0.0.1:2380"))
+
+	g.Expect(c.MemberRemove(context.Background(), 42)).To(Succeed())
+	g.Expect(removed).To(Equal("42"))
+
+	g.Expect(c.MemberHealthy(context.Background(), &Member{ClientURLs: []string{srv.URL + "/healthy"}})).To(BeTrue())
+	g.Expect(c.MemberHealthy(context.Background(), &Member{ClientURLs: []string{srv.URL + "/unhealthy"}})).To(BeFalse())
+	g.Expect(c.MemberHealthy(context.Background(), &Member{})).To(BeFalse())
+
+	c = New([]string{srv.URL + "/unhealthy"}, srv.Client().Transport.(*http.Transport).TLSClientConfig)
+	_, err = c.MemberList(context.Background())
+	g.Expect(err).To(MatchError(ContainSubstring("etcdserver: unhealthy cluster")))
+}
+
+func TestCheckRemoveQuorum(t *testing.T) {
+	members := []*Member{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4, IsLearner: true}}
+
+	testCases := []struct {
+		name      string
+		members   []*Member
+		healthy   map[uint64]bool
+		id        uint64
+		expectErr bool
+	}{
+		{
+			name:    "all healthy",
+			members: members,
+			healthy: map[uint64]bool{1: true, 2: true, 3: true},
+			id:      1,
+		},
+		{
+			name:    "removed member unhealthy",
+			members: members,
+			healthy: map[uint64]bool{2: true, 3: true},
+			id:      1,
+		},
+		{
+			name:      "other member unhealthy",
+			members:   members,
+			healthy:   map[uint64]bool{1: true, 2: true},
+			id:        1,
+			expectErr: true,
+		},
+		{
+			name:    "two members",
+			members: []*Member{{ID: 1}, {ID: 2}},
+			healthy: map[uint64]bool{1: true, 2: true},
+			id:      1,
+		},
+		{
+			name:      "last member",
+			members:   []*Member{{ID: 1}},
+			healthy:   map[uint64]bool{1: true},
+			id:        1,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := CheckRemoveQuorum(tc.members, tc.healthy, tc.id)
+			if tc.expectErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package external
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// TemplateSuffix is the suffix of template kinds, removed from the kind
+	// of objects cloned from them.
+	TemplateSuffix = "Template"
+
+	// TemplateClonedFromNameAnnotation and
+	// TemplateClonedFromGroupKindAnnotation record the template an object was
+	// cloned from.
+	TemplateClonedFromNameAnnotation      = "machine.crit.sh/cloned-from-name"
+	TemplateClonedFromGroupKindAnnotation = "machine.crit.sh/cloned-from-groupkind"
+)
+
+// CloneTemplateInput is the input to CloneTemplate.
+type CloneTemplateInput struct {
+	// TemplateRef is a reference to the template to clone, defaulting to
+	// Namespace when it has none.
+	TemplateRef *corev1.ObjectReference
+
+	// Namespace and Name of the cloned object.
+	Namespace string
+	Name      string
+
+	// OwnerRef is set as owner reference on the cloned object, if any.
+	// +optional
+	OwnerRef *metav1.OwnerReference
+
+	// Labels are set on the cloned object, in addition to the labels of the
+	// template spec.
+	// +optional
+	Labels map[string]string
+}
+
+// CloneTemplate creates an object from the spec.template of the referenced
+// template and returns a reference to it.
+func CloneTemplate(ctx context.Context, c client.Client, in *CloneTemplateInput) (*corev1.ObjectReference, error) {
+	namespace := in.TemplateRef.Namespace
+	if namespace == "" {
+		namespace = in.Namespace
+	}
+	tmpl, err := Get(ctx, c, in.TemplateRef, namespace)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := GenerateTemplate(tmpl, in)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Create(ctx, obj); err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s %q from template %q", obj.GetKind(), obj.GetName(), tmpl.GetName())
+	}
+	return GetObjectReference(obj), nil
+}
+
+// GenerateTemplate returns the object described by the spec.template of a
+// template object, without creating it.
+func GenerateTemplate(tmpl *unstructured.Unstructured, in *CloneTemplateInput) (*unstructured.Unstructured, error) {
+	template, found, err := unstructured.NestedMap(tmpl.Object, "spec", "template")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to retrieve spec.template of %s %q", tmpl.GetKind(), tmpl.GetName())
+	}
+	if !found {
+		return nil, errors.Errorf("missing spec.template on %s %q", tmpl.GetKind(), tmpl.GetName())
+	}
+
+	obj := &unstructured.Unstructured{Object: template}
+	obj.SetResourceVersion("")
+	obj.SetFinalizers(nil)
+	obj.SetUID("")
+	obj.SetSelfLink("")
+	obj.SetName(in.Name)
+	obj.SetNamespace(in.Namespace)
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[TemplateClonedFromNameAnnotation] = tmpl.GetName()
+	annotations[TemplateClonedFromGroupKindAnnotation] = tmpl.GroupVersionKind().GroupKind().String()
+	obj.SetAnnotations(annotations)
+
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	for k, v := range in.Labels {
+		labels[k] = v
+	}
+	obj.SetLabels(labels)
+
+	if in.OwnerRef != nil {
+		obj.SetOwnerReferences([]metav1.OwnerReference{*in.OwnerRef})
+	}
+
+	obj.SetAPIVersion(tmpl.GetAPIVersion())
+	obj.SetKind(strings.TrimSuffix(tmpl.GetKind(), TemplateSuffix))
+	return obj, nil
+}
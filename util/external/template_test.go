@@ -0,0 +1,102 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package external
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTemplate() *unstructured.Unstructured {
+	tmpl := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"labels": map[string]interface{}{"color": "green"},
+					},
+					"spec": map[string]interface{}{
+						"image": "kindest/node",
+					},
+				},
+			},
+		},
+	}
+	tmpl.SetAPIVersion("green.io/v1")
+	tmpl.SetKind("GreenTemplate")
+	tmpl.SetName("green")
+	tmpl.SetNamespace("test")
+	return tmpl
+}
+
+func TestGenerateTemplate(t *testing.T) {
+	g := NewWithT(t)
+
+	owner := &metav1.OwnerReference{APIVersion: "machine.crit.sh/v1alpha1", Kind: "Machine", Name: "machine"}
+	obj, err := GenerateTemplate(newTemplate(), &CloneTemplateInput{
+		Namespace: "test",
+		Name:      "machine",
+		OwnerRef:  owner,
+		Labels:    map[string]string{"machine": "machine"},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(obj.GetAPIVersion()).To(Equal("green.io/v1"))
+	g.Expect(obj.GetKind()).To(Equal("Green"))
+	g.Expect(obj.GetName()).To(Equal("machine"))
+	g.Expect(obj.GetNamespace()).To(Equal("test"))
+	g.Expect(obj.GetLabels()).To(Equal(map[string]string{"color": "green", "machine": "machine"}))
+	g.Expect(obj.GetAnnotations()).To(HaveKeyWithValue(TemplateClonedFromNameAnnotation, "green"))
+	g.Expect(obj.GetAnnotations()).To(HaveKeyWithValue(TemplateClonedFromGroupKindAnnotation, "GreenTemplate.green.io"))
+	g.Expect(obj.GetOwnerReferences()).To(ConsistOf(*owner))
+
+	image, _, _ := unstructured.NestedString(obj.Object, "spec", "image")
+	g.Expect(image).To(Equal("kindest/node"))
+
+	tmpl := newTemplate()
+	unstructured.RemoveNestedField(tmpl.Object, "spec", "template")
+	_, err = GenerateTemplate(tmpl, &CloneTemplateInput{Namespace: "test", Name: "machine"})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestCloneTemplate(t *testing.T) {
+	g := NewWithT(t)
+
+	c := fake.NewFakeClientWithScheme(runtime.NewScheme(), newTemplate())
+	ref, err := CloneTemplate(context.Background(), c, &CloneTemplateInput{
+		TemplateRef: &corev1.ObjectReference{APIVersion: "green.io/v1", Kind: "GreenTemplate", Name: "green"},
+		Namespace:   "test",
+		Name:        "machine",
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ref.Kind).To(Equal("Green"))
+	g.Expect(ref.Name).To(Equal("machine"))
+	g.Expect(ref.Namespace).To(Equal("test"))
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("green.io/v1")
+	obj.SetKind("Green")
+	g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "test", Name: "machine"}, obj)).To(Succeed())
+}
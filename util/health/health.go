@@ -0,0 +1,95 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health provides the readiness checks of the manager.
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// dialTimeout is the time the webhook server has to accept a connection.
+const dialTimeout = time.Second
+
+// InformersSynced returns a check that fails until the informers of the
+// cache for the given types have synced. The check never waits for the
+// informers.
+func InformersSynced(c cache.Cache, scheme *runtime.Scheme, objs ...runtime.Object) healthz.Checker {
+	return func(_ *http.Request) error {
+		// A cancelled context stops the cache from waiting for the
+		// informer to sync.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		for _, obj := range objs {
+			gvk, err := apiutil.GVKForObject(obj, scheme)
+			if err != nil {
+				return err
+			}
+			informer, err := c.GetInformer(ctx, obj)
+			if err != nil {
+				return errors.Wrapf(err, "informer for %s has not synced", gvk.Kind)
+			}
+			if !informer.HasSynced() {
+				return errors.Errorf("informer for %s has not synced", gvk.Kind)
+			}
+		}
+		return nil
+	}
+}
+
+// WebhookServing returns a check that fails while the webhook server does
+// not accept TLS connections on the host and port.
+func WebhookServing(host string, port int) healthz.Checker {
+	if host == "" {
+		host = "localhost"
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	return func(_ *http.Request) error {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", addr, &tls.Config{
+			// Only whether the server is serving matters, its certificate
+			// is for the service name.
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "webhook server is not serving on %s", addr)
+		}
+		return conn.Close()
+	}
+}
+
+// Elected returns a check that fails until the channel, closed when the
+// manager is elected leader, is closed.
+func Elected(elected <-chan struct{}) healthz.Checker {
+	return func(_ *http.Request) error {
+		select {
+		case <-elected:
+			return nil
+		default:
+			return errors.New("not elected leader")
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+func TestInformersSynced(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = machinev1.AddToScheme(scheme)
+	informers := &informertest.FakeInformers{Scheme: scheme}
+	check := InformersSynced(informers, scheme, &machinev1.Machine{}, &corev1.Node{})
+
+	machines, err := informers.FakeInformerFor(&machinev1.Machine{})
+	g.Expect(err).NotTo(HaveOccurred())
+	nodes, err := informers.FakeInformerFor(&corev1.Node{})
+	g.Expect(err).NotTo(HaveOccurred())
+	machines.Synced = true
+	g.Expect(check(nil)).To(MatchError("informer for Node has not synced"))
+
+	nodes.Synced = true
+	g.Expect(check(nil)).To(Succeed())
+}
+
+func TestWebhookServing(t *testing.T) {
+	g := NewWithT(t)
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	g.Expect(err).NotTo(HaveOccurred())
+	p, err := strconv.Atoi(port)
+	g.Expect(err).NotTo(HaveOccurred())
+	check := WebhookServing(host, p)
+	g.Expect(check(nil)).To(Succeed())
+
+	server.Close()
+	g.Expect(check(nil)).To(MatchError(ContainSubstring("webhook server is not serving")))
+}
+
+func TestElected(t *testing.T) {
+	g := NewWithT(t)
+
+	elected := make(chan struct{})
+	check := Elected(elected)
+	g.Expect(check(nil)).To(MatchError("not elected leader"))
+
+	close(elected)
+	g.Expect(check(nil)).To(Succeed())
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package index provides the field indexes shared by the controllers.
+package index
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+const (
+	// MachineNodeNameField is the field index of Machines by
+	// Status.NodeRef.Name.
+	MachineNodeNameField = "status.nodeRef.name"
+
+	// MachineProviderIDField is the field index of Machines by
+	// Spec.ProviderID.
+	MachineProviderIDField = "spec.providerID"
+
+	// MachineHostnameField is the field index of Machines by the hostnames
+	// their Node may register with, which are the Machine name and its
+	// hostname and internal DNS addresses.
+	MachineHostnameField = "status.addresses.hostname"
+
+	// MachineInfrastructureReadyField is the field index of Machines by
+	// Status.InfrastructureReady, as "true" or "false".
+	MachineInfrastructureReadyField = "status.infrastructureReady"
+
+	// MachineConfigRefField is the field index of Machines by the
+	// "<namespace>/<name>" of Spec.ConfigRef, which defaults to the namespace
+	// of the Machine.
+	MachineConfigRefField = "spec.configRef"
+)
+
+// AddDefaultIndexes registers the field indexes shared by the controllers
+// with the manager. It must be called once, before the controllers using
+// them are set up.
+func AddDefaultIndexes(ctx context.Context, mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &machinev1.Machine{}, MachineNodeNameField, MachineByNodeName); err != nil {
+		return errors.Wrap(err, "failed to index machines by node name")
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &machinev1.Machine{}, MachineProviderIDField, MachineByProviderID); err != nil {
+		return errors.Wrap(err, "failed to index machines by provider id")
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &machinev1.Machine{}, MachineHostnameField, MachineByHostname); err != nil {
+		return errors.Wrap(err, "failed to index machines by hostname")
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &machinev1.Machine{}, MachineInfrastructureReadyField, MachineByInfrastructureReady); err != nil {
+		return errors.Wrap(err, "failed to index machines by infrastructure readiness")
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &machinev1.Machine{}, MachineConfigRefField, MachineByConfigRef); err != nil {
+		return errors.Wrap(err, "failed to index machines by config reference")
+	}
+	return nil
+}
+
+// MachineByNodeName indexes Machines by the name of the Node they are linked
+// to.
+func MachineByNodeName(o runtime.Object) []string {
+	m, ok := o.(*machinev1.Machine)
+	if !ok || m.Status.NodeRef == nil || m.Status.NodeRef.Name == "" {
+		return nil
+	}
+	return []string{m.Status.NodeRef.Name}
+}
+
+// MachineByProviderID indexes Machines by their provider ID.
+func MachineByProviderID(o runtime.Object) []string {
+	m, ok := o.(*machinev1.Machine)
+	if !ok || m.Spec.ProviderID == nil || *m.Spec.ProviderID == "" {
+		return nil
+	}
+	return []string{*m.Spec.ProviderID}
+}
+
+// MachineByHostname indexes Machines by their name and their hostname and
+// internal DNS addresses.
+func MachineByHostname(o runtime.Object) []string {
+	m, ok := o.(*machinev1.Machine)
+	if !ok {
+		return nil
+	}
+	hostnames := sets.NewString(m.Name)
+	for _, address := range m.Status.Addresses {
+		switch address.Type {
+		case machinev1.MachineHostName, machinev1.MachineInternalDNS:
+			if address.Address != "" {
+				hostnames.Insert(address.Address)
+			}
+		}
+	}
+	return hostnames.List()
+}
+
+// MachineByInfrastructureReady indexes Machines by whether their
+// infrastructure is ready.
+func MachineByInfrastructureReady(o runtime.Object) []string {
+	m, ok := o.(*machinev1.Machine)
+	if !ok {
+		return nil
+	}
+	return []string{strconv.FormatBool(m.Status.InfrastructureReady)}
+}
+
+// MachineByConfigRef indexes Machines by the namespace and name of the Config
+// they reference.
+func MachineByConfigRef(o runtime.Object) []string {
+	m, ok := o.(*machinev1.Machine)
+	if !ok || m.Spec.ConfigRef.Name == "" {
+		return nil
+	}
+	return []string{ConfigRefKey(m)}
+}
+
+// ConfigRefKey returns the value of the MachineConfigRefField index for a
+// Machine.
+func ConfigRefKey(m *machinev1.Machine) string {
+	namespace := m.Spec.ConfigRef.Namespace
+	if namespace == "" {
+		namespace = m.Namespace
+	}
+	return namespace + "/" + m.Spec.ConfigRef.Name
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+func TestMachineByNodeName(t *testing.T) {
+	g := NewWithT(t)
+
+	m := &machinev1.Machine{}
+	g.Expect(MachineByNodeName(m)).To(BeEmpty())
+	m.Status.NodeRef = &corev1.ObjectReference{}
+	g.Expect(MachineByNodeName(m)).To(BeEmpty())
+	m.Status.NodeRef.Name = "worker"
+	g.Expect(MachineByNodeName(m)).To(Equal([]string{"worker"}))
+	g.Expect(MachineByNodeName(&corev1.Node{})).To(BeEmpty())
+}
+
+func TestMachineByHostname(t *testing.T) {
+	g := NewWithT(t)
+
+	m := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker"}}
+	g.Expect(MachineByHostname(m)).To(Equal([]string{"worker"}))
+
+	m.Status.Addresses = machinev1.MachineAddresses{
+		{Type: machinev1.MachineHostName, Address: "worker"},
+		{Type: machinev1.MachineInternalDNS, Address: "worker.internal"},
+		{Type: machinev1.MachineInternalIP, Address: "10.0.0.1"},
+	}
+	g.Expect(MachineByHostname(m)).To(Equal([]string{"worker", "worker.internal"}))
+	g.Expect(MachineByHostname(&corev1.Node{})).To(BeEmpty())
+}
+
+func TestMachineByInfrastructureReady(t *testing.T) {
+	g := NewWithT(t)
+
+	m := &machinev1.Machine{}
+	g.Expect(MachineByInfrastructureReady(m)).To(Equal([]string{"false"}))
+	m.Status.InfrastructureReady = true
+	g.Expect(MachineByInfrastructureReady(m)).To(Equal([]string{"true"}))
+}
+
+func TestMachineByConfigRef(t *testing.T) {
+	g := NewWithT(t)
+
+	m := &machinev1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "worker", Namespace: "default"}}
+	g.Expect(MachineByConfigRef(m)).To(BeEmpty())
+
+	m.Spec.ConfigRef.Name = "config"
+	g.Expect(MachineByConfigRef(m)).To(Equal([]string{"default/config"}))
+
+	m.Spec.ConfigRef.Namespace = "configs"
+	g.Expect(MachineByConfigRef(m)).To(Equal([]string{"configs/config"}))
+	g.Expect(MachineByConfigRef(&corev1.Node{})).To(BeEmpty())
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package namespacecache provides a cache restricted to a set of namespaces
+// that still serves cluster-scoped objects.
+package namespacecache
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// New returns a NewCacheFunc for a cache of the objects in the given
+// namespaces. Namespaced objects are read from a MultiNamespacedCache, which
+// cannot get cluster-scoped objects, such as Nodes and
+// CertificateSigningRequests, and lists them once per namespace. These are
+// read from a cache of the whole cluster instead.
+func New(namespaces []string) cache.NewCacheFunc {
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		namespaced, err := cache.MultiNamespacedCacheBuilder(namespaces)(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		opts.Namespace = ""
+		cluster, err := cache.New(config, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &namespaceCache{
+			namespaced: namespaced,
+			cluster:    cluster,
+			scheme:     opts.Scheme,
+			mapper:     opts.Mapper,
+		}, nil
+	}
+}
+
+// namespaceCache routes namespaced objects to the namespaced cache and
+// cluster-scoped objects to the cluster cache. Only informers for
+// cluster-scoped objects are ever started in the cluster cache.
+type namespaceCache struct {
+	namespaced cache.Cache
+	cluster    cache.Cache
+	scheme     *runtime.Scheme
+	mapper     meta.RESTMapper
+}
+
+var _ cache.Cache = &namespaceCache{}
+
+func (c *namespaceCache) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	target, err := c.cacheForObject(obj, false)
+	if err != nil {
+		return err
+	}
+	return target.Get(ctx, key, obj)
+}
+
+func (c *namespaceCache) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	target, err := c.cacheForObject(list, true)
+	if err != nil {
+		return err
+	}
+	return target.List(ctx, list, opts...)
+}
+
+func (c *namespaceCache) GetInformer(ctx context.Context, obj runtime.Object) (cache.Informer, error) {
+	target, err := c.cacheForObject(obj, false)
+	if err != nil {
+		return nil, err
+	}
+	return target.GetInformer(ctx, obj)
+}
+
+func (c *namespaceCache) GetInformerForKind(ctx context.Context, gvk schema.GroupVersionKind) (cache.Informer, error) {
+	target, err := c.cacheForKind(gvk)
+	if err != nil {
+		return nil, err
+	}
+	return target.GetInformerForKind(ctx, gvk)
+}
+
+func (c *namespaceCache) IndexField(ctx context.Context, obj runtime.Object, field string, extractValue client.IndexerFunc) error {
+	target, err := c.cacheForObject(obj, false)
+	if err != nil {
+		return err
+	}
+	return target.IndexField(ctx, obj, field, extractValue)
+}
+
+// Start runs both caches until the stop channel is closed, or either of
+// them fails, which stops the other one.
+func (c *namespaceCache) Start(stop <-chan struct{}) error {
+	stopBoth := make(chan struct{})
+	errs := make(chan error, 2)
+	for _, target := range []cache.Cache{c.namespaced, c.cluster} {
+		go func(target cache.Cache) {
+			errs <- target.Start(stopBoth)
+		}(target)
+	}
+	pending := 2
+	var err error
+	select {
+	case <-stop:
+	case err = <-errs:
+		pending--
+	}
+	close(stopBoth)
+	for ; pending > 0; pending-- {
+		if e := <-errs; err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (c *namespaceCache) WaitForCacheSync(stop <-chan struct{}) bool {
+	namespacedSynced := c.namespaced.WaitForCacheSync(stop)
+	clusterSynced := c.cluster.WaitForCacheSync(stop)
+	return namespacedSynced && clusterSynced
+}
+
+// cacheForObject returns the cache of the kind of the object, which is a
+// list of that kind when isList is set.
+func (c *namespaceCache) cacheForObject(obj runtime.Object, isList bool) (cache.Cache, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return nil, err
+	}
+	if isList {
+		gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	}
+	return c.cacheForKind(gvk)
+}
+
+func (c *namespaceCache) cacheForKind(gvk schema.GroupVersionKind) (cache.Cache, error) {
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot find the scope of %s", gvk)
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return c.cluster, nil
+	}
+	return c.namespaced, nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2020 Critical Stack, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package namespacecache
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	machinev1 "github.com/criticalstack/machine-api/api/v1alpha1"
+)
+
+// recordingCache records the objects it is asked to read.
+type recordingCache struct {
+	*informertest.FakeInformers
+	reads []runtime.Object
+}
+
+func (c *recordingCache) Get(_ context.Context, _ client.ObjectKey, obj runtime.Object) error {
+	c.reads = append(c.reads, obj)
+	return nil
+}
+
+func (c *recordingCache) List(_ context.Context, list runtime.Object, _ ...client.ListOption) error {
+	c.reads = append(c.reads, list)
+	return nil
+}
+
+// startingCache fails to start, or runs until it is stopped.
+type startingCache struct {
+	*informertest.FakeInformers
+	err     error
+	stopped chan struct{}
+}
+
+func (c *startingCache) Start(stop <-chan struct{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	<-stop
+	close(c.stopped)
+	return nil
+}
+
+func TestNamespaceCacheStart(t *testing.T) {
+	g := NewWithT(t)
+
+	namespaced := &startingCache{err: errors.New("failed to start")}
+	cluster := &startingCache{stopped: make(chan struct{})}
+	c := &namespaceCache{namespaced: namespaced, cluster: cluster}
+	g.Expect(c.Start(make(chan struct{}))).To(MatchError("failed to start"))
+	g.Expect(cluster.stopped).To(BeClosed())
+
+	namespaced = &startingCache{stopped: make(chan struct{})}
+	cluster = &startingCache{stopped: make(chan struct{})}
+	c = &namespaceCache{namespaced: namespaced, cluster: cluster}
+	stop := make(chan struct{})
+	close(stop)
+	g.Expect(c.Start(stop)).To(Succeed())
+	g.Expect(namespaced.stopped).To(BeClosed())
+	g.Expect(cluster.stopped).To(BeClosed())
+}
+
+func TestNamespaceCache(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = machinev1.AddToScheme(scheme)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Node"), meta.RESTScopeRoot)
+	mapper.Add(machinev1.GroupVersion.WithKind("Machine"), meta.RESTScopeNamespace)
+	namespaced := &recordingCache{FakeInformers: &informertest.FakeInformers{Scheme: scheme}}
+	cluster := &recordingCache{FakeInformers: &informertest.FakeInformers{Scheme: scheme}}
+	c := &namespaceCache{namespaced: namespaced, cluster: cluster, scheme: scheme, mapper: mapper}
+	ctx := context.Background()
+
+	node := &corev1.Node{}
+	nodes := &corev1.NodeList{}
+	machine := &machinev1.Machine{}
+	machines := &machinev1.MachineList{}
+	g.Expect(c.Get(ctx, client.ObjectKey{Name: "node"}, node)).To(Succeed())
+	g.Expect(c.List(ctx, nodes)).To(Succeed())
+	g.Expect(c.Get(ctx, client.ObjectKey{Namespace: "tenant", Name: "machine"}, machine)).To(Succeed())
+	g.Expect(c.List(ctx, machines)).To(Succeed())
+	g.Expect(cluster.reads).To(Equal([]runtime.Object{node, nodes}))
+	g.Expect(namespaced.reads).To(Equal([]runtime.Object{machine, machines}))
+
+	_, err := c.GetInformer(ctx, &corev1.Node{})
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = c.GetInformerForKind(ctx, machinev1.GroupVersion.WithKind("Machine"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cluster.InformersByGVK).To(HaveKey(corev1.SchemeGroupVersion.WithKind("Node")))
+	g.Expect(cluster.InformersByGVK).NotTo(HaveKey(machinev1.GroupVersion.WithKind("Machine")))
+	g.Expect(namespaced.InformersByGVK).To(HaveKey(machinev1.GroupVersion.WithKind("Machine")))
+	g.Expect(namespaced.InformersByGVK).NotTo(HaveKey(corev1.SchemeGroupVersion.WithKind("Node")))
+
+	g.Expect(c.Get(ctx, client.ObjectKey{Name: "config"}, &machinev1.Config{})).To(MatchError(ContainSubstring("cannot find the scope")))
+}
@@ -112,13 +112,8 @@ func (h *Helper) Patch(ctx context.Context, resource runtime.Object) error {
 
 	var errs []error
 
-	if !reflect.DeepEqual(h.before, after) {
-		// only issue a Patch if the before and after resources (minus status) differ
-		if err := h.client.Patch(ctx, resource.DeepCopyObject(), h.resourcePatch); err != nil {
-			errs = append(errs, err)
-		}
-	}
-
+	// The status is patched before the resource itself, so that the status is
+	// still recorded when the resource patch removes the last finalizer.
 	if (h.hasStatus || hasStatus) && !reflect.DeepEqual(h.beforeStatus, afterStatus) {
 		// only issue a Status Patch if the resource has a status and the beforeStatus
 		// and afterStatus copies differ
@@ -127,5 +122,12 @@ func (h *Helper) Patch(ctx context.Context, resource runtime.Object) error {
 		}
 	}
 
+	if !reflect.DeepEqual(h.before, after) {
+		// only issue a Patch if the before and after resources (minus status) differ
+		if err := h.client.Patch(ctx, resource.DeepCopyObject(), h.resourcePatch); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	return kerrors.NewAggregate(errs)
 }
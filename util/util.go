@@ -38,10 +38,14 @@ func MachineToInfrastructureMapFunc(gvk schema.GroupVersionKind) handler.ToReque
 			return nil
 		}
 
+		namespace := m.Spec.InfrastructureRef.Namespace
+		if namespace == "" {
+			namespace = m.Namespace
+		}
 		return []reconcile.Request{
 			{
 				NamespacedName: client.ObjectKey{
-					Namespace: m.Namespace,
+					Namespace: namespace,
 					Name:      m.Spec.InfrastructureRef.Name,
 				},
 			},
@@ -91,6 +95,22 @@ func GetInfrastructureProviderByName(ctx context.Context, c client.Client, name
 	return ip, nil
 }
 
+// IsPaused returns true if the object has the PausedAnnotation set.
+func IsPaused(o metav1.Object) bool {
+	_, ok := o.GetAnnotations()[machinev1.PausedAnnotation]
+	return ok
+}
+
+// HasFinalizer returns true if the object has the finalizer.
+func HasFinalizer(o metav1.Object, finalizer string) bool {
+	for _, f := range o.GetFinalizers() {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
 var (
 	ErrUnstructuredFieldNotFound = fmt.Errorf("field not found")
 )